@@ -8,25 +8,128 @@
 
 package apdu
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// MaxShortNc is the largest command data field encodable in a short APDU.
+	MaxShortNc = 255
+	// MaxShortNe is the largest expected response length of a short APDU.
+	MaxShortNe = 256
+	// MaxExtendedNc is the largest command data field encodable in an extended APDU.
+	MaxExtendedNc = 65535
+	// MaxExtendedNe is the largest expected response length of an extended APDU.
+	MaxExtendedNe = 65536
+)
+
+var (
+	// ErrInvalidCommand is returned when a command APDU can not be encoded or decoded.
+	ErrInvalidCommand = errors.New("apdu: invalid command")
+	// ErrInvalidResponse is returned when a response APDU can not be encoded or decoded.
+	ErrInvalidResponse = errors.New("apdu: invalid response")
+)
+
+// Case identifies one of the ISO 7816-3 command APDU cases.
+type Case uint8
+
+const (
+	Case1  Case = iota + 1 // No command data, no response data.
+	Case2S                 // No command data, short Le.
+	Case3S                 // Short Lc and command data, no response data.
+	Case4S                 // Short Lc, command data and short Le.
+	Case2E                 // No command data, extended Le.
+	Case3E                 // Extended Lc and command data, no response data.
+	Case4E                 // Extended Lc, command data and extended Le.
+)
+
+// String returns the ISO 7816-3 name of the case.
+func (c Case) String() string {
+	switch c {
+	case Case1:
+		return "1"
+	case Case2S:
+		return "2S"
+	case Case3S:
+		return "3S"
+	case Case4S:
+		return "4S"
+	case Case2E:
+		return "2E"
+	case Case3E:
+		return "3E"
+	case Case4E:
+		return "4E"
+	}
+	return fmt.Sprintf("Case(%d)", uint8(c))
+}
 
 // Command represents a generic APDU command structure.
 type Command struct {
-	// ... potential fields ...
+	CLA  byte
+	INS  byte
+	P1   byte
+	P2   byte
+	Data []byte
+	// Ne is the maximum number of response bytes expected, 0 meaning
+	// no response data. The values 256 and 65536 are encoded as 00 and 0000.
+	Ne int
+	// Extended forces the extended length encoding even when the command
+	// would fit in a short APDU.
+	Extended bool
+}
+
+// IsExtended reports whether the command is encoded using extended length fields.
+func (cmd *Command) IsExtended() bool {
+	return cmd.Extended || len(cmd.Data) > MaxShortNc || cmd.Ne > MaxShortNe
+}
+
+// Case returns the ISO 7816-3 case the command is encoded as.
+func (cmd *Command) Case() Case {
+	ext := cmd.IsExtended()
+	switch {
+	case len(cmd.Data) == 0 && cmd.Ne == 0:
+		return Case1
+	case len(cmd.Data) == 0 && ext:
+		return Case2E
+	case len(cmd.Data) == 0:
+		return Case2S
+	case cmd.Ne == 0 && ext:
+		return Case3E
+	case cmd.Ne == 0:
+		return Case3S
+	case ext:
+		return Case4E
+	}
+	return Case4S
+}
+
+// String returns the hex encoding of the command header for log output.
+func (cmd *Command) String() string {
+	return fmt.Sprintf("%02X %02X %02X %02X Nc=%d Ne=%d", cmd.CLA, cmd.INS, cmd.P1, cmd.P2, len(cmd.Data), cmd.Ne)
 }
 
 // Response represents a generic APDU response structure.
 type Response struct {
-	// ... potential fields ...
+	Data []byte
+	SW1  byte
+	SW2  byte
+}
+
+// SW returns the status word as a single 16-bit value.
+func (resp *Response) SW() uint16 {
+	return uint16(resp.SW1)<<8 | uint16(resp.SW2)
 }
 
 // CheckStatus checks the status words of a response APDU and returns an error if they indicate an error.
-func CheckStatus(sw1, sw2 byte) error { return nil }
+// Warnings and errors are reported as *StatusError described by the DefaultRegistry.
+func CheckStatus(sw1, sw2 byte) error { return DefaultRegistry.Check(sw1, sw2) }
 
 // CheckStatusFromData interprets the status words from the last two bytes of a data slice.
 func CheckStatusFromData(data []byte) error {
 	if len(data) < 2 {
-		return fmt.Errorf("data slice too short to contain status words")
+		return fmt.Errorf("%w: data slice too short to contain status words", ErrInvalidResponse)
 	}
 	sw1 := data[len(data)-2]
 	sw2 := data[len(data)-1]
@@ -34,19 +137,153 @@ func CheckStatusFromData(data []byte) error {
 }
 
 // CreateCommand creates a new generic APDU command.
-func CreateCommand( /* parameters */ ) *Command { return nil }
+func CreateCommand(cla, ins, p1, p2 byte, data []byte, ne int) *Command {
+	return &Command{CLA: cla, INS: ins, P1: p1, P2: p2, Data: data, Ne: ne}
+}
 
 // UnmarshalCommand converts a byte slice into a generic APDU command.
-func UnmarshalCommand(data []byte) (*Command, error) { return nil, nil }
+// All short and extended cases are recognised and any length field that
+// does not exactly match the size of data is rejected.
+func UnmarshalCommand(data []byte) (*Command, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: %d bytes is shorter than the header", ErrInvalidCommand, len(data))
+	}
+	cmd := &Command{CLA: data[0], INS: data[1], P1: data[2], P2: data[3]}
+	body := data[4:]
+
+	switch {
+	case len(body) == 0:
+		// Case 1
+		return cmd, nil
+	case len(body) == 1:
+		// Case 2S
+		cmd.Ne = decodeShortLe(body[0])
+		return cmd, nil
+	case body[0] != 0:
+		nc := int(body[0])
+		switch len(body) {
+		case 1 + nc:
+			// Case 3S
+		case 2 + nc:
+			// Case 4S
+			cmd.Ne = decodeShortLe(body[1+nc])
+		default:
+			return nil, fmt.Errorf("%w: Lc=%d does not match %d body bytes", ErrInvalidCommand, nc, len(body))
+		}
+		cmd.Data = append([]byte(nil), body[1:1+nc]...)
+		return cmd, nil
+	}
+
+	// Extended length, body[0] is the 00 marker.
+	cmd.Extended = true
+	if len(body) < 3 {
+		return nil, fmt.Errorf("%w: truncated extended length field", ErrInvalidCommand)
+	}
+	if len(body) == 3 {
+		// Case 2E
+		cmd.Ne = decodeExtendedLe(body[1], body[2])
+		return cmd, nil
+	}
+	nc := int(body[1])<<8 | int(body[2])
+	if nc == 0 {
+		return nil, fmt.Errorf("%w: extended Lc of zero", ErrInvalidCommand)
+	}
+	switch len(body) {
+	case 3 + nc:
+		// Case 3E
+	case 5 + nc:
+		// Case 4E
+		cmd.Ne = decodeExtendedLe(body[3+nc], body[4+nc])
+	default:
+		return nil, fmt.Errorf("%w: extended Lc=%d does not match %d body bytes", ErrInvalidCommand, nc, len(body))
+	}
+	cmd.Data = append([]byte(nil), body[3:3+nc]...)
+	return cmd, nil
+}
 
 // MarshalCommand serializes a generic APDU command into bytes.
-func MarshalCommand(cmd *Command) ([]byte, error) { return nil, nil }
+// The short encoding is used unless the command requires or requests
+// extended length fields.
+func MarshalCommand(cmd *Command) ([]byte, error) {
+	if cmd == nil {
+		return nil, fmt.Errorf("%w: nil command", ErrInvalidCommand)
+	}
+	nc := len(cmd.Data)
+	if nc > MaxExtendedNc {
+		return nil, fmt.Errorf("%w: Nc=%d exceeds %d", ErrInvalidCommand, nc, MaxExtendedNc)
+	}
+	if cmd.Ne < 0 || cmd.Ne > MaxExtendedNe {
+		return nil, fmt.Errorf("%w: Ne=%d out of range", ErrInvalidCommand, cmd.Ne)
+	}
+
+	out := make([]byte, 0, 4+3+nc+2)
+	out = append(out, cmd.CLA, cmd.INS, cmd.P1, cmd.P2)
+
+	if !cmd.IsExtended() {
+		if nc > 0 {
+			out = append(out, byte(nc))
+			out = append(out, cmd.Data...)
+		}
+		if cmd.Ne > 0 {
+			out = append(out, byte(cmd.Ne)) // 256 wraps to 00
+		}
+		return out, nil
+	}
+
+	if nc == 0 && cmd.Ne == 0 {
+		// Case 1 has no length fields to extend.
+		return out, nil
+	}
+	out = append(out, 0x00)
+	if nc > 0 {
+		out = append(out, byte(nc>>8), byte(nc))
+		out = append(out, cmd.Data...)
+	}
+	if cmd.Ne > 0 {
+		out = append(out, byte(cmd.Ne>>8), byte(cmd.Ne)) // 65536 wraps to 0000
+	}
+	return out, nil
+}
 
 // CreateResponse creates a new generic APDU response.
-func CreateResponse( /* parameters */ ) *Response { return nil }
+func CreateResponse(data []byte, sw1, sw2 byte) *Response {
+	return &Response{Data: data, SW1: sw1, SW2: sw2}
+}
 
 // UnmarshalResponse parses a byte slice into a generic APDU response.
-func UnmarshalResponse(data []byte) (*Response, error) { return nil, nil }
+func UnmarshalResponse(data []byte) (*Response, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: %d bytes is too short to contain status words", ErrInvalidResponse, len(data))
+	}
+	n := len(data) - 2
+	return &Response{
+		Data: append([]byte(nil), data[:n]...),
+		SW1:  data[n],
+		SW2:  data[n+1],
+	}, nil
+}
 
 // MarshalResponse serializes a generic APDU response into bytes.
-func MarshalResponse(resp *Response) ([]byte, error) { return nil, nil }
+func MarshalResponse(resp *Response) ([]byte, error) {
+	if resp == nil {
+		return nil, fmt.Errorf("%w: nil response", ErrInvalidResponse)
+	}
+	out := make([]byte, 0, len(resp.Data)+2)
+	out = append(out, resp.Data...)
+	return append(out, resp.SW1, resp.SW2), nil
+}
+
+func decodeShortLe(le byte) int {
+	if le == 0 {
+		return MaxShortNe
+	}
+	return int(le)
+}
+
+func decodeExtendedLe(hi, lo byte) int {
+	ne := int(hi)<<8 | int(lo)
+	if ne == 0 {
+		return MaxExtendedNe
+	}
+	return ne
+}
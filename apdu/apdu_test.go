@@ -0,0 +1,165 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMarshalCommand(t *testing.T) {
+	data300 := bytes.Repeat([]byte{0xAB}, 300)
+
+	tests := []struct {
+		name string
+		cmd  *Command
+		want []byte
+		cas  Case
+	}{
+		{
+			name: "Case 1",
+			cmd:  CreateCommand(0x00, 0xA4, 0x04, 0x00, nil, 0),
+			want: []byte{0x00, 0xA4, 0x04, 0x00},
+			cas:  Case1,
+		},
+		{
+			name: "Case 2S",
+			cmd:  CreateCommand(0x00, 0xB0, 0x00, 0x00, nil, 16),
+			want: []byte{0x00, 0xB0, 0x00, 0x00, 0x10},
+			cas:  Case2S,
+		},
+		{
+			name: "Case 2S Ne=256",
+			cmd:  CreateCommand(0x00, 0xB0, 0x00, 0x00, nil, 256),
+			want: []byte{0x00, 0xB0, 0x00, 0x00, 0x00},
+			cas:  Case2S,
+		},
+		{
+			name: "Case 3S",
+			cmd:  CreateCommand(0x00, 0xA4, 0x00, 0x0C, []byte{0x3F, 0x00}, 0),
+			want: []byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0x3F, 0x00},
+			cas:  Case3S,
+		},
+		{
+			name: "Case 4S",
+			cmd:  CreateCommand(0x00, 0xA4, 0x04, 0x00, []byte{0xA0, 0x00}, 256),
+			want: []byte{0x00, 0xA4, 0x04, 0x00, 0x02, 0xA0, 0x00, 0x00},
+			cas:  Case4S,
+		},
+		{
+			name: "Case 2E",
+			cmd:  CreateCommand(0x00, 0xB0, 0x00, 0x00, nil, 1024),
+			want: []byte{0x00, 0xB0, 0x00, 0x00, 0x00, 0x04, 0x00},
+			cas:  Case2E,
+		},
+		{
+			name: "Case 2E Ne=65536",
+			cmd:  CreateCommand(0x00, 0xB0, 0x00, 0x00, nil, 65536),
+			want: []byte{0x00, 0xB0, 0x00, 0x00, 0x00, 0x00, 0x00},
+			cas:  Case2E,
+		},
+		{
+			name: "Case 3E",
+			cmd:  CreateCommand(0x00, 0xD6, 0x00, 0x00, data300, 0),
+			want: append([]byte{0x00, 0xD6, 0x00, 0x00, 0x00, 0x01, 0x2C}, data300...),
+			cas:  Case3E,
+		},
+		{
+			name: "Case 4E",
+			cmd:  CreateCommand(0x00, 0x2A, 0x9E, 0x9A, data300, 65536),
+			want: append(append([]byte{0x00, 0x2A, 0x9E, 0x9A, 0x00, 0x01, 0x2C}, data300...), 0x00, 0x00),
+			cas:  Case4E,
+		},
+		{
+			name: "Case 4E forced",
+			cmd:  &Command{INS: 0x88, Data: []byte{0x01}, Ne: 8, Extended: true},
+			want: []byte{0x00, 0x88, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0x08},
+			cas:  Case4E,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MarshalCommand(tt.cmd)
+			if err != nil {
+				t.Fatalf("MarshalCommand() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("MarshalCommand() = % X, want % X", got, tt.want)
+			}
+			if c := tt.cmd.Case(); c != tt.cas {
+				t.Errorf("Case() = %s, want %s", c, tt.cas)
+			}
+
+			back, err := UnmarshalCommand(got)
+			if err != nil {
+				t.Fatalf("UnmarshalCommand() error = %v", err)
+			}
+			if back.Ne != tt.cmd.Ne || !bytes.Equal(back.Data, tt.cmd.Data) || back.Case() != tt.cas {
+				t.Errorf("UnmarshalCommand() = %v (case %s), want %v (case %s)", back, back.Case(), tt.cmd, tt.cas)
+			}
+		})
+	}
+}
+
+func TestMarshalCommandInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+	}{
+		{"nil", nil},
+		{"negative Ne", &Command{Ne: -1}},
+		{"Ne too large", &Command{Ne: MaxExtendedNe + 1}},
+		{"Nc too large", &Command{Data: make([]byte, MaxExtendedNc+1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MarshalCommand(tt.cmd); !errors.Is(err, ErrInvalidCommand) {
+				t.Errorf("MarshalCommand() error = %v, want %v", err, ErrInvalidCommand)
+			}
+		})
+	}
+}
+
+func TestUnmarshalCommandInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte{0x00, 0xA4, 0x04}},
+		{"short Lc too large", []byte{0x00, 0xA4, 0x04, 0x00, 0x03, 0x01, 0x02}},
+		{"short Lc trailing bytes", []byte{0x00, 0xA4, 0x04, 0x00, 0x01, 0x01, 0x02, 0x03}},
+		{"truncated extended", []byte{0x00, 0xB0, 0x00, 0x00, 0x00, 0x01}},
+		{"extended Lc zero", []byte{0x00, 0xB0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}},
+		{"extended Lc mismatch", []byte{0x00, 0xD6, 0x00, 0x00, 0x00, 0x00, 0x02, 0x01}},
+		{"extended single Le byte", []byte{0x00, 0xD6, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnmarshalCommand(tt.data); !errors.Is(err, ErrInvalidCommand) {
+				t.Errorf("UnmarshalCommand() error = %v, want %v", err, ErrInvalidCommand)
+			}
+		})
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	raw := []byte{0x6F, 0x00, 0x90, 0x00}
+	resp, err := UnmarshalResponse(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalResponse() error = %v", err)
+	}
+	if resp.SW() != 0x9000 || !bytes.Equal(resp.Data, []byte{0x6F, 0x00}) {
+		t.Errorf("UnmarshalResponse() = %+v", resp)
+	}
+	got, err := MarshalResponse(resp)
+	if err != nil || !bytes.Equal(got, raw) {
+		t.Errorf("MarshalResponse() = % X, %v, want % X", got, err, raw)
+	}
+	if _, err := UnmarshalResponse([]byte{0x90}); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("UnmarshalResponse() error = %v, want %v", err, ErrInvalidResponse)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import "fmt"
+
+// ClaChaining is the CLA bit announcing that more commands of a chain follow.
+const ClaChaining = 0x10
+
+// ChainError reports the link of a command chain whose response carried
+// an error. Link is zero based.
+type ChainError struct {
+	Link  int
+	Links int
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("apdu: chain link %d of %d: %v", e.Link+1, e.Links, e.Err)
+}
+
+// Unwrap returns the underlying error so status sentinels still match.
+func (e *ChainError) Unwrap() error { return e.Err }
+
+// Chain splits cmd into an ISO 7816-4 command chain of short APDUs carrying
+// at most size data bytes each. Every link except the last has the
+// ClaChaining bit set and expects no response data, the last link carries
+// the Ne of cmd limited to MaxShortNe. A size of zero or less selects
+// MaxShortNc. Commands that fit in one link are returned unchanged.
+func Chain(cmd *Command, size int) ([]*Command, error) {
+	if cmd == nil {
+		return nil, fmt.Errorf("%w: nil command", ErrInvalidCommand)
+	}
+	if size <= 0 {
+		size = MaxShortNc
+	}
+	if size > MaxShortNc {
+		return nil, fmt.Errorf("%w: chain link size %d exceeds %d", ErrInvalidCommand, size, MaxShortNc)
+	}
+	if len(cmd.Data) <= size {
+		return []*Command{cmd}, nil
+	}
+
+	var links []*Command
+	for off := 0; off < len(cmd.Data); off += size {
+		end := off + size
+		link := &Command{CLA: cmd.CLA | ClaChaining, INS: cmd.INS, P1: cmd.P1, P2: cmd.P2}
+		if end >= len(cmd.Data) {
+			end = len(cmd.Data)
+			link.CLA = cmd.CLA &^ ClaChaining
+			link.Ne = min(cmd.Ne, MaxShortNe)
+		}
+		link.Data = cmd.Data[off:end]
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// TransmitChain sends cmd through t, as a command chain when its data does
+// not fit in size bytes. Intermediate links must complete with normal
+// processing. A status error is returned as a *ChainError naming the link;
+// when it is the final link that failed, its response is returned as well.
+func TransmitChain(t Transmitter, cmd *Command, size int) (*Response, error) {
+	links, err := Chain(cmd, size)
+	if err != nil {
+		return nil, err
+	}
+	var resp *Response
+	for i, link := range links {
+		raw, err := MarshalCommand(link)
+		if err != nil {
+			return nil, err
+		}
+		rawResp, err := t.Transmit(raw)
+		if err != nil {
+			return nil, &ChainError{Link: i, Links: len(links), Err: err}
+		}
+		resp, err = UnmarshalResponse(rawResp)
+		if err != nil {
+			return nil, &ChainError{Link: i, Links: len(links), Err: err}
+		}
+		if err := CheckStatus(resp.SW1, resp.SW2); err != nil {
+			if i < len(links)-1 {
+				return nil, &ChainError{Link: i, Links: len(links), Err: err}
+			}
+			return resp, &ChainError{Link: i, Links: len(links), Err: err}
+		}
+	}
+	return resp, nil
+}
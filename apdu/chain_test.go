@@ -0,0 +1,80 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	data := bytes.Repeat([]byte{0x5A}, 600)
+	links, err := Chain(CreateCommand(0x00, 0xDB, 0x3F, 0xFF, data, 1024), 0)
+	if err != nil {
+		t.Fatalf("Chain() error = %v", err)
+	}
+	if len(links) != 3 {
+		t.Fatalf("Chain() returned %d links, want 3", len(links))
+	}
+	wantSizes := []int{255, 255, 90}
+	var joined []byte
+	for i, link := range links {
+		last := i == len(links)-1
+		if got := link.CLA&ClaChaining != 0; got == last {
+			t.Errorf("link %d chaining bit = %v", i, got)
+		}
+		if len(link.Data) != wantSizes[i] {
+			t.Errorf("link %d carries %d bytes, want %d", i, len(link.Data), wantSizes[i])
+		}
+		if link.IsExtended() {
+			t.Errorf("link %d uses extended length", i)
+		}
+		joined = append(joined, link.Data...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Errorf("chain data does not reassemble to the command data")
+	}
+	if links[2].Ne != MaxShortNe {
+		t.Errorf("last link Ne = %d, want %d", links[2].Ne, MaxShortNe)
+	}
+
+	single, _ := Chain(CreateCommand(0x00, 0xDB, 0x3F, 0xFF, data[:10], 0), 0)
+	if len(single) != 1 || single[0].CLA != 0x00 {
+		t.Errorf("Chain() split a command which fits in one link")
+	}
+	if _, err := Chain(CreateCommand(0x00, 0xDB, 0x3F, 0xFF, data, 0), 300); !errors.Is(err, ErrInvalidCommand) {
+		t.Errorf("Chain() error = %v, want %v", err, ErrInvalidCommand)
+	}
+}
+
+func TestTransmitChain(t *testing.T) {
+	data := bytes.Repeat([]byte{0x01}, 20)
+
+	card := &scriptedCard{responses: [][]byte{{0x90, 0x00}, {0x90, 0x00}, {0xCA, 0xFE, 0x90, 0x00}}}
+	resp, err := TransmitChain(card, CreateCommand(0x00, 0xDB, 0x3F, 0xFF, data, 256), 8)
+	if err != nil {
+		t.Fatalf("TransmitChain() error = %v", err)
+	}
+	if !bytes.Equal(resp.Data, []byte{0xCA, 0xFE}) || len(card.received) != 3 {
+		t.Errorf("TransmitChain() = %+v after %d commands", resp, len(card.received))
+	}
+	if card.received[0][0] != ClaChaining || card.received[2][0] != 0x00 {
+		t.Errorf("unexpected CLA bytes %02X, %02X", card.received[0][0], card.received[2][0])
+	}
+
+	card = &scriptedCard{responses: [][]byte{{0x90, 0x00}, {0x68, 0x84}}}
+	_, err = TransmitChain(card, CreateCommand(0x00, 0xDB, 0x3F, 0xFF, data, 0), 8)
+	var ce *ChainError
+	if !errors.As(err, &ce) || ce.Link != 1 || ce.Links != 3 {
+		t.Fatalf("TransmitChain() error = %v, want failure on link 1 of 3", err)
+	}
+	if !errors.Is(err, ErrChainingNotSupported) {
+		t.Errorf("errors.Is(%v, %v) = false", err, ErrChainingNotSupported)
+	}
+	if len(card.received) != 2 {
+		t.Errorf("chain continued after a failed link")
+	}
+}
@@ -0,0 +1,538 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// Instruction describes an instruction byte for the disassembler.
+type Instruction struct {
+	Name string
+	// Params describes P1 and P2, it may be nil.
+	Params func(p1, p2 byte) string
+	// TLVData reports that the command data field is BER-TLV encoded.
+	TLVData bool
+}
+
+// InstructionTable is a set of instructions contributed to a Disassembler,
+// typically by an application package from its init function.
+type InstructionTable struct {
+	Name string
+	// Match selects the class bytes the table applies to. A nil Match
+	// selects the interindustry classes.
+	Match        func(cla byte) bool
+	Instructions map[byte]Instruction
+	// TagNames names BER-TLV tags found anywhere in command and response
+	// data. It suits tags with a single meaning, such as those of the
+	// application class; context-specific tags belong in Templates.
+	TagNames map[tlv.Tag]string
+	// Templates names tags by the constructed tag enclosing them, the
+	// key 0 standing for the top level of the data field. They take
+	// precedence over the TagNames of every table.
+	Templates map[tlv.Tag]map[tlv.Tag]string
+}
+
+func (t *InstructionTable) matches(cla byte) bool {
+	if t.Match == nil {
+		return cla&0x80 == 0
+	}
+	return t.Match(cla)
+}
+
+// Disassembler decodes APDUs into annotated text for logs.
+type Disassembler struct {
+	mu     sync.RWMutex
+	tables []*InstructionTable // most recently registered first
+}
+
+// DefaultDisassembler knows the interindustry instructions of ISO 7816-4
+// and is used by DisassembleCommand and DisassembleResponse.
+var DefaultDisassembler = NewDisassembler()
+
+// NewDisassembler returns a Disassembler knowing the interindustry instructions.
+func NewDisassembler() *Disassembler {
+	return &Disassembler{tables: []*InstructionTable{smTable, interindustryTable}}
+}
+
+// Register adds a table. Tables registered later take precedence.
+func (d *Disassembler) Register(t *InstructionTable) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tables = append([]*InstructionTable{t}, d.tables...)
+}
+
+// RegisterInstructions adds a table to the DefaultDisassembler.
+func RegisterInstructions(t *InstructionTable) {
+	DefaultDisassembler.Register(t)
+}
+
+// DisassembleCommand decodes a raw command APDU with the DefaultDisassembler.
+func DisassembleCommand(raw []byte) string {
+	return DefaultDisassembler.Command(raw)
+}
+
+// DisassembleResponse decodes a raw response APDU with the DefaultDisassembler.
+func DisassembleResponse(raw []byte) string {
+	return DefaultDisassembler.Response(raw)
+}
+
+// DisassembleExchange decodes a command and its response with the DefaultDisassembler.
+func DisassembleExchange(cmd, resp []byte) string {
+	return DefaultDisassembler.Exchange(cmd, resp)
+}
+
+// Command decodes a raw command APDU into annotated text.
+func (d *Disassembler) Command(raw []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "C-APDU % X\n", raw)
+	cmd, err := UnmarshalCommand(raw)
+	if err != nil {
+		fmt.Fprintf(&b, "  malformed: %v\n", err)
+		return b.String()
+	}
+
+	ins, ok := d.lookup(cmd.CLA, cmd.INS)
+	name := ins.Name
+	if !ok {
+		name = "unknown instruction"
+	}
+	fmt.Fprintf(&b, "  CLA %02X  %s\n", cmd.CLA, describeCLA(cmd.CLA))
+	fmt.Fprintf(&b, "  INS %02X  %s\n", cmd.INS, name)
+	params := ""
+	if ins.Params != nil {
+		params = ins.Params(cmd.P1, cmd.P2)
+	}
+	fmt.Fprintf(&b, "  P1P2 %02X%02X  %s\n", cmd.P1, cmd.P2, params)
+	if len(cmd.Data) > 0 {
+		fmt.Fprintf(&b, "  Lc  %d\n", len(cmd.Data))
+		fmt.Fprintf(&b, "  Data % X\n", cmd.Data)
+		if ins.TLVData {
+			d.writeTLV(&b, cmd.CLA, cmd.Data)
+		}
+	}
+	if cmd.Ne > 0 {
+		fmt.Fprintf(&b, "  Le  %d\n", cmd.Ne)
+	}
+	fmt.Fprintf(&b, "  Case %s\n", cmd.Case())
+	return b.String()
+}
+
+// Response decodes a raw response APDU into annotated text. Response
+// data is shown as BER-TLV when it parses as such, with the tag names
+// of the interindustry class.
+func (d *Disassembler) Response(raw []byte) string {
+	return d.response(0x00, raw)
+}
+
+// Exchange decodes a command APDU and its response. The tag names in the
+// response are taken from the tables matching the class of the command.
+func (d *Disassembler) Exchange(cmd, resp []byte) string {
+	cla := byte(0x00)
+	if len(cmd) > 0 {
+		cla = cmd[0]
+	}
+	return d.Command(cmd) + d.response(cla, resp)
+}
+
+func (d *Disassembler) response(cla byte, raw []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "R-APDU % X\n", raw)
+	resp, err := UnmarshalResponse(raw)
+	if err != nil {
+		fmt.Fprintf(&b, "  malformed: %v\n", err)
+		return b.String()
+	}
+	if len(resp.Data) > 0 {
+		fmt.Fprintf(&b, "  Data % X\n", resp.Data)
+		d.writeTLV(&b, cla, resp.Data)
+	}
+	fmt.Fprintf(&b, "  SW  %04X  %s\n", resp.SW(), describeSW(resp.SW1, resp.SW2))
+	return b.String()
+}
+
+func (d *Disassembler) lookup(cla, ins byte) (Instruction, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.tables {
+		if !t.matches(cla) {
+			continue
+		}
+		if i, ok := t.Instructions[ins]; ok {
+			return i, true
+		}
+	}
+	return Instruction{}, false
+}
+
+// tagName names tag found inside the template parent, 0 at the top
+// level, of data exchanged with class cla. The Templates of the tables
+// matching cla come first, then their TagNames. Proprietary classes fall
+// back to the interindustry data objects, which they commonly reuse.
+func (d *Disassembler) tagName(cla byte, parent, tag tlv.Tag) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	tables := make([]*InstructionTable, 0, len(d.tables)+1)
+	for _, t := range d.tables {
+		if t.matches(cla) {
+			tables = append(tables, t)
+		}
+	}
+	if !interindustryTable.matches(cla) {
+		tables = append(tables, interindustryTable)
+	}
+	for _, t := range tables {
+		if name, ok := t.Templates[parent][tag]; ok {
+			return name
+		}
+	}
+	for _, t := range tables {
+		if name, ok := t.TagNames[tag]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// writeTLV writes an indented BER-TLV tree of data, or nothing when data
+// is not well formed BER-TLV.
+func (d *Disassembler) writeTLV(b *strings.Builder, cla byte, data []byte) {
+	objs, err := tlv.Parse(data)
+	if err != nil {
+		return
+	}
+	var walk func(objs tlv.List, parent tlv.Tag, depth int)
+	walk = func(objs tlv.List, parent tlv.Tag, depth int) {
+		for _, o := range objs {
+			indent := strings.Repeat("  ", depth+2)
+			name := d.tagName(cla, parent, o.Tag)
+			if name != "" {
+				name = " " + name
+			}
+			switch {
+			case o.Tag.Constructed():
+				fmt.Fprintf(b, "%s%s%s (%d)\n", indent, o.Tag, name, len(o.Value))
+				walk(o.Children, o.Tag, depth+1)
+			case len(o.Value) == 0:
+				fmt.Fprintf(b, "%s%s%s\n", indent, o.Tag, name)
+			default:
+				fmt.Fprintf(b, "%s%s%s: % X\n", indent, o.Tag, name, o.Value)
+			}
+		}
+	}
+	walk(objs, 0, 0)
+}
+
+func describeCLA(cla byte) string {
+	switch {
+	case cla == 0xFF:
+		return "reserved class, reader pseudo-APDU"
+	case cla&0x80 != 0:
+		return "proprietary class"
+	case cla&0x40 == 0:
+		s := fmt.Sprintf("interindustry, channel %d", cla&0x03)
+		switch (cla >> 2) & 0x03 {
+		case 1:
+			s += ", proprietary SM"
+		case 2:
+			s += ", SM header not processed"
+		case 3:
+			s += ", SM header authenticated"
+		}
+		if cla&0x10 != 0 {
+			s += ", chained"
+		}
+		return s
+	}
+	s := fmt.Sprintf("interindustry, channel %d", 4+cla&0x0F)
+	if cla&0x20 != 0 {
+		s += ", SM"
+	}
+	if cla&0x10 != 0 {
+		s += ", chained"
+	}
+	return s
+}
+
+func describeSW(sw1, sw2 byte) string {
+	sw := uint16(sw1)<<8 | uint16(sw2)
+	e, ok := DefaultRegistry.Lookup(sw)
+	if !ok || e.Description == "" {
+		return CategoryOf(sw1, sw2).String()
+	}
+	return e.Description
+}
+
+func selectParams(p1, p2 byte) string {
+	var s string
+	switch p1 {
+	case 0x00:
+		s = "select MF, DF or EF by file identifier"
+	case 0x01:
+		s = "select child DF"
+	case 0x02:
+		s = "select EF under current DF"
+	case 0x03:
+		s = "select parent DF of current DF"
+	case 0x04:
+		s = "select by DF name"
+	case 0x08:
+		s = "select by path from MF"
+	case 0x09:
+		s = "select by path from current DF"
+	default:
+		s = "unknown selection"
+	}
+	switch p2 & 0x03 {
+	case 0x00:
+		s += ", first or only occurrence"
+	case 0x01:
+		s += ", last occurrence"
+	case 0x02:
+		s += ", next occurrence"
+	case 0x03:
+		s += ", previous occurrence"
+	}
+	switch p2 & 0x0C {
+	case 0x00:
+		s += ", return FCI"
+	case 0x04:
+		s += ", return FCP"
+	case 0x08:
+		s += ", return FMD"
+	case 0x0C:
+		s += ", no response data"
+	}
+	return s
+}
+
+func binaryParams(p1, p2 byte) string {
+	if p1&0x80 != 0 {
+		return fmt.Sprintf("SFI %d, offset %d", p1&0x1F, p2)
+	}
+	return fmt.Sprintf("offset %d", int(p1)<<8|int(p2))
+}
+
+func recordParams(p1, p2 byte) string {
+	s := fmt.Sprintf("record %d", p1)
+	if sfi := p2 >> 3; sfi != 0 {
+		s += fmt.Sprintf(", SFI %d", sfi)
+	} else {
+		s += ", current EF"
+	}
+	switch p2 & 0x07 {
+	case 0x00:
+		s += ", first occurrence"
+	case 0x01:
+		s += ", last occurrence"
+	case 0x02:
+		s += ", next occurrence"
+	case 0x03:
+		s += ", previous occurrence"
+	case 0x04:
+		s += ", record number in P1"
+	case 0x05:
+		s += ", all records from P1 up to the last"
+	case 0x06:
+		s += ", all records from the last up to P1"
+	}
+	return s
+}
+
+func referenceParams(p1, p2 byte) string {
+	scope := "global"
+	if p2&0x80 != 0 {
+		scope = "specific"
+	}
+	return fmt.Sprintf("%s reference data %d", scope, p2&0x1F)
+}
+
+func dataObjectParams(p1, p2 byte) string {
+	return fmt.Sprintf("data object %02X%02X", p1, p2)
+}
+
+func manageChannelParams(p1, p2 byte) string {
+	switch p1 {
+	case 0x00:
+		if p2 == 0 {
+			return "open, channel assigned by the card"
+		}
+		return fmt.Sprintf("open channel %d", p2)
+	case 0x80:
+		return fmt.Sprintf("close channel %d", p2)
+	}
+	return "unknown function"
+}
+
+func mseParams(p1, p2 byte) string {
+	var s string
+	switch p1 & 0x0F {
+	case 0x01:
+		s = "SET"
+	case 0x02:
+		s = "STORE"
+	case 0x03:
+		s = "RESTORE"
+	case 0x04:
+		s = "ERASE"
+	default:
+		s = "unknown function"
+	}
+	switch p2 {
+	case 0xA4:
+		s += " authentication template"
+	case 0xAA:
+		s += " hash-code template"
+	case 0xB4:
+		s += " cryptographic checksum template"
+	case 0xB6:
+		s += " digital signature template"
+	case 0xB8:
+		s += " confidentiality template"
+	}
+	return s
+}
+
+func psoParams(p1, p2 byte) string {
+	switch uint16(p1)<<8 | uint16(p2) {
+	case 0x9E9A:
+		return "compute digital signature"
+	case 0x9080:
+		return "hash"
+	case 0x8086:
+		return "decipher"
+	case 0x8680:
+		return "encipher"
+	case 0x8E80:
+		return "compute cryptographic checksum"
+	case 0x00A2:
+		return "verify cryptographic checksum"
+	case 0x00A8:
+		return "verify digital signature"
+	case 0x00BE:
+		return "verify certificate"
+	}
+	return "unknown operation"
+}
+
+func authParams(p1, p2 byte) string {
+	return fmt.Sprintf("algorithm %02X, key reference %02X", p1, p2)
+}
+
+var interindustryTable = &InstructionTable{
+	Name: "ISO 7816-4",
+	Instructions: map[byte]Instruction{
+		0x04: {Name: "DEACTIVATE FILE"},
+		0x0E: {Name: "ERASE BINARY", Params: binaryParams},
+		0x0C: {Name: "ERASE RECORD", Params: recordParams},
+		0x20: {Name: "VERIFY", Params: referenceParams},
+		0x21: {Name: "VERIFY", Params: referenceParams, TLVData: true},
+		0x22: {Name: "MANAGE SECURITY ENVIRONMENT", Params: mseParams, TLVData: true},
+		0x24: {Name: "CHANGE REFERENCE DATA", Params: referenceParams},
+		0x26: {Name: "DISABLE VERIFICATION REQUIREMENT", Params: referenceParams},
+		0x28: {Name: "ENABLE VERIFICATION REQUIREMENT", Params: referenceParams},
+		0x2A: {Name: "PERFORM SECURITY OPERATION", Params: psoParams},
+		0x2C: {Name: "RESET RETRY COUNTER", Params: referenceParams},
+		0x44: {Name: "ACTIVATE FILE"},
+		0x46: {Name: "GENERATE ASYMMETRIC KEY PAIR", TLVData: true},
+		0x70: {Name: "MANAGE CHANNEL", Params: manageChannelParams},
+		0x82: {Name: "EXTERNAL AUTHENTICATE", Params: authParams},
+		0x84: {Name: "GET CHALLENGE"},
+		0x86: {Name: "GENERAL AUTHENTICATE", Params: authParams, TLVData: true},
+		0x87: {Name: "GENERAL AUTHENTICATE", Params: authParams, TLVData: true},
+		0x88: {Name: "INTERNAL AUTHENTICATE", Params: authParams},
+		0xA0: {Name: "SEARCH BINARY", Params: binaryParams},
+		0xA2: {Name: "SEARCH RECORD", Params: recordParams},
+		0xA4: {Name: "SELECT", Params: selectParams},
+		0xB0: {Name: "READ BINARY", Params: binaryParams},
+		0xB1: {Name: "READ BINARY", TLVData: true},
+		0xB2: {Name: "READ RECORD", Params: recordParams},
+		0xB3: {Name: "READ RECORD", Params: recordParams, TLVData: true},
+		0xC0: {Name: "GET RESPONSE"},
+		0xC2: {Name: "ENVELOPE"},
+		0xCA: {Name: "GET DATA", Params: dataObjectParams},
+		0xCB: {Name: "GET DATA", Params: dataObjectParams, TLVData: true},
+		0xD0: {Name: "WRITE BINARY", Params: binaryParams},
+		0xD2: {Name: "WRITE RECORD", Params: recordParams},
+		0xD6: {Name: "UPDATE BINARY", Params: binaryParams},
+		0xDA: {Name: "PUT DATA", Params: dataObjectParams},
+		0xDB: {Name: "PUT DATA", Params: dataObjectParams, TLVData: true},
+		0xDC: {Name: "UPDATE RECORD", Params: recordParams},
+		0xE0: {Name: "CREATE FILE", TLVData: true},
+		0xE2: {Name: "APPEND RECORD", Params: recordParams},
+		0xE4: {Name: "DELETE FILE"},
+		0xE6: {Name: "TERMINATE DF"},
+		0xE8: {Name: "TERMINATE EF"},
+		0xFE: {Name: "TERMINATE CARD USAGE"},
+	},
+	TagNames: map[tlv.Tag]string{
+		0x4F:   "application identifier",
+		0x50:   "application label",
+		0x5C:   "tag list",
+		0x62:   "FCP template",
+		0x64:   "FMD template",
+		0x6F:   "FCI template",
+		0x7C:   "dynamic authentication data",
+		0x5F2D: "language preference",
+	},
+	Templates: map[tlv.Tag]map[tlv.Tag]string{
+		0x62: fileControlTags,
+		0x64: fileControlTags,
+		0x6F: fileControlTags,
+		0xA5: fileControlTags,
+		0x7C: {
+			0x80: "witness",
+			0x81: "challenge",
+			0x82: "response",
+			0x83: "committed challenge",
+			0x84: "authentication code",
+			0x85: "exponential",
+			0xA0: "identification data template",
+		},
+	},
+}
+
+// fileControlTags names the data objects of the FCP, FMD and FCI templates.
+var fileControlTags = map[tlv.Tag]string{
+	0x80: "data size",
+	0x81: "total file size",
+	0x82: "file descriptor",
+	0x83: "file identifier",
+	0x84: "DF name",
+	0x85: "proprietary information",
+	0x86: "security attributes",
+	0x88: "short EF identifier",
+	0x8A: "life cycle status",
+	0xA5: "proprietary information",
+}
+
+// smTable names the secure messaging data objects of ISO 7816-4 section
+// 10 in the data field of commands and responses of the SM classes.
+var smTable = &InstructionTable{
+	Name: "ISO 7816-4 secure messaging",
+	Match: func(cla byte) bool {
+		switch {
+		case cla&0x80 != 0:
+			return false
+		case cla&0x40 == 0:
+			return cla&0x0C != 0
+		}
+		return cla&0x20 != 0
+	},
+	Templates: map[tlv.Tag]map[tlv.Tag]string{
+		0: {
+			0x81: "plain value",
+			0x85: "cryptogram",
+			0x87: "padding indicator and cryptogram",
+			0x8E: "cryptographic checksum",
+			0x97: "Le",
+			0x99: "processing status",
+		},
+	},
+}
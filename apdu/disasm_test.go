@@ -0,0 +1,153 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+func TestDisassembleCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		want []string
+	}{
+		{
+			name: "SELECT by DF name",
+			raw:  []byte{0x00, 0xA4, 0x04, 0x00, 0x07, 0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10, 0x00},
+			want: []string{"INS A4  SELECT", "select by DF name, first or only occurrence, return FCI", "Lc  7", "Le  256", "Case 4S"},
+		},
+		{
+			name: "READ BINARY with SFI",
+			raw:  []byte{0x0C, 0xB0, 0x81, 0x10, 0x20},
+			want: []string{"READ BINARY", "SFI 1, offset 16", "channel 0, SM header authenticated"},
+		},
+		{
+			name: "READ RECORD",
+			raw:  []byte{0x00, 0xB2, 0x02, 0x0C, 0x00},
+			want: []string{"READ RECORD", "record 2, SFI 1, record number in P1"},
+		},
+		{
+			name: "further channel",
+			raw:  []byte{0x41, 0xCA, 0x9F, 0x7F, 0x00},
+			want: []string{"channel 5", "GET DATA", "data object 9F7F"},
+		},
+		{
+			name: "GENERAL AUTHENTICATE TLV data",
+			raw:  []byte{0x10, 0x86, 0x00, 0x00, 0x04, 0x7C, 0x02, 0x81, 0x00, 0x00},
+			want: []string{"chained", "7C dynamic authentication data (2)", "      81"},
+		},
+		{
+			name: "malformed",
+			raw:  []byte{0x00, 0xA4},
+			want: []string{"malformed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DisassembleCommand(tt.raw)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("DisassembleCommand() = %s\nmissing %q", got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestDisassembleResponse(t *testing.T) {
+	raw := []byte{0x6F, 0x09, 0x84, 0x02, 0x3F, 0x00, 0xA5, 0x03, 0x88, 0x01, 0x01, 0x6A, 0x82}
+	got := DisassembleResponse(raw)
+	for _, w := range []string{"6F FCI template (9)", "    84 DF name: 3F 00", "A5 proprietary information (3)", "88 short EF identifier: 01", "6A82  file or application not found"} {
+		if !strings.Contains(got, w) {
+			t.Errorf("DisassembleResponse() = %s\nmissing %q", got, w)
+		}
+	}
+}
+
+func TestDisassemblerRegister(t *testing.T) {
+	d := NewDisassembler()
+	d.Register(&InstructionTable{
+		Name:         "test",
+		Match:        func(cla byte) bool { return cla == 0x90 },
+		Instructions: map[byte]Instruction{0x5A: {Name: "SELECT APPLICATION"}},
+		TagNames:     map[tlv.Tag]string{0xDF01: "proprietary tag"},
+	})
+	got := d.Exchange([]byte{0x90, 0x5A, 0x00, 0x00, 0x00}, []byte{0xDF, 0x01, 0x01, 0x00, 0x91, 0x00})
+	for _, w := range []string{"SELECT APPLICATION", "DF01 proprietary tag: 00"} {
+		if !strings.Contains(got, w) {
+			t.Errorf("Exchange() = %s\nmissing %q", got, w)
+		}
+	}
+	if strings.Contains(DisassembleCommand([]byte{0x90, 0x5A, 0x00, 0x00}), "SELECT APPLICATION") {
+		t.Errorf("table registered on a Disassembler leaked into the DefaultDisassembler")
+	}
+}
+
+func TestDisassemblerTemplates(t *testing.T) {
+	d := NewDisassembler()
+	d.Register(&InstructionTable{
+		Name:      "payment",
+		Match:     func(cla byte) bool { return cla&0xF0 == 0x80 },
+		Templates: map[tlv.Tag]map[tlv.Tag]string{0x77: {0x82: "application interchange profile"}},
+	})
+	d.Register(&InstructionTable{
+		Name:      "payment records",
+		Templates: map[tlv.Tag]map[tlv.Tag]string{0x70: {0x8E: "CVM list"}},
+	})
+
+	tests := []struct {
+		name      string
+		cmd, resp []byte
+		want      []string
+		not       []string
+	}{
+		{
+			name: "FCP under a proprietary class",
+			cmd:  []byte{0x80, 0xF2, 0x00, 0x00, 0x00},
+			resp: []byte{0x62, 0x03, 0x82, 0x01, 0x38, 0x77, 0x03, 0x82, 0x01, 0x00, 0x90, 0x00},
+			want: []string{"82 file descriptor: 38", "82 application interchange profile: 00"},
+		},
+		{
+			name: "dynamic authentication data",
+			cmd:  []byte{0x00, 0x86, 0x00, 0x00, 0x00},
+			resp: []byte{0x7C, 0x04, 0x81, 0x02, 0x01, 0x02, 0x90, 0x00},
+			want: []string{"81 challenge: 01 02"},
+			not:  []string{"total file size"},
+		},
+		{
+			name: "secure messaging",
+			cmd:  []byte{0x0C, 0xB0, 0x00, 0x00, 0x00},
+			resp: []byte{0x87, 0x02, 0x01, 0xAA, 0x99, 0x02, 0x90, 0x00, 0x8E, 0x01, 0xBB, 0x90, 0x00},
+			want: []string{"87 padding indicator and cryptogram", "99 processing status", "8E cryptographic checksum"},
+			not:  []string{"CVM list"},
+		},
+		{
+			name: "record template",
+			cmd:  []byte{0x00, 0xB2, 0x01, 0x0C, 0x00},
+			resp: []byte{0x70, 0x03, 0x8E, 0x01, 0x00, 0x90, 0x00},
+			want: []string{"8E CVM list"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := d.Exchange(tt.cmd, tt.resp)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("Exchange() = %s\nmissing %q", got, w)
+				}
+			}
+			for _, w := range tt.not {
+				if strings.Contains(got, w) {
+					t.Errorf("Exchange() = %s\nunexpected %q", got, w)
+				}
+			}
+		})
+	}
+}
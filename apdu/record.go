@@ -0,0 +1,174 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrReplayMismatch is returned when a replayed session receives a
+	// command different from the recorded one.
+	ErrReplayMismatch = errors.New("apdu: command does not match recording")
+	// ErrReplayExhausted is returned when all recorded exchanges have been replayed.
+	ErrReplayExhausted = errors.New("apdu: recording exhausted")
+)
+
+// HexBytes is a byte slice encoded as an upper case hex string in JSON.
+type HexBytes []byte
+
+// MarshalJSON implements json.Marshaler.
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.ToUpper(hex.EncodeToString(h)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+// Exchange is one command/response pair of a recorded session and the
+// line format written by a Recorder, one JSON object per line.
+type Exchange struct {
+	Seq      int       `json:"seq"`
+	Time     time.Time `json:"time"`
+	Reader   string    `json:"reader,omitempty"`
+	ATR      HexBytes  `json:"atr,omitempty"`
+	Command  HexBytes  `json:"command"`
+	Response HexBytes  `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Recorder is a Transmitter writing every exchange passing through it
+// to w as JSON Lines.
+type Recorder struct {
+	t      Transmitter
+	reader string
+	atr    []byte
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	seq int
+	now func() time.Time
+}
+
+// NewRecorder returns a Recorder sending through t. The reader name and
+// ATR are stored with every exchange so a trace is self-describing.
+func NewRecorder(t Transmitter, w io.Writer, reader string, atr []byte) *Recorder {
+	return &Recorder{t: t, reader: reader, atr: atr, enc: json.NewEncoder(w), now: time.Now}
+}
+
+// Transmit sends cmd and records the exchange. An error writing the
+// record is returned along with the response of the card.
+func (r *Recorder) Transmit(cmd []byte) ([]byte, error) {
+	resp, err := r.t.Transmit(cmd)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := Exchange{
+		Seq:      r.seq,
+		Time:     r.now().UTC(),
+		Reader:   r.reader,
+		ATR:      r.atr,
+		Command:  cmd,
+		Response: resp,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.seq++
+	if werr := r.enc.Encode(e); werr != nil {
+		return resp, errors.Join(err, fmt.Errorf("apdu: recording exchange %d: %w", e.Seq, werr))
+	}
+	return resp, err
+}
+
+// Replayer is a Transmitter serving a recorded session back in order.
+// Each command must match the recorded command byte for byte.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	pos       int
+}
+
+// NewReplayer reads a JSON Lines recording produced by a Recorder.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	var exchanges []Exchange
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Exchange
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("apdu: recording line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return &Replayer{exchanges: exchanges}, nil
+}
+
+// Transmit returns the recorded response of the next exchange.
+func (r *Replayer) Transmit(cmd []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pos >= len(r.exchanges) {
+		return nil, ErrReplayExhausted
+	}
+	e := r.exchanges[r.pos]
+	if !bytes.Equal(cmd, e.Command) {
+		return nil, fmt.Errorf("%w: exchange %d expected % X, got % X", ErrReplayMismatch, e.Seq, []byte(e.Command), cmd)
+	}
+	r.pos++
+	if e.Error != "" {
+		return e.Response, errors.New(e.Error)
+	}
+	return append([]byte(nil), e.Response...), nil
+}
+
+// Reader returns the reader name of the recording.
+func (r *Replayer) Reader() string {
+	if len(r.exchanges) == 0 {
+		return ""
+	}
+	return r.exchanges[0].Reader
+}
+
+// ATR returns the answer to reset stored in the recording.
+func (r *Replayer) ATR() []byte {
+	if len(r.exchanges) == 0 {
+		return nil
+	}
+	return r.exchanges[0].ATR
+}
+
+// Remaining returns the number of exchanges not replayed yet.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.exchanges) - r.pos
+}
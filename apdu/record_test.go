@@ -0,0 +1,71 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	atr := []byte{0x3B, 0x02, 0x14, 0x50}
+	card := &scriptedCard{responses: [][]byte{{0x6F, 0x00, 0x90, 0x00}, {0x6A, 0x82}}}
+
+	var trace bytes.Buffer
+	rec := NewRecorder(card, &trace, "Virtual Reader 0", atr)
+	rec.now = func() time.Time { return time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC) }
+
+	cmds := [][]byte{{0x00, 0xA4, 0x04, 0x00, 0x00}, {0x00, 0xB0, 0x00, 0x00, 0x00}}
+	var want [][]byte
+	for _, cmd := range cmds {
+		resp, err := rec.Transmit(cmd)
+		if err != nil {
+			t.Fatalf("Recorder.Transmit() error = %v", err)
+		}
+		want = append(want, resp)
+	}
+
+	first := strings.SplitN(trace.String(), "\n", 2)[0]
+	wantLine := `{"seq":0,"time":"2023-12-01T10:00:00Z","reader":"Virtual Reader 0","atr":"3B021450","command":"00A4040000","response":"6F009000"}`
+	if first != wantLine {
+		t.Errorf("recorded line = %s, want %s", first, wantLine)
+	}
+
+	rep, err := NewReplayer(&trace)
+	if err != nil {
+		t.Fatalf("NewReplayer() error = %v", err)
+	}
+	if rep.Reader() != "Virtual Reader 0" || !bytes.Equal(rep.ATR(), atr) {
+		t.Errorf("Replayer reader = %q, ATR = % X", rep.Reader(), rep.ATR())
+	}
+	for i, cmd := range cmds {
+		got, err := rep.Transmit(cmd)
+		if err != nil {
+			t.Fatalf("Replayer.Transmit() error = %v", err)
+		}
+		if !bytes.Equal(got, want[i]) {
+			t.Errorf("Replayer.Transmit() = % X, want % X", got, want[i])
+		}
+	}
+	if _, err := rep.Transmit(cmds[0]); !errors.Is(err, ErrReplayExhausted) {
+		t.Errorf("Replayer.Transmit() error = %v, want %v", err, ErrReplayExhausted)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	rep, err := NewReplayer(strings.NewReader(`{"seq":0,"command":"00A40400","response":"9000"}` + "\n"))
+	if err != nil {
+		t.Fatalf("NewReplayer() error = %v", err)
+	}
+	if _, err := rep.Transmit([]byte{0x00, 0xA4, 0x00, 0x00}); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("Replayer.Transmit() error = %v, want %v", err, ErrReplayMismatch)
+	}
+	if rep.Remaining() != 1 {
+		t.Errorf("Remaining() = %d, want 1", rep.Remaining())
+	}
+}
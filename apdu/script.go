@@ -0,0 +1,369 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrScriptSyntax is returned for a script which can not be parsed.
+var ErrScriptSyntax = errors.New("apdu: script syntax error")
+
+// Script is a parsed APDU test script. The format is line oriented, blank
+// lines are ignored and '#' starts a comment:
+//
+//	set AID A0000000031010          # define a hex variable
+//	send 00A40400 07 ${AID} 00      # send a command, starts a new step
+//	expect sw 9000 61XX             # any of the status words, X is a nibble wildcard
+//	expect data 6F * 84 07 ${AID} * # response data, ?? is any byte, * any sequence
+//	capture FCI 2 4                 # FCI = 4 response bytes at offset 2
+//
+// Expectations and captures apply to the preceding send. The length of a
+// capture may be omitted to take the rest of the response data.
+type Script struct {
+	Steps []*ScriptStep
+}
+
+// ScriptStep is a single command of a Script with its assertions.
+type ScriptStep struct {
+	Line     int
+	Vars     []ScriptVar // set before the command is sent
+	Command  string
+	SW       []string
+	Data     string
+	Captures []ScriptCapture
+}
+
+// ScriptVar is a variable assignment of a Script.
+type ScriptVar struct {
+	Name  string
+	Value string
+}
+
+// ScriptCapture copies a fragment of the response data into a variable.
+type ScriptCapture struct {
+	Name   string
+	Offset int
+	Length int // -1 for the rest of the data
+}
+
+// StepResult is the outcome of a single ScriptStep.
+type StepResult struct {
+	Line     int
+	Command  []byte
+	Response []byte
+	Failures []string
+}
+
+// Passed reports whether all assertions of the step held.
+func (r *StepResult) Passed() bool { return len(r.Failures) == 0 }
+
+// String returns a one line summary of the step.
+func (r *StepResult) String() string {
+	status := "PASS"
+	if !r.Passed() {
+		status = "FAIL: " + strings.Join(r.Failures, "; ")
+	}
+	return fmt.Sprintf("line %d: %X -> %X %s", r.Line, r.Command, r.Response, status)
+}
+
+// ScriptResult collects the step results of a script run and the final
+// value of all variables.
+type ScriptResult struct {
+	Steps []StepResult
+	Vars  map[string]string
+}
+
+// Passed reports whether every step of the run passed.
+func (r *ScriptResult) Passed() bool {
+	for i := range r.Steps {
+		if !r.Steps[i].Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+var scriptVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseScript reads a script from r.
+func ParseScript(r io.Reader) (*Script, error) {
+	var (
+		s       = &Script{}
+		step    *ScriptStep
+		pending []ScriptVar
+	)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		syntaxErr := func(format string, args ...any) error {
+			return fmt.Errorf("%w: line %d: %s", ErrScriptSyntax, line, fmt.Sprintf(format, args...))
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "set":
+			if len(fields) < 3 || !scriptVarName.MatchString(fields[1]) {
+				return nil, syntaxErr("usage: set NAME HEX")
+			}
+			pending = append(pending, ScriptVar{Name: fields[1], Value: strings.Join(fields[2:], "")})
+		case "send":
+			if len(fields) < 2 {
+				return nil, syntaxErr("send without command")
+			}
+			step = &ScriptStep{Line: line, Vars: pending, Command: strings.Join(fields[1:], "")}
+			pending = nil
+			s.Steps = append(s.Steps, step)
+		case "expect":
+			if step == nil {
+				return nil, syntaxErr("expect before the first send")
+			}
+			if len(fields) < 3 {
+				return nil, syntaxErr("usage: expect sw|data PATTERN")
+			}
+			switch strings.ToLower(fields[1]) {
+			case "sw":
+				for _, sw := range fields[2:] {
+					if !isSWPattern(sw) {
+						return nil, syntaxErr("invalid status word pattern %q", sw)
+					}
+				}
+				step.SW = append(step.SW, fields[2:]...)
+			case "data":
+				step.Data = strings.Join(fields[2:], " ")
+			default:
+				return nil, syntaxErr("unknown expectation %q", fields[1])
+			}
+		case "capture":
+			if step == nil {
+				return nil, syntaxErr("capture before the first send")
+			}
+			if len(fields) < 3 || len(fields) > 4 || !scriptVarName.MatchString(fields[1]) {
+				return nil, syntaxErr("usage: capture NAME OFFSET [LENGTH]")
+			}
+			c := ScriptCapture{Name: fields[1], Length: -1}
+			var err error
+			if c.Offset, err = strconv.Atoi(fields[2]); err != nil || c.Offset < 0 {
+				return nil, syntaxErr("invalid capture offset %q", fields[2])
+			}
+			if len(fields) == 4 {
+				if c.Length, err = strconv.Atoi(fields[3]); err != nil || c.Length < 0 {
+					return nil, syntaxErr("invalid capture length %q", fields[3])
+				}
+			}
+			step.Captures = append(step.Captures, c)
+		default:
+			return nil, syntaxErr("unknown directive %q", fields[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("%w: set after the last send", ErrScriptSyntax)
+	}
+	return s, nil
+}
+
+// Run executes the script against t. Variables in vars are available to
+// the script in addition to those it sets itself. A failing assertion is
+// recorded in the step result and the run continues; a transport error
+// stops the run and is returned along with the results so far.
+func (s *Script) Run(t Transmitter, vars map[string]string) (*ScriptResult, error) {
+	res := &ScriptResult{Vars: make(map[string]string, len(vars))}
+	for k, v := range vars {
+		res.Vars[k] = v
+	}
+
+	for _, step := range s.Steps {
+		r := StepResult{Line: step.Line}
+		for _, v := range step.Vars {
+			val, err := expandVars(v.Value, res.Vars)
+			if err != nil {
+				r.Failures = append(r.Failures, err.Error())
+				continue
+			}
+			res.Vars[v.Name] = val
+		}
+
+		cmdHex, err := expandVars(step.Command, res.Vars)
+		if err == nil {
+			r.Command, err = hex.DecodeString(cmdHex)
+		}
+		if err != nil {
+			r.Failures = append(r.Failures, fmt.Sprintf("command: %v", err))
+			res.Steps = append(res.Steps, r)
+			continue
+		}
+
+		r.Response, err = t.Transmit(r.Command)
+		if err != nil {
+			r.Failures = append(r.Failures, err.Error())
+			res.Steps = append(res.Steps, r)
+			return res, fmt.Errorf("apdu: script line %d: %w", step.Line, err)
+		}
+		resp, err := UnmarshalResponse(r.Response)
+		if err != nil {
+			r.Failures = append(r.Failures, err.Error())
+			res.Steps = append(res.Steps, r)
+			continue
+		}
+
+		if len(step.SW) > 0 && !matchAnySW(step.SW, resp.SW()) {
+			r.Failures = append(r.Failures, fmt.Sprintf("status %04X, want %s", resp.SW(), strings.Join(step.SW, " or ")))
+		}
+		if step.Data != "" {
+			pattern, err := expandVars(step.Data, res.Vars)
+			if err == nil {
+				var ok bool
+				ok, err = matchDataPattern(pattern, resp.Data)
+				if err == nil && !ok {
+					r.Failures = append(r.Failures, fmt.Sprintf("data %X does not match %s", resp.Data, pattern))
+				}
+			}
+			if err != nil {
+				r.Failures = append(r.Failures, fmt.Sprintf("data pattern: %v", err))
+			}
+		}
+		for _, c := range step.Captures {
+			end := len(resp.Data)
+			if c.Length >= 0 {
+				end = c.Offset + c.Length
+			}
+			if c.Offset > len(resp.Data) || end > len(resp.Data) {
+				r.Failures = append(r.Failures, fmt.Sprintf("capture %s: %d bytes of data too short", c.Name, len(resp.Data)))
+				continue
+			}
+			res.Vars[c.Name] = strings.ToUpper(hex.EncodeToString(resp.Data[c.Offset:end]))
+		}
+		res.Steps = append(res.Steps, r)
+	}
+	return res, nil
+}
+
+// expandVars replaces ${NAME} references with their values.
+func expandVars(s string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+		name := s[i+2 : i+j]
+		val, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("undefined variable %q", name)
+		}
+		b.WriteString(s[:i])
+		b.WriteString(val)
+		s = s[i+j+1:]
+	}
+}
+
+func isSWPattern(p string) bool {
+	if len(p) != 4 {
+		return false
+	}
+	for _, c := range p {
+		if !strings.ContainsRune("0123456789abcdefABCDEFxX", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAnySW(patterns []string, sw uint16) bool {
+	got := fmt.Sprintf("%04X", sw)
+outer:
+	for _, p := range patterns {
+		p = strings.ToUpper(p)
+		for i := 0; i < 4; i++ {
+			if p[i] != 'X' && p[i] != got[i] {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// patternToken is a single element of a data pattern.
+type patternToken struct {
+	b       byte
+	anyByte bool
+	anySeq  bool
+}
+
+func parseDataPattern(p string) ([]patternToken, error) {
+	var toks []patternToken
+	for i := 0; i < len(p); {
+		switch {
+		case p[i] == ' ' || p[i] == '\t':
+			i++
+		case p[i] == '*':
+			toks = append(toks, patternToken{anySeq: true})
+			i++
+		case strings.HasPrefix(p[i:], "??"):
+			toks = append(toks, patternToken{anyByte: true})
+			i += 2
+		case i+1 < len(p):
+			b, err := hex.DecodeString(p[i : i+2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid byte %q", p[i:i+2])
+			}
+			toks = append(toks, patternToken{b: b[0]})
+			i += 2
+		default:
+			return nil, fmt.Errorf("odd number of hex digits")
+		}
+	}
+	return toks, nil
+}
+
+// matchDataPattern reports whether data matches the pattern p.
+func matchDataPattern(p string, data []byte) (bool, error) {
+	toks, err := parseDataPattern(p)
+	if err != nil {
+		return false, err
+	}
+	return matchTokens(toks, data), nil
+}
+
+func matchTokens(toks []patternToken, data []byte) bool {
+	for len(toks) > 0 {
+		t := toks[0]
+		if t.anySeq {
+			for i := 0; i <= len(data); i++ {
+				if matchTokens(toks[1:], data[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(data) == 0 || (!t.anyByte && data[0] != t.b) {
+			return false
+		}
+		toks, data = toks[1:], data[1:]
+	}
+	return len(data) == 0
+}
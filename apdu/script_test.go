@@ -0,0 +1,100 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testScript = `
+# select the payment application
+set AID A0000000031010
+send 00A40400 07 ${AID} 00
+expect sw 9000 61XX
+expect data 6F * 84 07 ${AID} *
+capture LABEL 11 2
+
+send 80CA ${LABEL} 00   # uses the captured value
+expect sw 9000
+expect data ?? ??
+
+send 00B2010C00
+expect sw 9000
+`
+
+func TestScriptRun(t *testing.T) {
+	s, err := ParseScript(strings.NewReader(testScript))
+	if err != nil {
+		t.Fatalf("ParseScript() error = %v", err)
+	}
+	if len(s.Steps) != 3 {
+		t.Fatalf("ParseScript() parsed %d steps, want 3", len(s.Steps))
+	}
+
+	card := &scriptedCard{responses: [][]byte{
+		{0x6F, 0x0B, 0x84, 0x07, 0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10, 0x9F, 0x38, 0x90, 0x00},
+		{0x01, 0x02, 0x90, 0x00},
+		{0x6A, 0x83},
+	}}
+	res, err := s.Run(card, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Vars["LABEL"] != "9F38" {
+		t.Errorf("captured LABEL = %q, want 9F38", res.Vars["LABEL"])
+	}
+	if got := card.received[1]; string(got) != string([]byte{0x80, 0xCA, 0x9F, 0x38, 0x00}) {
+		t.Errorf("second command = % X", got)
+	}
+	for i, want := range []bool{true, true, false} {
+		if res.Steps[i].Passed() != want {
+			t.Errorf("step %d passed = %v, want %v: %s", i, res.Steps[i].Passed(), want, &res.Steps[i])
+		}
+	}
+	if res.Passed() {
+		t.Errorf("Passed() = true with a failing step")
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []string{
+		"expect sw 9000",
+		"send 00A40400\nexpect sw 90",
+		"send 00A40400\nexpect foo 9000",
+		"send 00A40400\ncapture X -1",
+		"set 1X 00",
+		"frobnicate",
+		"send 00A40400\nset X 00",
+	}
+	for _, src := range tests {
+		if _, err := ParseScript(strings.NewReader(src)); !errors.Is(err, ErrScriptSyntax) {
+			t.Errorf("ParseScript(%q) error = %v, want %v", src, err, ErrScriptSyntax)
+		}
+	}
+}
+
+func TestMatchDataPattern(t *testing.T) {
+	data := []byte{0x6F, 0x03, 0x84, 0x01, 0xAA}
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"6F038401AA", true},
+		{"6F ?? 84 * AA", true},
+		{"*", true},
+		{"* AA", true},
+		{"* BB", false},
+		{"6F03", false},
+		{"6F03 *", true},
+	}
+	for _, tt := range tests {
+		got, err := matchDataPattern(tt.pattern, data)
+		if err != nil || got != tt.want {
+			t.Errorf("matchDataPattern(%q) = %v, %v, want %v", tt.pattern, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// Category classifies a status word as described in ISO 7816-4 section 5.6.
+type Category uint8
+
+const (
+	CategoryUnknown        Category = iota // SW1 outside the interindustry ranges, e.g. proprietary 9XXX.
+	CategoryNormal                         // 9000 and 61XX, processing completed.
+	CategoryWarning                        // 62XX and 63XX, processing completed with a warning.
+	CategoryExecutionError                 // 64XX to 66XX, processing aborted during execution.
+	CategoryCheckingError                  // 67XX to 6FXX, processing aborted while checking the command.
+)
+
+// String returns a human-readable name of the category.
+func (c Category) String() string {
+	switch c {
+	case CategoryNormal:
+		return "normal processing"
+	case CategoryWarning:
+		return "warning processing"
+	case CategoryExecutionError:
+		return "execution error"
+	case CategoryCheckingError:
+		return "checking error"
+	}
+	return "unknown"
+}
+
+// CategoryOf derives the ISO 7816-4 category of a status word from SW1,
+// except for SW1 90 where only 9000 is normal processing and any other
+// SW2 is left as CategoryUnknown.
+func CategoryOf(sw1, sw2 byte) Category {
+	switch {
+	case sw1 == 0x90 && sw2 == 0x00, sw1 == 0x61:
+		return CategoryNormal
+	case sw1 == 0x62, sw1 == 0x63:
+		return CategoryWarning
+	case sw1 >= 0x64 && sw1 <= 0x66:
+		return CategoryExecutionError
+	case sw1 >= 0x67 && sw1 <= 0x6F:
+		return CategoryCheckingError
+	}
+	return CategoryUnknown
+}
+
+// StatusError is returned for any status word which does not indicate
+// normal processing. It can be matched with errors.Is against the Err*
+// sentinels of this package or against sentinels created with NewStatusError.
+type StatusError struct {
+	SW1         byte
+	SW2         byte
+	Category    Category
+	Description string
+
+	// mask selects the bits compared by Is when the error is used as a target.
+	mask uint16
+}
+
+// NewStatusError creates a status error usable as an errors.Is target.
+// Only the status word bits set in mask are compared, so a mask of 0xFFF0
+// matches a whole 63CX range. A zero mask compares the full status word.
+func NewStatusError(sw, mask uint16, category Category, description string) *StatusError {
+	return &StatusError{
+		SW1:         byte(sw >> 8),
+		SW2:         byte(sw),
+		Category:    category,
+		Description: description,
+		mask:        mask,
+	}
+}
+
+// SW returns the status word as a single 16-bit value.
+func (e *StatusError) SW() uint16 {
+	return uint16(e.SW1)<<8 | uint16(e.SW2)
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("apdu: status %04X (%s)", e.SW(), e.Category)
+	}
+	return fmt.Sprintf("apdu: status %04X: %s", e.SW(), e.Description)
+}
+
+// Is reports whether target is a *StatusError matching the status word of e.
+func (e *StatusError) Is(target error) bool {
+	t, ok := target.(*StatusError)
+	if !ok {
+		return false
+	}
+	mask := t.mask
+	if mask == 0 {
+		mask = 0xFFFF
+	}
+	return e.SW()&mask == t.SW()&mask
+}
+
+// Interindustry status words defined by ISO 7816-4.
+var (
+	ErrNoInformation              = NewStatusError(0x6200, 0, CategoryWarning, "no information given, non-volatile memory unchanged")
+	ErrDataCorrupted              = NewStatusError(0x6281, 0, CategoryWarning, "part of returned data may be corrupted")
+	ErrEndOfFile                  = NewStatusError(0x6282, 0, CategoryWarning, "end of file or record reached before reading Ne bytes")
+	ErrFileDeactivated            = NewStatusError(0x6283, 0, CategoryWarning, "selected file deactivated")
+	ErrFileTerminated             = NewStatusError(0x6285, 0, CategoryWarning, "selected file in termination state")
+	ErrVerificationFailed         = NewStatusError(0x63C0, 0xFFF0, CategoryWarning, "verification failed, counter encoded in SW2")
+	ErrExecutionError             = NewStatusError(0x6400, 0, CategoryExecutionError, "execution error, non-volatile memory unchanged")
+	ErrMemoryFailure              = NewStatusError(0x6581, 0, CategoryExecutionError, "memory failure")
+	ErrSecurityIssue              = NewStatusError(0x6600, 0xFF00, CategoryExecutionError, "security-related issue")
+	ErrWrongLength                = NewStatusError(0x6700, 0, CategoryCheckingError, "wrong length, no further indication")
+	ErrLogicalChannelNotSupported = NewStatusError(0x6881, 0, CategoryCheckingError, "logical channel not supported")
+	ErrSecureMessagingUnsupported = NewStatusError(0x6882, 0, CategoryCheckingError, "secure messaging not supported")
+	ErrLastCommandExpected        = NewStatusError(0x6883, 0, CategoryCheckingError, "last command of the chain expected")
+	ErrChainingNotSupported       = NewStatusError(0x6884, 0, CategoryCheckingError, "command chaining not supported")
+	ErrIncompatibleFileStructure  = NewStatusError(0x6981, 0, CategoryCheckingError, "command incompatible with file structure")
+	ErrSecurityStatusNotSatisfied = NewStatusError(0x6982, 0, CategoryCheckingError, "security status not satisfied")
+	ErrAuthMethodBlocked          = NewStatusError(0x6983, 0, CategoryCheckingError, "authentication method blocked")
+	ErrReferenceDataNotUsable     = NewStatusError(0x6984, 0, CategoryCheckingError, "reference data not usable")
+	ErrConditionsNotSatisfied     = NewStatusError(0x6985, 0, CategoryCheckingError, "conditions of use not satisfied")
+	ErrCommandNotAllowed          = NewStatusError(0x6986, 0, CategoryCheckingError, "command not allowed, no current EF")
+	ErrSMDataObjectsMissing       = NewStatusError(0x6987, 0, CategoryCheckingError, "expected secure messaging data objects missing")
+	ErrSMDataObjectsIncorrect     = NewStatusError(0x6988, 0, CategoryCheckingError, "incorrect secure messaging data objects")
+	ErrIncorrectData              = NewStatusError(0x6A80, 0, CategoryCheckingError, "incorrect parameters in the command data field")
+	ErrFunctionNotSupported       = NewStatusError(0x6A81, 0, CategoryCheckingError, "function not supported")
+	ErrFileNotFound               = NewStatusError(0x6A82, 0, CategoryCheckingError, "file or application not found")
+	ErrRecordNotFound             = NewStatusError(0x6A83, 0, CategoryCheckingError, "record not found")
+	ErrNotEnoughMemory            = NewStatusError(0x6A84, 0, CategoryCheckingError, "not enough memory space in the file")
+	ErrIncorrectP1P2              = NewStatusError(0x6A86, 0, CategoryCheckingError, "incorrect parameters P1-P2")
+	ErrReferenceDataNotFound      = NewStatusError(0x6A88, 0, CategoryCheckingError, "referenced data or reference data not found")
+	ErrFileExists                 = NewStatusError(0x6A89, 0, CategoryCheckingError, "file already exists")
+	ErrDFNameExists               = NewStatusError(0x6A8A, 0, CategoryCheckingError, "DF name already exists")
+	ErrWrongParameters            = NewStatusError(0x6B00, 0, CategoryCheckingError, "wrong parameters P1-P2")
+	ErrWrongLe                    = NewStatusError(0x6C00, 0xFF00, CategoryCheckingError, "wrong Le field, SW2 encodes the exact number of available data bytes")
+	ErrINSNotSupported            = NewStatusError(0x6D00, 0, CategoryCheckingError, "instruction code not supported or invalid")
+	ErrCLANotSupported            = NewStatusError(0x6E00, 0, CategoryCheckingError, "class not supported")
+	ErrNoPreciseDiagnosis         = NewStatusError(0x6F00, 0, CategoryCheckingError, "no precise diagnosis")
+)
+
+// StatusWord describes a status word, or a range of status words, known to a Registry.
+type StatusWord struct {
+	SW          uint16
+	Mask        uint16
+	Category    Category
+	Description string
+}
+
+// Registry maps status words to their category and description.
+// Applications with proprietary status words create their own registry
+// on top of DefaultRegistry so that their entries do not leak to others.
+type Registry struct {
+	parent *Registry
+
+	mu      sync.RWMutex
+	entries map[uint32]StatusWord
+	masks   []uint16 // distinct masks, most specific first
+}
+
+// DefaultRegistry holds the interindustry status words of ISO 7816-4
+// and is used by CheckStatus.
+var DefaultRegistry = NewRegistry(nil)
+
+// NewRegistry creates a registry which falls back to parent for status
+// words it does not know itself. Parent may be nil.
+func NewRegistry(parent *Registry) *Registry {
+	return &Registry{parent: parent, entries: make(map[uint32]StatusWord)}
+}
+
+// Register adds a status word to the registry. Bits cleared in mask are
+// treated as wildcards and a zero mask matches the exact status word.
+// When several entries match, the one with the most specific mask wins and
+// a later registration replaces an earlier one with the same mask.
+func (r *Registry) Register(sw StatusWord) {
+	if sw.Mask == 0 {
+		sw.Mask = 0xFFFF
+	}
+	sw.SW &= sw.Mask
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[registryKey(sw.SW, sw.Mask)] = sw
+	for _, m := range r.masks {
+		if m == sw.Mask {
+			return
+		}
+	}
+	r.masks = append(r.masks, sw.Mask)
+	sort.SliceStable(r.masks, func(i, j int) bool {
+		return bits.OnesCount16(r.masks[i]) > bits.OnesCount16(r.masks[j])
+	})
+}
+
+// Lookup returns the most specific entry matching sw.
+func (r *Registry) Lookup(sw uint16) (StatusWord, bool) {
+	for reg := r; reg != nil; reg = reg.parent {
+		reg.mu.RLock()
+		for _, m := range reg.masks {
+			if e, ok := reg.entries[registryKey(sw&m, m)]; ok {
+				reg.mu.RUnlock()
+				return e, true
+			}
+		}
+		reg.mu.RUnlock()
+	}
+	return StatusWord{}, false
+}
+
+// Check returns nil when the status word indicates normal processing
+// and a *StatusError otherwise.
+func (r *Registry) Check(sw1, sw2 byte) error {
+	sw := uint16(sw1)<<8 | uint16(sw2)
+	e, ok := r.Lookup(sw)
+	if !ok {
+		e = StatusWord{Category: CategoryOf(sw1, sw2)}
+	}
+	if e.Category == CategoryNormal {
+		return nil
+	}
+	return &StatusError{SW1: sw1, SW2: sw2, Category: e.Category, Description: e.Description}
+}
+
+// RegisterStatus adds a status word to the DefaultRegistry.
+func RegisterStatus(sw, mask uint16, category Category, description string) {
+	DefaultRegistry.Register(StatusWord{SW: sw, Mask: mask, Category: category, Description: description})
+}
+
+func registryKey(sw, mask uint16) uint32 {
+	return uint32(mask)<<16 | uint32(sw)
+}
+
+func init() {
+	RegisterStatus(0x9000, 0, CategoryNormal, "normal processing")
+	RegisterStatus(0x6100, 0xFF00, CategoryNormal, "SW2 encodes the number of data bytes still available")
+	RegisterStatus(0x6200, 0xFF00, CategoryWarning, "warning, non-volatile memory unchanged")
+	RegisterStatus(0x6300, 0xFF00, CategoryWarning, "warning, non-volatile memory changed")
+	RegisterStatus(0x6300, 0, CategoryWarning, "no information given, non-volatile memory changed")
+	RegisterStatus(0x6381, 0, CategoryWarning, "file filled up by the last write")
+	RegisterStatus(0x6400, 0xFF00, CategoryExecutionError, "execution error, non-volatile memory unchanged")
+	RegisterStatus(0x6401, 0, CategoryExecutionError, "immediate response required by the card")
+	RegisterStatus(0x6500, 0xFF00, CategoryExecutionError, "execution error, non-volatile memory changed")
+	RegisterStatus(0x6800, 0xFF00, CategoryCheckingError, "functions in CLA not supported")
+	RegisterStatus(0x6900, 0xFF00, CategoryCheckingError, "command not allowed")
+	RegisterStatus(0x6A00, 0xFF00, CategoryCheckingError, "wrong parameters P1-P2")
+	RegisterStatus(0x6A85, 0, CategoryCheckingError, "Nc inconsistent with TLV structure")
+	RegisterStatus(0x6A87, 0, CategoryCheckingError, "Nc inconsistent with parameters P1-P2")
+
+	for _, e := range []*StatusError{
+		ErrNoInformation, ErrDataCorrupted, ErrEndOfFile, ErrFileDeactivated, ErrFileTerminated,
+		ErrVerificationFailed, ErrExecutionError, ErrMemoryFailure, ErrSecurityIssue,
+		ErrWrongLength, ErrLogicalChannelNotSupported, ErrSecureMessagingUnsupported,
+		ErrLastCommandExpected, ErrChainingNotSupported, ErrIncompatibleFileStructure,
+		ErrSecurityStatusNotSatisfied, ErrAuthMethodBlocked, ErrReferenceDataNotUsable,
+		ErrConditionsNotSatisfied, ErrCommandNotAllowed, ErrSMDataObjectsMissing,
+		ErrSMDataObjectsIncorrect, ErrIncorrectData, ErrFunctionNotSupported, ErrFileNotFound,
+		ErrRecordNotFound, ErrNotEnoughMemory, ErrIncorrectP1P2, ErrReferenceDataNotFound,
+		ErrFileExists, ErrDFNameExists, ErrWrongParameters, ErrWrongLe, ErrINSNotSupported,
+		ErrCLANotSupported, ErrNoPreciseDiagnosis,
+	} {
+		RegisterStatus(e.SW(), e.mask, e.Category, e.Description)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		sw1, sw2 byte
+		ok       bool
+		target   error
+		category Category
+	}{
+		{name: "9000", sw1: 0x90, sw2: 0x00, ok: true},
+		{name: "61XX", sw1: 0x61, sw2: 0x10, ok: true},
+		{name: "file not found", sw1: 0x6A, sw2: 0x82, target: ErrFileNotFound, category: CategoryCheckingError},
+		{name: "security status", sw1: 0x69, sw2: 0x82, target: ErrSecurityStatusNotSatisfied, category: CategoryCheckingError},
+		{name: "verification failed", sw1: 0x63, sw2: 0xC2, target: ErrVerificationFailed, category: CategoryWarning},
+		{name: "wrong Le", sw1: 0x6C, sw2: 0x08, target: ErrWrongLe, category: CategoryCheckingError},
+		{name: "memory failure", sw1: 0x65, sw2: 0x81, target: ErrMemoryFailure, category: CategoryExecutionError},
+		{name: "unregistered 69XX", sw1: 0x69, sw2: 0x99, category: CategoryCheckingError},
+		{name: "proprietary", sw1: 0x91, sw2: 0xAE, category: CategoryUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckStatus(tt.sw1, tt.sw2)
+			if tt.ok {
+				if err != nil {
+					t.Errorf("CheckStatus() = %v, want nil", err)
+				}
+				return
+			}
+			var se *StatusError
+			if !errors.As(err, &se) {
+				t.Fatalf("CheckStatus() = %v, want *StatusError", err)
+			}
+			if se.SW1 != tt.sw1 || se.SW2 != tt.sw2 || se.Category != tt.category {
+				t.Errorf("CheckStatus() = %04X %s, want %02X%02X %s", se.SW(), se.Category, tt.sw1, tt.sw2, tt.category)
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.target)
+			}
+			if errors.Is(err, ErrWrongLength) {
+				t.Errorf("errors.Is(%v, %v) = true", err, ErrWrongLength)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	desfire := NewRegistry(DefaultRegistry)
+	desfire.Register(StatusWord{SW: 0x9100, Category: CategoryNormal, Description: "operation ok"})
+	desfire.Register(StatusWord{SW: 0x91AE, Category: CategoryExecutionError, Description: "authentication error"})
+
+	if err := desfire.Check(0x91, 0x00); err != nil {
+		t.Errorf("Check(9100) = %v, want nil", err)
+	}
+	err := desfire.Check(0x91, 0xAE)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Description != "authentication error" {
+		t.Errorf("Check(91AE) = %v, want authentication error", err)
+	}
+	if !errors.Is(desfire.Check(0x6A, 0x82), ErrFileNotFound) {
+		t.Errorf("Check(6A82) does not fall back to the parent registry")
+	}
+	if err := CheckStatus(0x91, 0x00); err == nil {
+		t.Errorf("DefaultRegistry knows 9100 registered on a child registry")
+	}
+
+	e, ok := DefaultRegistry.Lookup(0x63C3)
+	if !ok || e.Mask != 0xFFF0 {
+		t.Errorf("Lookup(63C3) = %+v, %v, want the 63CX entry", e, ok)
+	}
+}
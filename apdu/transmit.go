@@ -0,0 +1,110 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// InsGetResponse is the instruction byte of GET RESPONSE.
+	InsGetResponse = 0xC0
+
+	// DefaultMaxIterations bounds the number of exchanges an AutoTransmitter
+	// performs for a single command, enough to collect 64 KiB in 256 byte parts.
+	DefaultMaxIterations = 258
+)
+
+// ErrTooManyIterations is returned when a card keeps answering 61XX or 6CXX
+// beyond the iteration limit of an AutoTransmitter.
+var ErrTooManyIterations = errors.New("apdu: too many response iterations")
+
+// Transmitter sends a raw command APDU to a card and returns the raw
+// response APDU including the status words. It is implemented by
+// pscs.Card and cardreader.Reader.
+type Transmitter interface {
+	Transmit(cmd []byte) ([]byte, error)
+}
+
+// TransmitFunc adapts an ordinary function to the Transmitter interface.
+type TransmitFunc func(cmd []byte) ([]byte, error)
+
+// Transmit calls f(cmd).
+func (f TransmitFunc) Transmit(cmd []byte) ([]byte, error) { return f(cmd) }
+
+// AutoTransmitter wraps a Transmitter and transparently handles the
+// transport level status words: 61XX is answered with GET RESPONSE and the
+// response data is accumulated, 6CXX causes the command to be resent
+// with the Le announced by the card.
+type AutoTransmitter struct {
+	t             Transmitter
+	maxIterations int
+}
+
+// NewAutoTransmitter returns an AutoTransmitter sending through t. A
+// maxIterations of zero or less selects DefaultMaxIterations.
+func NewAutoTransmitter(t Transmitter, maxIterations int) *AutoTransmitter {
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+	return &AutoTransmitter{t: t, maxIterations: maxIterations}
+}
+
+// Transmit sends cmd and returns the complete response.
+func (a *AutoTransmitter) Transmit(cmd []byte) ([]byte, error) {
+	var data []byte
+	for i := 0; i < a.maxIterations; i++ {
+		resp, err := a.t.Transmit(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) < 2 {
+			return nil, fmt.Errorf("%w: %d bytes is too short to contain status words", ErrInvalidResponse, len(resp))
+		}
+		n := len(resp) - 2
+		sw1, sw2 := resp[n], resp[n+1]
+
+		switch sw1 {
+		case 0x6C:
+			next, err := withNe(cmd, int(sw2))
+			if err != nil {
+				// Not a command we can correct, let the caller see the status.
+				return append(data, resp...), nil
+			}
+			cmd = next
+		case 0x61:
+			data = append(data, resp[:n]...)
+			cmd, _ = MarshalCommand(&Command{
+				CLA: getResponseCLA(cmd),
+				INS: InsGetResponse,
+				Ne:  decodeShortLe(sw2),
+			})
+		default:
+			return append(data, resp...), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: gave up after %d exchanges", ErrTooManyIterations, a.maxIterations)
+}
+
+// withNe returns the raw command re-encoded with the Ne announced in 6CXX.
+func withNe(raw []byte, sw2 int) ([]byte, error) {
+	cmd, err := UnmarshalCommand(raw)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Ne = decodeShortLe(byte(sw2))
+	return MarshalCommand(cmd)
+}
+
+// getResponseCLA derives the class byte of a GET RESPONSE from the command
+// it follows, keeping the logical channel and secure messaging indication
+// but never the command chaining bit.
+func getResponseCLA(raw []byte) byte {
+	if len(raw) == 0 {
+		return 0x00
+	}
+	return raw[0] &^ 0x10
+}
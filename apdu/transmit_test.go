@@ -0,0 +1,120 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package apdu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// scriptedCard answers each command with the next response in order and
+// records what it received.
+type scriptedCard struct {
+	responses [][]byte
+	received  [][]byte
+}
+
+func (c *scriptedCard) Transmit(cmd []byte) ([]byte, error) {
+	c.received = append(c.received, append([]byte(nil), cmd...))
+	if len(c.responses) == 0 {
+		return []byte{0x6F, 0x00}, nil
+	}
+	resp := c.responses[0]
+	c.responses = c.responses[1:]
+	return resp, nil
+}
+
+func TestAutoTransmitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmd       []byte
+		responses [][]byte
+		want      []byte
+		sent      [][]byte
+	}{
+		{
+			name:      "pass through",
+			cmd:       []byte{0x00, 0xA4, 0x04, 0x00},
+			responses: [][]byte{{0x90, 0x00}},
+			want:      []byte{0x90, 0x00},
+			sent:      [][]byte{{0x00, 0xA4, 0x04, 0x00}},
+		},
+		{
+			name: "get response chain",
+			cmd:  []byte{0x01, 0xA4, 0x04, 0x00, 0x01, 0xA0},
+			responses: [][]byte{
+				{0x61, 0x02},
+				{0x6F, 0x01, 0x61, 0x01},
+				{0x02, 0x90, 0x00},
+			},
+			want: []byte{0x6F, 0x01, 0x02, 0x90, 0x00},
+			sent: [][]byte{
+				{0x01, 0xA4, 0x04, 0x00, 0x01, 0xA0},
+				{0x01, 0xC0, 0x00, 0x00, 0x02},
+				{0x01, 0xC0, 0x00, 0x00, 0x01},
+			},
+		},
+		{
+			name: "wrong Le",
+			cmd:  []byte{0x00, 0xB0, 0x00, 0x00, 0x00},
+			responses: [][]byte{
+				{0x6C, 0x03},
+				{0x01, 0x02, 0x03, 0x90, 0x00},
+			},
+			want: []byte{0x01, 0x02, 0x03, 0x90, 0x00},
+			sent: [][]byte{
+				{0x00, 0xB0, 0x00, 0x00, 0x00},
+				{0x00, 0xB0, 0x00, 0x00, 0x03},
+			},
+		},
+		{
+			name: "wrong Le on get response",
+			cmd:  []byte{0x00, 0xCA, 0x9F, 0x7F, 0x00},
+			responses: [][]byte{
+				{0x61, 0x00},
+				{0x6C, 0x02},
+				{0xAA, 0xBB, 0x62, 0x82},
+			},
+			want: []byte{0xAA, 0xBB, 0x62, 0x82},
+			sent: [][]byte{
+				{0x00, 0xCA, 0x9F, 0x7F, 0x00},
+				{0x00, 0xC0, 0x00, 0x00, 0x00},
+				{0x00, 0xC0, 0x00, 0x00, 0x02},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := &scriptedCard{responses: tt.responses}
+			got, err := NewAutoTransmitter(card, 0).Transmit(tt.cmd)
+			if err != nil {
+				t.Fatalf("Transmit() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Transmit() = % X, want % X", got, tt.want)
+			}
+			if len(card.received) != len(tt.sent) {
+				t.Fatalf("card received %d commands, want %d", len(card.received), len(tt.sent))
+			}
+			for i := range tt.sent {
+				if !bytes.Equal(card.received[i], tt.sent[i]) {
+					t.Errorf("command %d = % X, want % X", i, card.received[i], tt.sent[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAutoTransmitterLoop(t *testing.T) {
+	looping := TransmitFunc(func(cmd []byte) ([]byte, error) {
+		return []byte{0x61, 0x01}, nil
+	})
+	_, err := NewAutoTransmitter(looping, 5).Transmit([]byte{0x00, 0xB0, 0x00, 0x00, 0x00})
+	if !errors.Is(err, ErrTooManyIterations) {
+		t.Errorf("Transmit() error = %v, want %v", err, ErrTooManyIterations)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package emv
+
+import "github.com/happy-sdk/scardkit/protocols/iso7816"
+
+func init() {
+	iso7816.RegisterDictionary(dataObjects)
+}
+
+// dataObjects are the EMV data objects read with GET DATA. EMV sends the
+// command in the proprietary class 80, set as the CLA of the Card.
+var dataObjects = &iso7816.Dictionary{
+	Name: "emv",
+	Objects: map[string]iso7816.DataObject{
+		"atc":             {Tag: 0x9F36, Description: "application transaction counter"},
+		"last-online-atc": {Tag: 0x9F13, Description: "last online ATC register"},
+		"pin-try-counter": {Tag: 0x9F17, Description: "PIN try counter"},
+		"log-format":      {Tag: 0x9F4F, Description: "log format"},
+	},
+}
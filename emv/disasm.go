@@ -0,0 +1,126 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package emv
+
+import (
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+func init() {
+	apdu.RegisterInstructions(interindustryTags)
+	apdu.RegisterInstructions(instructions)
+}
+
+// instructions are the EMV commands using the proprietary 8X classes.
+var instructions = &apdu.InstructionTable{
+	Name:  "EMV",
+	Match: func(cla byte) bool { return cla&0xF0 == 0x80 },
+	Instructions: map[byte]apdu.Instruction{
+		0x16: {Name: "CARD BLOCK"},
+		0x18: {Name: "APPLICATION UNBLOCK"},
+		0x1E: {Name: "APPLICATION BLOCK"},
+		0x24: {Name: "PIN CHANGE/UNBLOCK", Params: pinChangeParams},
+		0xA8: {Name: "GET PROCESSING OPTIONS", TLVData: true},
+		0xAE: {Name: "GENERATE APPLICATION CRYPTOGRAM", Params: generateACParams},
+		0xCA: {Name: "GET DATA", Params: func(p1, p2 byte) string {
+			return fmt.Sprintf("data object %02X%02X", p1, p2)
+		}},
+	},
+	TagNames: map[tlv.Tag]string{
+		0x77:   "response message template format 2",
+		0x9F10: "issuer application data",
+		0x9F13: "last online ATC register",
+		0x9F17: "PIN try counter",
+		0x9F26: "application cryptogram",
+		0x9F27: "cryptogram information data",
+		0x9F36: "application transaction counter",
+		0x9F4B: "signed dynamic application data",
+		0x9F4F: "log format",
+	},
+	Templates: map[tlv.Tag]map[tlv.Tag]string{
+		0: {
+			0x80: "response message template format 1",
+			0x83: "command template",
+		},
+		0x77: {
+			0x82: "application interchange profile",
+			0x94: "application file locator",
+		},
+	},
+}
+
+// interindustryTags names EMV data objects returned by interindustry
+// commands such as SELECT and READ RECORD. Context-specific tags are
+// named only inside the EMV templates, since secure messaging and the
+// file control information use them for other data objects.
+var interindustryTags = &apdu.InstructionTable{
+	Name: "EMV data objects",
+	TagNames: map[tlv.Tag]string{
+		0x57:   "track 2 equivalent data",
+		0x5A:   "application PAN",
+		0x5F20: "cardholder name",
+		0x5F24: "application expiration date",
+		0x5F25: "application effective date",
+		0x5F28: "issuer country code",
+		0x5F34: "application PAN sequence number",
+		0x61:   "application template",
+		0x70:   "READ RECORD response message template",
+		0x9F07: "application usage control",
+		0x9F08: "application version number",
+		0x9F12: "application preferred name",
+		0x9F32: "issuer public key exponent",
+		0x9F38: "PDOL",
+		0x9F46: "ICC public key certificate",
+		0x9F4A: "static data authentication tag list",
+		0xBF0C: "FCI issuer discretionary data",
+	},
+	Templates: map[tlv.Tag]map[tlv.Tag]string{
+		0x70: {
+			0x8C: "CDOL1",
+			0x8D: "CDOL2",
+			0x8E: "CVM list",
+			0x8F: "certification authority public key index",
+			0x90: "issuer public key certificate",
+		},
+		0x61: {0x87: "application priority indicator"},
+		0xA5: {
+			0x87: "application priority indicator",
+			0x88: "SFI of the directory elementary file",
+		},
+	},
+}
+
+func pinChangeParams(p1, p2 byte) string {
+	switch p2 {
+	case 0x00:
+		return "unblock PIN"
+	case 0x01:
+		return "change PIN, enciphered with the current PIN"
+	case 0x02:
+		return "change PIN, enciphered"
+	}
+	return "unknown function"
+}
+
+func generateACParams(p1, p2 byte) string {
+	var s string
+	switch p1 & 0xC0 {
+	case 0x00:
+		s = "AAC"
+	case 0x40:
+		s = "TC"
+	case 0x80:
+		s = "ARQC"
+	default:
+		s = "RFU"
+	}
+	if p1&0x10 != 0 {
+		s += ", CDA signature requested"
+	}
+	return s
+}
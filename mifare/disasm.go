@@ -0,0 +1,50 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package mifare
+
+import (
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+func init() {
+	apdu.RegisterInstructions(instructions)
+}
+
+// instructions are the PC/SC part 3 storage card commands used to access
+// MIFARE cards through a contactless reader.
+var instructions = &apdu.InstructionTable{
+	Name:  "PC/SC storage card",
+	Match: func(cla byte) bool { return cla == 0xFF },
+	Instructions: map[byte]apdu.Instruction{
+		0x82: {Name: "LOAD KEYS", Params: func(p1, p2 byte) string {
+			loc := "volatile"
+			if p1&0x20 != 0 {
+				loc = "non-volatile"
+			}
+			return fmt.Sprintf("%s key number %d", loc, p2)
+		}},
+		0x86: {Name: "GENERAL AUTHENTICATE"},
+		0x88: {Name: "AUTHENTICATE", Params: func(p1, p2 byte) string {
+			return fmt.Sprintf("block %d", p2)
+		}},
+		0xB0: {Name: "READ BINARY", Params: blockParams},
+		0xCA: {Name: "GET DATA", Params: func(p1, p2 byte) string {
+			switch p1 {
+			case 0x00:
+				return "UID"
+			case 0x01:
+				return "historical bytes of the ATS"
+			}
+			return "unknown data"
+		}},
+		0xD6: {Name: "UPDATE BINARY", Params: blockParams},
+	},
+}
+
+func blockParams(p1, p2 byte) string {
+	return fmt.Sprintf("block %d", int(p1)<<8|int(p2))
+}
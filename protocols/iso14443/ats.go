@@ -0,0 +1,256 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+const (
+	// CmdRATS requests the answer to select of a Type A PICC.
+	CmdRATS byte = 0xE0
+	// CmdPPS is the high nibble of PPSS, the CID in the low nibble.
+	CmdPPS byte = 0xD0
+)
+
+// MaxCID is the largest card identifier.
+const MaxCID = 14
+
+// frameSizes maps FSCI and FSDI codes to frame sizes in bytes.
+var frameSizes = []int{16, 24, 32, 40, 48, 64, 96, 128, 256, 512, 1024, 2048, 4096}
+
+// FrameSize returns the frame size coded by an FSCI or FSDI. Codes above
+// the table are RFU and read as 256 bytes.
+func FrameSize(code byte) int {
+	if int(code) >= len(frameSizes) {
+		return 256
+	}
+	return frameSizes[code]
+}
+
+// FrameSizeCode returns the largest FSCI or FSDI whose frame size does
+// not exceed size, at least 0 for 16 bytes.
+func FrameSizeCode(size int) byte {
+	var code byte
+	for i, n := range frameSizes {
+		if n <= size {
+			code = byte(i)
+		}
+	}
+	return code
+}
+
+// BitRate is a bit rate coded as DSI or DRI, a divisor of 2 to the power
+// of the code applied to 106 kbit/s.
+type BitRate uint8
+
+const (
+	BitRate106 BitRate = iota
+	BitRate212
+	BitRate424
+	BitRate848
+)
+
+// String returns the bit rate in kbit/s.
+func (r BitRate) String() string {
+	return fmt.Sprintf("%d kbit/s", 106<<r)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r BitRate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (r *BitRate) UnmarshalText(text []byte) error {
+	for v := BitRate106; v <= BitRate848; v++ {
+		if string(text) == v.String() {
+			*r = v
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: bit rate %q", ErrProtocol, text)
+}
+
+// ATS is the answer to select of a Type A PICC. Interface bytes which
+// are absent hold their default values.
+type ATS struct {
+	// FSCI codes the largest frame the PICC accepts.
+	FSCI byte
+	// TA codes the supported bit rates, 00 for 106 kbit/s only.
+	TA byte
+	// FWI codes the frame waiting time, SFGI the start-up frame guard time.
+	FWI  byte
+	SFGI byte
+	// CID and NAD report whether the PICC supports them.
+	CID bool
+	NAD bool
+	// Historical holds the historical bytes.
+	Historical []byte
+
+	raw []byte
+}
+
+// ParseATS decodes an ATS without its CRC.
+func ParseATS(data []byte) (*ATS, error) {
+	if len(data) == 0 || int(data[0]) != len(data) {
+		return nil, fmt.Errorf("%w: ATS of %d bytes with TL % X", ErrProtocol, len(data), data[:min(len(data), 1)])
+	}
+	a := &ATS{FSCI: 2, FWI: 4, CID: true, raw: bytes.Clone(data)}
+	if len(data) == 1 {
+		return a, nil
+	}
+	t0 := data[1]
+	if t0&0x80 != 0 {
+		return nil, fmt.Errorf("%w: T0 %02X", ErrProtocol, t0)
+	}
+	a.FSCI = t0 & 0x0F
+	rest := data[2:]
+	for _, mask := range []byte{0x10, 0x20, 0x40} {
+		if t0&mask == 0 {
+			continue
+		}
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("%w: ATS interface bytes missing", ErrProtocol)
+		}
+		switch mask {
+		case 0x10:
+			a.TA = rest[0]
+		case 0x20:
+			a.FWI, a.SFGI = rest[0]>>4, rest[0]&0x0F
+		case 0x40:
+			a.CID, a.NAD = rest[0]&0x02 != 0, rest[0]&0x01 != 0
+		}
+		rest = rest[1:]
+	}
+	a.Historical = bytes.Clone(rest)
+	return a, nil
+}
+
+// Bytes returns the ATS as received without CRC, or encoded with all
+// interface bytes for an ATS built by hand.
+func (a *ATS) Bytes() []byte {
+	if a.raw != nil {
+		return bytes.Clone(a.raw)
+	}
+	var nad byte
+	if a.NAD {
+		nad = 0x01
+	}
+	if a.CID {
+		nad |= 0x02
+	}
+	out := []byte{0, 0x70 | a.FSCI&0x0F, a.TA, a.FWI<<4 | a.SFGI&0x0F, nad}
+	out = append(out, a.Historical...)
+	out[0] = byte(len(out))
+	return out
+}
+
+// FSC returns the largest frame size the PICC accepts.
+func (a *ATS) FSC() int {
+	return FrameSize(a.FSCI)
+}
+
+// fcUnit returns 2^exp times 256·16/fc, the unit of the ISO 14443 frame
+// timings, with fc the 13.56 MHz carrier.
+func fcUnit(exp byte) time.Duration {
+	return time.Duration(int64(4096) << exp * int64(time.Second) / 13_560_000)
+}
+
+// FWT returns the frame waiting time. The RFU FWI 15 is read as 4.
+func (a *ATS) FWT() time.Duration {
+	if a.FWI == 15 {
+		return fcUnit(4)
+	}
+	return fcUnit(a.FWI)
+}
+
+// SFGT returns the start-up frame guard time the PCD waits after the
+// ATS, zero when not required.
+func (a *ATS) SFGT() time.Duration {
+	if a.SFGI == 0 || a.SFGI == 15 {
+		return 0
+	}
+	return fcUnit(a.SFGI)
+}
+
+// SameBitRate reports whether the PICC requires the same bit rate in
+// both directions.
+func (a *ATS) SameBitRate() bool {
+	return a.TA&0x80 != 0
+}
+
+// SupportsDS reports whether the PICC can send at bit rate r.
+func (a *ATS) SupportsDS(r BitRate) bool {
+	return r == BitRate106 || r <= BitRate848 && a.TA&(0x10<<(r-1)) != 0
+}
+
+// SupportsDR reports whether the PICC can receive at bit rate r.
+func (a *ATS) SupportsDR(r BitRate) bool {
+	return r == BitRate106 || r <= BitRate848 && a.TA&(0x01<<(r-1)) != 0
+}
+
+// RATS requests the ATS of the selected Type A PICC, announcing the
+// frame size fsd of the PCD and assigning it the logical card identifier cid.
+func RATS(t Transceiver, fsd int, cid byte) (*ATS, error) {
+	if cid > MaxCID {
+		return nil, fmt.Errorf("%w: CID %d", ErrProtocol, cid)
+	}
+	frame := appendCRCA([]byte{CmdRATS, FrameSizeCode(fsd)<<4 | cid})
+	resp, bits, err := t.Transceive(frame, 8*len(frame))
+	if err != nil {
+		return nil, err
+	}
+	if bits%8 != 0 || bits/8 < 3 || bits/8 > len(resp) {
+		return nil, fmt.Errorf("%w: ATS frame of %d bits", ErrProtocol, bits)
+	}
+	resp = resp[:bits/8]
+	n := len(resp) - 2
+	if !VerifyCRCA(resp[:n], resp[n:]) {
+		return nil, fmt.Errorf("%w: ATS CRC error", ErrProtocol)
+	}
+	return ParseATS(resp[:n])
+}
+
+// PPS sets the bit rates of the PICC card with the card identifier cid:
+// ds from PICC to PCD and dr from PCD to PICC. They are checked against
+// the ATS of card and recorded on it; the PCD switches its own bit rates
+// after PPS succeeded.
+func PPS(t Transceiver, card *Card, cid byte, ds, dr BitRate) error {
+	if cid > MaxCID || ds > BitRate848 || dr > BitRate848 {
+		return fmt.Errorf("%w: PPS for CID %d, DSI %d, DRI %d", ErrProtocol, cid, ds, dr)
+	}
+	if a := card.ATS; a != nil && (!a.SupportsDS(ds) || !a.SupportsDR(dr) || a.SameBitRate() && ds != dr) {
+		return fmt.Errorf("%w: bit rates %s and %s not supported by TA %02X", ErrProtocol, ds, dr, a.TA)
+	}
+	ppss := CmdPPS | cid
+	frame := appendCRCA([]byte{ppss, 0x11, byte(ds)<<2 | byte(dr)})
+	resp, bits, err := t.Transceive(frame, 8*len(frame))
+	if err != nil {
+		return err
+	}
+	if bits != 24 || len(resp) < 3 || resp[0] != ppss || !VerifyCRCA(resp[:1], resp[1:3]) {
+		return fmt.Errorf("%w: invalid PPS response % X", ErrProtocol, resp)
+	}
+	card.DS, card.DR = ds, dr
+	return nil
+}
+
+// ActivateISODEP sends RATS to the selected PICC card, stores the ATS on
+// it and returns an ISO-DEP engine set up from it. A cid above zero is
+// sent in every block when the PICC supports CID.
+func ActivateISODEP(t Transceiver, card *Card, fsd int, cid byte) (*ISODEP, error) {
+	ats, err := RATS(t, fsd, cid)
+	if err != nil {
+		return nil, err
+	}
+	card.ATS = ats
+	d := NewISODEP(t, ats.FSC())
+	d.FSD = FrameSize(FrameSizeCode(fsd))
+	d.CID, d.UseCID = cid, ats.CID && cid > 0
+	return d, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// transceiverFunc adapts a function to the Transceiver interface.
+type transceiverFunc func(data []byte, bits int) ([]byte, int, error)
+
+func (f transceiverFunc) Transceive(data []byte, bits int) ([]byte, int, error) {
+	return f(data, bits)
+}
+
+func TestParseATS(t *testing.T) {
+	tests := []struct {
+		name string
+		ats  []byte
+		want ATS
+		fsc  int
+		fwt  time.Duration
+	}{
+		{
+			name: "DESFire",
+			ats:  []byte{0x06, 0x75, 0x77, 0x81, 0x02, 0x80},
+			want: ATS{FSCI: 5, TA: 0x77, FWI: 8, SFGI: 1, CID: true, Historical: []byte{0x80}},
+			fsc:  64,
+			fwt:  77328613 * time.Nanosecond,
+		},
+		{
+			name: "only TC",
+			ats:  []byte{0x05, 0x48, 0x01, 0x31, 0x32},
+			want: ATS{FSCI: 8, FWI: 4, NAD: true, Historical: []byte{0x31, 0x32}},
+			fsc:  256,
+			fwt:  4833038 * time.Nanosecond,
+		},
+		{
+			name: "TL only",
+			ats:  []byte{0x01},
+			want: ATS{FSCI: 2, FWI: 4, CID: true},
+			fsc:  32,
+			fwt:  4833038 * time.Nanosecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseATS(tt.ats)
+			if err != nil {
+				t.Fatalf("ParseATS() error = %v", err)
+			}
+			if got.FSCI != tt.want.FSCI || got.TA != tt.want.TA || got.FWI != tt.want.FWI || got.SFGI != tt.want.SFGI ||
+				got.CID != tt.want.CID || got.NAD != tt.want.NAD || !bytes.Equal(got.Historical, tt.want.Historical) {
+				t.Errorf("ParseATS() = %+v, want %+v", got, tt.want)
+			}
+			if got.FSC() != tt.fsc || got.FWT() != tt.fwt {
+				t.Errorf("FSC() = %d, FWT() = %v, want %d, %v", got.FSC(), got.FWT(), tt.fsc, tt.fwt)
+			}
+			if !bytes.Equal(got.Bytes(), tt.ats) {
+				t.Errorf("Bytes() = % X", got.Bytes())
+			}
+		})
+	}
+	for _, ats := range [][]byte{nil, {0x03, 0x78}, {0x02, 0x80}, {0x03, 0x70, 0x00}} {
+		if _, err := ParseATS(ats); !errors.Is(err, ErrProtocol) {
+			t.Errorf("ParseATS(% X) error = %v", ats, err)
+		}
+	}
+}
+
+func TestATSBitRates(t *testing.T) {
+	a := &ATS{TA: 0x91}
+	tests := []struct {
+		r      BitRate
+		ds, dr bool
+	}{
+		{BitRate106, true, true},
+		{BitRate212, true, true},
+		{BitRate424, false, false},
+		{BitRate848, false, false},
+	}
+	for _, tt := range tests {
+		if a.SupportsDS(tt.r) != tt.ds || a.SupportsDR(tt.r) != tt.dr {
+			t.Errorf("TA 91 supports %s: DS %v, DR %v", tt.r, a.SupportsDS(tt.r), a.SupportsDR(tt.r))
+		}
+	}
+	if !a.SameBitRate() {
+		t.Error("SameBitRate() = false")
+	}
+	if a.SFGT() != 0 || (&ATS{SFGI: 1}).SFGT() != 604129*time.Nanosecond {
+		t.Errorf("SFGT() = %v", (&ATS{SFGI: 1}).SFGT())
+	}
+}
+
+func TestFrameSize(t *testing.T) {
+	for _, tt := range []struct {
+		size int
+		code byte
+	}{{16, 0}, {10, 0}, {32, 2}, {100, 6}, {256, 8}, {300, 8}, {4096, 12}} {
+		if got := FrameSizeCode(tt.size); got != tt.code {
+			t.Errorf("FrameSizeCode(%d) = %d, want %d", tt.size, got, tt.code)
+		}
+	}
+	if FrameSize(13) != 256 {
+		t.Errorf("FrameSize(RFU) = %d", FrameSize(13))
+	}
+}
+
+func TestActivateISODEP(t *testing.T) {
+	ats := []byte{0x06, 0x75, 0x77, 0x81, 0x02, 0x80}
+	var sent [][]byte
+	field := transceiverFunc(func(data []byte, bits int) ([]byte, int, error) {
+		sent = append(sent, append([]byte(nil), data...))
+		switch data[0] {
+		case CmdRATS:
+			resp := appendCRCA(append([]byte(nil), ats...))
+			return resp, 8 * len(resp), nil
+		case CmdPPS | 0x01:
+			resp := appendCRCA([]byte{data[0]})
+			return resp, 24, nil
+		}
+		return nil, 0, ErrNoResponse
+	})
+	card := &Card{UID: []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}, ATQA: ATQA{0x44, 0x03}, SAK: SAKISODEP}
+	d, err := ActivateISODEP(field, card, 256, 1)
+	if err != nil {
+		t.Fatalf("ActivateISODEP() error = %v", err)
+	}
+	if !bytes.Equal(sent[0], appendCRCA([]byte{0xE0, 0x81})) {
+		t.Errorf("RATS = % X", sent[0])
+	}
+	if d.FSC != 64 || d.FSD != 256 || !d.UseCID || d.CID != 1 {
+		t.Errorf("ISODEP FSC %d, FSD %d, CID %v %d", d.FSC, d.FSD, d.UseCID, d.CID)
+	}
+
+	if err := PPS(field, card, 1, BitRate424, BitRate848); err != nil {
+		t.Fatalf("PPS() error = %v", err)
+	}
+	if !bytes.Equal(sent[1], appendCRCA([]byte{0xD1, 0x11, 0x0B})) {
+		t.Errorf("PPS = % X", sent[1])
+	}
+	if err := PPS(field, &Card{ATS: &ATS{TA: 0x11}}, 1, BitRate424, BitRate106); !errors.Is(err, ErrProtocol) {
+		t.Errorf("PPS() of an unsupported bit rate error = %v", err)
+	}
+
+	raw, err := card.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["uid"] != "04112233445566" || fields["ds"] != "424 kbit/s" || fields["ats"].(map[string]any)["fwt"] != "77.328613ms" {
+		t.Errorf("Marshal() = %s", raw)
+	}
+	back, err := UnmarshalCard(raw)
+	if err != nil {
+		t.Fatalf("UnmarshalCard() error = %v", err)
+	}
+	if !bytes.Equal(back.UID, card.UID) || back.ATQA != card.ATQA || back.SAK != card.SAK ||
+		back.DS != BitRate424 || back.DR != BitRate848 || !bytes.Equal(back.ATS.Bytes(), ats) {
+		t.Errorf("UnmarshalCard() = %+v", back)
+	}
+}
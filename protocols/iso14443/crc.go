@@ -4,30 +4,139 @@
 
 package iso14443
 
-import "bytes"
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
 
-// CalculateCRCA calculates the CRC-A checksum for a given slice of data.
-// This function implements the CRC-A algorithm used in ISO/IEC 14443 Type A
-// standard, suitable for NFC communication. The function returns a 2-byte slice
-// containing the CRC in little-endian format.
-func CalculateCRCA(data []byte) []byte {
-	poly := uint16(0x1021)
-	crc := uint16(0xC6C6)
+// Hash16 is the common interface of the 16-bit CRCs. Sum appends the
+// CRC in the byte order in which it is transmitted, Sum16 returns its
+// value.
+type Hash16 interface {
+	hash.Hash
+	Sum16() uint16
+}
 
-	for _, b := range data {
-		curByte := reflectByte(uint16(b))
-		crc ^= curByte << 8
-		for i := 0; i < 8; i++ {
-			if crc&0x8000 != 0 {
-				crc = (crc << 1) ^ poly
-			} else {
-				crc = crc << 1
+// crc16 describes a 16-bit CRC with its lookup table.
+type crc16 struct {
+	table     [256]uint16
+	init      uint16
+	xorOut    uint16
+	reflected bool
+	bigEndian bool
+}
+
+var (
+	// crcA is CRC_A of ISO/IEC 14443-3, the reflected CCITT polynomial
+	// with initial value 6363.
+	crcA = newCRC16(0x1021, 0x6363, 0x0000, true, false)
+	// crcB is CRC_B of ISO/IEC 14443-3 and ISO/IEC 13239, the reflected
+	// CCITT polynomial with initial value FFFF, complemented.
+	crcB = newCRC16(0x1021, 0xFFFF, 0xFFFF, true, false)
+	// crcFeliCa is the CRC of FeliCa frames, the CCITT polynomial with
+	// initial value 0000, transmitted most significant byte first.
+	crcFeliCa = newCRC16(0x1021, 0x0000, 0x0000, false, true)
+)
+
+// newCRC16 builds the lookup table of the polynomial poly, given in its
+// normal form, processing bytes least significant bit first when
+// reflected is set.
+func newCRC16(poly, init, xorOut uint16, reflected, bigEndian bool) *crc16 {
+	c := &crc16{init: init, xorOut: xorOut, reflected: reflected, bigEndian: bigEndian}
+	if reflected {
+		poly = bits.Reverse16(poly)
+	}
+	for i := range c.table {
+		crc := uint16(i)
+		if !reflected {
+			crc <<= 8
+		}
+		for j := 0; j < 8; j++ {
+			switch {
+			case reflected && crc&0x0001 != 0:
+				crc = crc>>1 ^ poly
+			case reflected:
+				crc >>= 1
+			case crc&0x8000 != 0:
+				crc = crc<<1 ^ poly
+			default:
+				crc <<= 1
 			}
 		}
+		c.table[i] = crc
 	}
+	return c
+}
+
+// update returns the CRC register crc after processing data.
+func (c *crc16) update(crc uint16, data []byte) uint16 {
+	if c.reflected {
+		for _, b := range data {
+			crc = crc>>8 ^ c.table[byte(crc)^b]
+		}
+		return crc
+	}
+	for _, b := range data {
+		crc = crc<<8 ^ c.table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// checksum returns the CRC of data.
+func (c *crc16) checksum(data []byte) uint16 {
+	return c.update(c.init, data) ^ c.xorOut
+}
+
+// appendSum appends the CRC value sum in transmission order.
+func (c *crc16) appendSum(b []byte, sum uint16) []byte {
+	if c.bigEndian {
+		return binary.BigEndian.AppendUint16(b, sum)
+	}
+	return binary.LittleEndian.AppendUint16(b, sum)
+}
 
-	crc = reflectUint16(crc)
-	return []byte{byte(crc & 0xFF), byte(crc >> 8)}
+// digest is the streaming Hash16 of a crc16.
+type digest struct {
+	c   *crc16
+	crc uint16
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.crc = d.c.update(d.crc, p)
+	return len(p), nil
+}
+
+func (d *digest) Sum16() uint16       { return d.crc ^ d.c.xorOut }
+func (d *digest) Sum(b []byte) []byte { return d.c.appendSum(b, d.Sum16()) }
+func (d *digest) Reset()              { d.crc = d.c.init }
+func (d *digest) Size() int           { return 2 }
+func (d *digest) BlockSize() int      { return 1 }
+
+func (c *crc16) newDigest() Hash16 {
+	return &digest{c: c, crc: c.init}
+}
+
+// NewCRCA returns a Hash16 computing the CRC-A of ISO/IEC 14443 Type A.
+func NewCRCA() Hash16 { return crcA.newDigest() }
+
+// NewCRCB returns a Hash16 computing the CRC-B of ISO/IEC 14443 Type B.
+func NewCRCB() Hash16 { return crcB.newDigest() }
+
+// NewCRC15693 returns a Hash16 computing the CRC of ISO/IEC 15693
+// vicinity cards, the same ISO/IEC 13239 CRC as CRC-B.
+func NewCRC15693() Hash16 { return crcB.newDigest() }
+
+// NewCRCFeliCa returns a Hash16 computing the CRC of FeliCa frames.
+func NewCRCFeliCa() Hash16 { return crcFeliCa.newDigest() }
+
+// CalculateCRCA calculates the CRC-A checksum for a given slice of data.
+// This function implements the CRC-A algorithm used in ISO/IEC 14443 Type A
+// standard, suitable for NFC communication. The function returns a 2-byte slice
+// containing the CRC in little-endian format.
+func CalculateCRCA(data []byte) []byte {
+	return crcA.appendSum(make([]byte, 0, 2), crcA.checksum(data))
 }
 
 // VerifyCRCA compares the calculated CRC-A checksum of the provided data
@@ -40,28 +149,33 @@ func VerifyCRCA(data []byte, crc []byte) bool {
 	return bytes.Equal(calculatedCRC, crc)
 }
 
-// reflectByte reverses the order of the last 8 bits in x.
-func reflectByte(x uint16) uint16 {
-	reflection := uint16(0)
-	for i := uint16(0); i < 8; i++ {
-		if x&(1<<i) != 0 {
-			reflection |= 1 << (7 - i)
-		}
-	}
-	return reflection
+// CalculateCRCB calculates the CRC-B checksum of data used by ISO/IEC
+// 14443 Type B frames: the reflected CCITT polynomial with initial value
+// FFFF, complemented. The function returns a 2-byte slice containing the
+// CRC in little-endian format, the order in which it is transmitted.
+func CalculateCRCB(data []byte) []byte {
+	return crcB.appendSum(make([]byte, 0, 2), crcB.checksum(data))
 }
 
-// reflectUint16 reverses the order of the last 16 bits in x.
-func reflectUint16(x uint16) uint16 {
-	reflection := uint16(0)
-	for i := uint16(0); i < 16; i++ {
-		if x&(1<<i) != 0 {
-			reflection |= 1 << (15 - i)
-		}
-	}
-	return reflection
+// VerifyCRCB compares the calculated CRC-B checksum of data against the
+// received crc and reports whether they match.
+func VerifyCRCB(data []byte, crc []byte) bool {
+	return bytes.Equal(CalculateCRCB(data), crc)
+}
+
+// CalculateCRC15693 returns the ISO/IEC 15693 CRC of data in
+// little-endian format.
+func CalculateCRC15693(data []byte) []byte {
+	return CalculateCRCB(data)
+}
+
+// CalculateCRCFeliCa returns the FeliCa CRC of data in big-endian
+// format, the order in which it is transmitted.
+func CalculateCRCFeliCa(data []byte) []byte {
+	return crcFeliCa.appendSum(make([]byte, 0, 2), crcFeliCa.checksum(data))
 }
 
 // ref: found ideas for implementation from following links
+// https://reveng.sourceforge.io/crc-catalogue/16.htm
 // http://www.sunshine2k.de/coding/javascript/crc/crc_js.html
 // https://hub.zhovner.com/tools/nfc/
@@ -62,3 +62,109 @@ func TestVerifyCRCA(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateCRCB(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  []byte
+	}{
+		{"zeros", []byte{0x00, 0x00, 0x00}, []byte{0xCC, 0xC6}},
+		{"bytes", []byte{0x0F, 0xAA, 0xFF}, []byte{0xFC, 0xD1}},
+		{"check", []byte("123456789"), []byte{0x6E, 0x90}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateCRCB(tt.input); !bytes.Equal(got, tt.want) {
+				t.Errorf("CalculateCRCB() = % X, want % X", got, tt.want)
+			}
+			if !VerifyCRCB(tt.input, tt.want) || VerifyCRCB(tt.input, []byte{0x00, 0x00}) {
+				t.Errorf("VerifyCRCB() mismatch for % X", tt.input)
+			}
+		})
+	}
+}
+
+func TestHash16(t *testing.T) {
+	check := []byte("123456789")
+	tests := []struct {
+		name  string
+		new   func() Hash16
+		sum   func([]byte) []byte
+		want  []byte
+		sum16 uint16
+	}{
+		{"CRC-A", NewCRCA, CalculateCRCA, []byte{0x05, 0xBF}, 0xBF05},
+		{"CRC-B", NewCRCB, CalculateCRCB, []byte{0x6E, 0x90}, 0x906E},
+		{"ISO 15693", NewCRC15693, CalculateCRC15693, []byte{0x6E, 0x90}, 0x906E},
+		{"FeliCa", NewCRCFeliCa, CalculateCRCFeliCa, []byte{0x31, 0xC3}, 0x31C3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sum(check); !bytes.Equal(got, tt.want) {
+				t.Errorf("one-shot = % X, want % X", got, tt.want)
+			}
+			h := tt.new()
+			h.Write(check[:4])
+			h.Write(check[4:])
+			if got := h.Sum([]byte{0xAA}); !bytes.Equal(got, append([]byte{0xAA}, tt.want...)) {
+				t.Errorf("Sum() = % X, want AA % X", got, tt.want)
+			}
+			if got := h.Sum16(); got != tt.sum16 {
+				t.Errorf("Sum16() = %04X, want %04X", got, tt.sum16)
+			}
+			h.Reset()
+			h.Write(check)
+			if got := h.Sum(nil); !bytes.Equal(got, tt.want) || h.Size() != 2 {
+				t.Errorf("Sum() after Reset() = % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCRCAMatchesBitwise(t *testing.T) {
+	data := make([]byte, 257)
+	for i := range data {
+		data[i] = byte(i * 37)
+	}
+	for n := 0; n <= len(data); n += 15 {
+		if got, want := CalculateCRCA(data[:n]), bitwiseCRCA(data[:n]); !bytes.Equal(got, want) {
+			t.Errorf("CalculateCRCA(%d bytes) = % X, want % X", n, got, want)
+		}
+	}
+}
+
+// bitwiseCRCA is the bit-at-a-time CRC-A the lookup table replaced, kept
+// as reference and benchmark baseline.
+func bitwiseCRCA(data []byte) []byte {
+	crc := uint16(0x6363)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&0x0001 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return []byte{byte(crc), byte(crc >> 8)}
+}
+
+func benchmarkCRC(b *testing.B, sum func([]byte) []byte) {
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		sum(data)
+	}
+}
+
+func BenchmarkCRCABitwise(b *testing.B) { benchmarkCRC(b, bitwiseCRCA) }
+func BenchmarkCRCA(b *testing.B)        { benchmarkCRC(b, CalculateCRCA) }
+func BenchmarkCRCB(b *testing.B)        { benchmarkCRC(b, CalculateCRCB) }
+func BenchmarkCRCFeliCa(b *testing.B)   { benchmarkCRC(b, CalculateCRCFeliCa) }
@@ -0,0 +1,179 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// OddParity returns the odd parity bit of b, set when b holds an even
+// number of ones.
+func OddParity(b byte) byte {
+	return ^byte(bits.OnesCount8(b)) & 1
+}
+
+// Frame is a Type A frame of ISO 14443-3 as it travels on the air: data
+// bits least significant first, each complete byte followed by its
+// parity bit. A frame answering a bit-oriented anticollision frame
+// completes the split byte sent by the PCD and starts at bit Align of
+// its first byte.
+type Frame struct {
+	// Data holds the data bits from bit Align of Data[0]. The bits below
+	// Align are those of the split byte sent by the PCD; they are covered
+	// by its parity bit but not transmitted in this frame.
+	Data []byte
+	// Bits is the number of data bits of the frame.
+	Bits int
+	// Align is the position of the first data bit in Data[0], 0 to 7.
+	Align int
+	// Parity holds in bit 0 the parity bit of each complete byte of Data.
+	// A nil Parity stands for odd parity, as sent by the PCD; MIFARE
+	// Classic sets encrypted parity bits instead.
+	Parity []byte
+}
+
+// NewFrame returns the frame of the first n bits of data, with odd parity.
+func NewFrame(data []byte, n int) Frame {
+	return Frame{Data: data, Bits: n}
+}
+
+// ShortFrame returns the 7-bit short frame of cmd, REQA or WUPA, which
+// has no parity bit.
+func ShortFrame(cmd byte) Frame {
+	return Frame{Data: []byte{cmd & 0x7F}, Bits: shortFrameBits}
+}
+
+// bytes returns the number of complete bytes, those followed by a parity bit.
+func (f Frame) bytes() int {
+	return (f.Align + f.Bits) / 8
+}
+
+// parity returns the parity bit to send after byte i.
+func (f Frame) parity(i int) byte {
+	if f.Parity == nil {
+		return OddParity(f.Data[i])
+	}
+	return f.Parity[i] & 1
+}
+
+// Encode returns the frame as a bit stream of n bits, the parity bit of
+// each complete byte inserted after it. A partial last byte, as in short
+// frames and bit-oriented anticollision frames, has no parity bit.
+func (f Frame) Encode() (stream []byte, n int) {
+	n = f.Bits + f.bytes()
+	stream = make([]byte, (n+7)/8)
+	pos := 0
+	put := func(bit byte) {
+		stream[pos/8] |= bit << (pos % 8)
+		pos++
+	}
+	for j := f.Align; j < f.Align+f.Bits; j++ {
+		put(f.Data[j/8] >> (j % 8) & 1)
+		if j%8 == 7 {
+			put(f.parity(j / 8))
+		}
+	}
+	return stream, n
+}
+
+// DecodeFrame splits the first n bits of stream, a frame starting at bit
+// align of its first byte, into data and parity bits. A stream ending
+// before the parity bit of its last complete byte, such as one cut by a
+// collision, leaves that parity bit out; CheckParity reports it.
+func DecodeFrame(stream []byte, n, align int) (Frame, error) {
+	if n < 0 || n > 8*len(stream) || align < 0 || align > 7 {
+		return Frame{}, fmt.Errorf("%w: frame of %d bits aligned at %d", ErrProtocol, n, align)
+	}
+	f := Frame{Align: align, Parity: []byte{}}
+	f.Data = make([]byte, (align+n+7)/8)
+	for pos := 0; pos < n; pos++ {
+		bit := stream[pos/8] >> (pos % 8) & 1
+		j := f.Align + f.Bits
+		if j%8 == 0 && j > 0 && len(f.Parity) < j/8 {
+			f.Parity = append(f.Parity, bit)
+			continue
+		}
+		f.Data[j/8] |= bit << (j % 8)
+		f.Bits++
+	}
+	f.Data = f.Data[:(align+f.Bits+7)/8]
+	return f, nil
+}
+
+// CheckParity checks the parity bit of every complete byte of a received
+// frame against odd parity. The error wraps ErrParity.
+func (f Frame) CheckParity() error {
+	for i := 0; i < f.bytes(); i++ {
+		if i >= len(f.Parity) {
+			return fmt.Errorf("%w: parity bit of byte %d missing", ErrParity, i)
+		}
+		if f.Parity[i]&1 != OddParity(f.Data[i]) {
+			return fmt.Errorf("%w: byte %d (%02X)", ErrParity, i, f.Data[i])
+		}
+	}
+	return nil
+}
+
+// Payload returns the data bits of the frame from bit 0 of the first
+// byte, without the bits of a split byte below Align.
+func (f Frame) Payload() []byte {
+	out := make([]byte, (f.Bits+7)/8)
+	for i := 0; i < f.Bits; i++ {
+		j := f.Align + i
+		out[i/8] |= f.Data[j/8] >> (j % 8) & 1 << (i % 8)
+	}
+	return out
+}
+
+// RawTransceiver exchanges bit streams with parity bits included, as
+// readers in transparent mode and sniffers see Type A frames.
+type RawTransceiver interface {
+	// TransceiveRaw sends n bits of stream and returns the bits
+	// received, with errors as documented for Transceiver. The Data
+	// of a *CollisionError holds stream bits.
+	TransceiveRaw(stream []byte, n int) ([]byte, int, error)
+}
+
+// ParityTransceiver is a Transceiver over a RawTransceiver: it adds odd
+// parity bits to the frames sent and checks and strips those of the
+// frames received. After a bit-oriented anticollision frame the answer
+// completes the split byte, whose parity covers the bits sent.
+type ParityTransceiver struct {
+	Raw RawTransceiver
+}
+
+// Transceive implements Transceiver.
+func (p ParityTransceiver) Transceive(data []byte, n int) ([]byte, int, error) {
+	stream, sn := NewFrame(data, n).Encode()
+	resp, rn, err := p.Raw.TransceiveRaw(stream, sn)
+	var ce *CollisionError
+	collided := errors.As(err, &ce)
+	if collided {
+		resp, rn = ce.Data, ce.Bits
+	} else if err != nil {
+		return nil, 0, err
+	}
+	// Only an anticollision frame, never a short frame, leaves a split byte.
+	var align int
+	if n > 8 {
+		align = n % 8
+	}
+	f, err := DecodeFrame(resp, rn, align)
+	if err != nil {
+		return nil, 0, err
+	}
+	if align != 0 && len(f.Data) > 0 {
+		f.Data[0] |= data[n/8] & (1<<align - 1)
+	}
+	if collided {
+		return nil, 0, &CollisionError{Data: f.Payload(), Bits: f.Bits}
+	}
+	if err := f.CheckParity(); err != nil {
+		return nil, 0, err
+	}
+	return f.Payload(), f.Bits, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestOddParity(t *testing.T) {
+	for b, want := range map[byte]byte{0x00: 1, 0x01: 0, 0x20: 0, 0x21: 1, 0x93: 1, 0xAB: 0, 0xFF: 1} {
+		if got := OddParity(b); got != want {
+			t.Errorf("OddParity(%02X) = %d, want %d", b, got, want)
+		}
+	}
+}
+
+func TestFrameEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame Frame
+		want  []byte
+		bits  int
+	}{
+		{"short frame", ShortFrame(CmdREQA), []byte{0x26}, 7},
+		{"standard frame", NewFrame([]byte{0x93, 0x20}, 16), []byte{0x93, 0x41, 0x00}, 18},
+		{"anticollision frame", NewFrame([]byte{0x93, 0x21, 0x01}, 17), []byte{0x93, 0x43, 0x06}, 19},
+		{"split byte answer", Frame{Data: []byte{0x05, 0xAB}, Bits: 15, Align: 1}, []byte{0x82, 0xAB, 0x00}, 17},
+		{"explicit parity", Frame{Data: []byte{0x93, 0x20}, Bits: 16, Parity: []byte{0, 1}}, []byte{0x93, 0x40, 0x02}, 18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, n := tt.frame.Encode()
+			if !bytes.Equal(stream, tt.want) || n != tt.bits {
+				t.Fatalf("Encode() = % X, %d bits, want % X, %d bits", stream, n, tt.want, tt.bits)
+			}
+			f, err := DecodeFrame(stream, n, tt.frame.Align)
+			if err != nil {
+				t.Fatalf("DecodeFrame() error = %v", err)
+			}
+			if f.Bits != tt.frame.Bits || !bytes.Equal(f.Payload(), tt.frame.Payload()) {
+				t.Errorf("DecodeFrame() payload = % X, %d bits, want % X", f.Payload(), f.Bits, tt.frame.Payload())
+			}
+			if tt.frame.Parity != nil {
+				if !bytes.Equal(f.Parity, tt.frame.Parity) {
+					t.Errorf("DecodeFrame() parity = %v, want %v", f.Parity, tt.frame.Parity)
+				}
+				return
+			}
+			if f.Align > 0 {
+				f.Data[0] |= tt.frame.Data[0] & (1<<f.Align - 1)
+			}
+			if err := f.CheckParity(); err != nil {
+				t.Errorf("CheckParity() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFrameCheckParity(t *testing.T) {
+	stream, n := NewFrame([]byte{0x93, 0x20}, 16).Encode()
+	stream[1] ^= 0x01
+	f, err := DecodeFrame(stream, n, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.CheckParity(); !errors.Is(err, ErrParity) {
+		t.Errorf("CheckParity(flipped bit) error = %v", err)
+	}
+	if f, _ = DecodeFrame(stream, 8, 0); !errors.Is(f.CheckParity(), ErrParity) {
+		t.Errorf("CheckParity(missing bit) error = %v", f.CheckParity())
+	}
+	if _, err := DecodeFrame(stream, 25, 0); !errors.Is(err, ErrProtocol) {
+		t.Errorf("DecodeFrame(25 bits) error = %v", err)
+	}
+}
+
+// simRawA exposes a simulated field as a RawTransceiver, checking the
+// parity of the frames sent and adding it to those received.
+type simRawA struct {
+	field Transceiver
+}
+
+func (s simRawA) TransceiveRaw(stream []byte, n int) ([]byte, int, error) {
+	f, err := DecodeFrame(stream, n, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := f.CheckParity(); err != nil {
+		return nil, 0, err
+	}
+	resp, bits, err := s.field.Transceive(f.Data, f.Bits)
+	var ce *CollisionError
+	if errors.As(err, &ce) {
+		resp, bits = ce.Data, ce.Bits
+	} else if err != nil {
+		return nil, 0, err
+	}
+	var align int
+	if f.Bits > 8 {
+		align = f.Bits % 8
+	}
+	out := Frame{Data: make([]byte, (align+bits+7)/8), Bits: bits, Align: align}
+	copyBits(out.Data, align, resp, bits)
+	if align > 0 && len(out.Data) > 0 {
+		out.Data[0] |= f.Data[f.Bits/8] & (1<<align - 1)
+	}
+	stream, n = out.Encode()
+	if ce != nil {
+		return nil, 0, &CollisionError{Data: stream, Bits: n}
+	}
+	return stream, n, nil
+}
+
+// rawFunc adapts a function to the RawTransceiver interface.
+type rawFunc func(stream []byte, n int) ([]byte, int, error)
+
+func (f rawFunc) TransceiveRaw(stream []byte, n int) ([]byte, int, error) {
+	return f(stream, n)
+}
+
+func TestParityTransceiver(t *testing.T) {
+	cards := []*simCardA{
+		{uid: []byte{0x01, 0x02, 0x03, 0x04}, atqa: ATQA{0x04, 0x00}, sak: 0x08},
+		{uid: []byte{0x01, 0x02, 0x03, 0x05}, atqa: ATQA{0x04, 0x00}, sak: 0x08},
+		{uid: []byte{0x04, 0x66, 0x2A, 0x12, 0x34, 0x56, 0x80}, atqa: ATQA{0x44, 0x00}, sak: SAKISODEP},
+	}
+	pt := ParityTransceiver{Raw: simRawA{field: &simFieldA{cards: cards}}}
+	found, err := InventoryA(pt, 10)
+	if err != nil {
+		t.Fatalf("InventoryA() error = %v", err)
+	}
+	if len(found) != len(cards) {
+		t.Fatalf("InventoryA() found %d cards, want %d", len(found), len(cards))
+	}
+	for _, c := range cards {
+		if c.state != simHalt {
+			t.Errorf("UID % X state = %d, want halted", c.uid, c.state)
+		}
+	}
+
+	bad := ParityTransceiver{Raw: rawFunc(func(stream []byte, n int) ([]byte, int, error) {
+		return []byte{0x04, 0x00, 0x00}, 18, nil
+	})}
+	if _, err := RequestA(bad, false); !errors.Is(err, ErrParity) {
+		t.Errorf("RequestA() with wrong parity error = %v", err)
+	}
+}
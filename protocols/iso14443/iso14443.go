@@ -7,14 +7,71 @@
 // detection, data exchange, and protocol-specific functionalities.
 package iso14443
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+var (
+	// ErrNoResponse is returned by a Transceiver when no PICC answered.
+	ErrNoResponse = errors.New("iso14443: no response")
+	// ErrCollision is matched by a *CollisionError.
+	ErrCollision = errors.New("iso14443: bit collision")
+	// ErrParity is returned for a received byte whose parity bit is wrong.
+	ErrParity = errors.New("iso14443: parity error")
+	// ErrProtocol is returned for a response violating ISO/IEC 14443.
+	ErrProtocol = errors.New("iso14443: protocol error")
+	// ErrInvalidConfig is returned for an incomplete ReaderConfig.
+	ErrInvalidConfig = errors.New("iso14443: invalid reader configuration")
+)
+
+// Transceiver exchanges raw ISO 14443-3 frames with the PICCs in the
+// field, such as a PN532 or MFRC522 in raw mode. A frame is the first
+// bits bits of data, sent least significant bit of each byte first;
+// framing and parity are handled by the transceiver, CRCs are not.
+// ParityTransceiver adds parity for readers exchanging raw bit streams.
+// Received bits continue directly after a partial last byte sent, but
+// are returned from bit 0 of the first byte.
+type Transceiver interface {
+	// Transceive sends a frame and returns the bits received. When no
+	// PICC answers the error wraps ErrNoResponse; on a collision it is
+	// a *CollisionError carrying the bits received before it.
+	Transceive(data []byte, bits int) ([]byte, int, error)
+}
+
+// CollisionError reports a bit collision in a response. Data holds the
+// Bits valid bits received before the first colliding bit.
+type CollisionError struct {
+	Data []byte
+	Bits int
+}
+
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("%s after %d bits", ErrCollision, e.Bits)
+}
+
+// Is reports whether target is ErrCollision.
+func (e *CollisionError) Is(target error) bool {
+	return target == ErrCollision
+}
+
 const (
 	// Constants for ISO 14443 specific parameters
 	BaudRate106 = "106 kbps"
 	// ...
 )
 
-// DetectCard performs a proximity card detection process.
-func DetectCard(readerConfig ReaderConfig) (*Card, error) { return nil, nil }
+// DetectCard activates one Type A card in the field of the reader,
+// halted cards included when the configuration asks for wake-up.
+func DetectCard(readerConfig ReaderConfig) (*Card, error) {
+	if readerConfig.Transceiver == nil {
+		return nil, fmt.Errorf("%w: no transceiver", ErrInvalidConfig)
+	}
+	return ActivateA(readerConfig.Transceiver, readerConfig.Wakeup)
+}
 
 // ReadData reads data from an ISO 14443 card.
 func ReadData(card *Card, blockAddress byte) ([]byte, error) { return nil, nil }
@@ -22,21 +79,131 @@ func ReadData(card *Card, blockAddress byte) ([]byte, error) { return nil, nil }
 // WriteData writes data to an ISO 14443 card.
 func WriteData(card *Card, blockAddress byte, data []byte) error { return nil }
 
-// UnmarshalCard sets the Card fields from a byte slice.
-func UnmarshalCard(data []byte) (*Card, error) { return nil, nil }
+// UnmarshalCard decodes a Card encoded by Card.Marshal. The ATS and ATQB
+// are decoded from their raw bytes, the fields derived from them are
+// ignored.
+func UnmarshalCard(data []byte) (*Card, error) {
+	var j cardJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	c := &Card{UID: j.UID, DS: j.DS, DR: j.DR}
+	if j.ATQB != nil {
+		atqb, err := ParseATQB(j.ATQB.Raw)
+		if err != nil {
+			return nil, err
+		}
+		c.ATQB = atqb
+	} else {
+		if len(j.ATQA) != 2 || len(j.SAK) != 1 {
+			return nil, fmt.Errorf("%w: ATQA % X, SAK % X", ErrProtocol, j.ATQA, j.SAK)
+		}
+		c.ATQA, c.SAK = ATQA(j.ATQA), j.SAK[0]
+	}
+	if j.ATS != nil {
+		ats, err := ParseATS(j.ATS.Raw)
+		if err != nil {
+			return nil, err
+		}
+		c.ATS = ats
+	}
+	return c, nil
+}
 
 // CheckCardCompatibility checks if a card is compatible with ISO 14443 standards.
 func CheckCardCompatibility(card *Card) bool { return false }
 
 // Card represents an ISO 14443 card with specific attributes.
 type Card struct {
-	// Fields like UID, ATS (Answer to Select), etc.
+	// UID is the complete unique identifier of 4, 7 or 10 bytes, without
+	// cascade tags.
+	UID []byte
+	// ATQA is the answer to request as received, least significant byte first.
+	ATQA ATQA
+	// SAK is the select acknowledge of the last cascade level.
+	SAK byte
+	// ATS is the answer to select of a PICC activated with RATS.
+	ATS *ATS
+	// ATQB is the answer to request of a Type B PICC, whose UID is the
+	// PUPI; ATQA and SAK are unused then.
+	ATQB *ATQB
+	// DS and DR are the bit rates from and to the PICC, set by PPS.
+	DS BitRate
+	DR BitRate
+}
+
+// cardJSON is the JSON form of a Card.
+type cardJSON struct {
+	UID  apdu.HexBytes `json:"uid"`
+	ATQA apdu.HexBytes `json:"atqa,omitempty"`
+	SAK  apdu.HexBytes `json:"sak,omitempty"`
+	ATS  *atsJSON      `json:"ats,omitempty"`
+	ATQB *atqbJSON     `json:"atqb,omitempty"`
+	DS   BitRate       `json:"ds"`
+	DR   BitRate       `json:"dr"`
 }
 
-// MarshalCard serializes a Card into a byte slice.
-func (c *Card) Marshal() ([]byte, error) { return nil, nil }
+// atsJSON is the JSON form of an ATS with its decoded parameters.
+type atsJSON struct {
+	Raw        apdu.HexBytes `json:"raw"`
+	FSC        int           `json:"fsc"`
+	TA         apdu.HexBytes `json:"ta"`
+	FWT        string        `json:"fwt"`
+	SFGT       string        `json:"sfgt"`
+	CID        bool          `json:"cid"`
+	NAD        bool          `json:"nad"`
+	Historical apdu.HexBytes `json:"historical,omitempty"`
+}
+
+// atqbJSON is the JSON form of an ATQB with its decoded parameters.
+type atqbJSON struct {
+	Raw      apdu.HexBytes `json:"raw"`
+	AppData  apdu.HexBytes `json:"appData"`
+	BitRates apdu.HexBytes `json:"bitRates"`
+	FSC      int           `json:"fsc"`
+	ISODEP   bool          `json:"isoDep"`
+	FWT      string        `json:"fwt"`
+	CID      bool          `json:"cid"`
+	NAD      bool          `json:"nad"`
+}
+
+// Marshal encodes the Card as JSON with its activation parameters, the
+// ATS or ATQB both raw and decoded.
+func (c *Card) Marshal() ([]byte, error) {
+	j := cardJSON{UID: c.UID, DS: c.DS, DR: c.DR}
+	if b := c.ATQB; b != nil {
+		j.ATQB = &atqbJSON{
+			Raw:      b.Bytes(),
+			AppData:  b.AppData,
+			BitRates: []byte{b.BitRates},
+			FSC:      b.FSC(),
+			ISODEP:   b.ISODEP(),
+			FWT:      b.FWT().String(),
+			CID:      b.CID,
+			NAD:      b.NAD,
+		}
+	} else {
+		j.ATQA, j.SAK = c.ATQA[:], []byte{c.SAK}
+	}
+	if a := c.ATS; a != nil {
+		j.ATS = &atsJSON{
+			Raw:        a.Bytes(),
+			FSC:        a.FSC(),
+			TA:         []byte{a.TA},
+			FWT:        a.FWT().String(),
+			SFGT:       a.SFGT().String(),
+			CID:        a.CID,
+			NAD:        a.NAD,
+			Historical: a.Historical,
+		}
+	}
+	return json.Marshal(j)
+}
 
 // ReaderConfig represents configuration settings for an ISO 14443 reader.
 type ReaderConfig struct {
-	// Configuration fields like baud rate, modulation, etc.
+	// Transceiver exchanges the raw frames with the field.
+	Transceiver Transceiver
+	// Wakeup sends WUPA instead of REQA, waking halted cards as well.
+	Wakeup bool
 }
@@ -0,0 +1,322 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultFSC is the frame size of the PICC used until the ATS gives it.
+	DefaultFSC = 32
+	// DefaultFSD is the frame size the PCD accepts by default.
+	DefaultFSD = 256
+	// DefaultRetries is the number of times a lost or corrupted block is
+	// recovered before the exchange fails.
+	DefaultRetries = 2
+)
+
+// errInvalidBlock marks a lost or corrupted block, recovered with an
+// R-block as ISO 14443-4 section 7.5.4 prescribes.
+var errInvalidBlock = errors.New("iso14443: invalid block")
+
+// PCB bits of the ISO-DEP blocks.
+const (
+	pcbChaining  = 0x10
+	pcbCID       = 0x08
+	pcbNAD       = 0x04
+	pcbBlockNum  = 0x01
+	pcbI         = 0x02
+	pcbR         = 0xA2
+	pcbNAK       = 0x10
+	pcbS         = 0xC2
+	pcbDeselect  = 0x00
+	pcbWTX       = 0x30
+	pcbSTypeMask = 0x30
+)
+
+// WaitingTimeExtender is implemented by transceivers able to extend the
+// frame waiting time of the next response as requested by S(WTX).
+type WaitingTimeExtender interface {
+	ExtendWaitingTime(multiplier int)
+}
+
+// block is an ISO-DEP block without CID, NAD and CRC.
+type block struct {
+	pcb byte
+	inf []byte
+}
+
+func iBlock(bn byte, more bool, inf []byte) block {
+	pcb := pcbI | bn
+	if more {
+		pcb |= pcbChaining
+	}
+	return block{pcb: pcb, inf: inf}
+}
+
+func rBlock(bn byte, nak bool) block {
+	pcb := pcbR | bn
+	if nak {
+		pcb |= pcbNAK
+	}
+	return block{pcb: pcb}
+}
+
+func sBlock(typ byte, inf []byte) block {
+	return block{pcb: pcbS | typ, inf: inf}
+}
+
+func (b block) isI() bool   { return b.pcb&0xE2 == pcbI }
+func (b block) isR() bool   { return b.pcb&0xE6 == pcbR }
+func (b block) isS() bool   { return b.pcb&0xC7 == pcbS }
+func (b block) bn() byte    { return b.pcb & pcbBlockNum }
+func (b block) more() bool  { return b.pcb&pcbChaining != 0 }
+func (b block) nak() bool   { return b.pcb&pcbNAK != 0 }
+func (b block) sType() byte { return b.pcb & pcbSTypeMask }
+func (b block) String() string {
+	switch {
+	case b.isI():
+		return fmt.Sprintf("I(%d, more %v)", b.bn(), b.more())
+	case b.isR() && b.nak():
+		return fmt.Sprintf("R(NAK, %d)", b.bn())
+	case b.isR():
+		return fmt.Sprintf("R(ACK, %d)", b.bn())
+	case b.isS() && b.sType() == pcbWTX:
+		return "S(WTX)"
+	case b.isS() && b.sType() == pcbDeselect:
+		return "S(DESELECT)"
+	}
+	return fmt.Sprintf("block %02X", b.pcb)
+}
+
+// ISODEP drives the half-duplex block transmission protocol of ISO
+// 14443-4 over a Transceiver of raw frames. It implements the apdu
+// Transmitter interface so iso7816 commands run over it.
+type ISODEP struct {
+	// CID is sent in every block when UseCID is set.
+	CID    byte
+	UseCID bool
+	// NAD is sent in the first I-block of every command when UseNAD is set.
+	NAD    byte
+	UseNAD bool
+	// FSC is the largest frame the PICC accepts, CRC included.
+	FSC int
+	// FSD is the largest frame the PCD accepts, CRC included.
+	FSD int
+	// MaxRetries is the number of recovery attempts per block.
+	MaxRetries int
+	// CRC returns the two CRC bytes of a frame, CalculateCRCA for Type A.
+	CRC func(data []byte) []byte
+
+	t  Transceiver
+	bn byte
+}
+
+// NewISODEP returns an ISO-DEP engine for a Type A PICC activated on t
+// whose frame size is fsc.
+func NewISODEP(t Transceiver, fsc int) *ISODEP {
+	return &ISODEP{
+		FSC:        fsc,
+		FSD:        DefaultFSD,
+		MaxRetries: DefaultRetries,
+		CRC:        CalculateCRCA,
+		t:          t,
+	}
+}
+
+// prologue returns the length of the prologue of an I-block.
+func (d *ISODEP) prologue(nad bool) int {
+	n := 1
+	if d.UseCID {
+		n++
+	}
+	if nad {
+		n++
+	}
+	return n
+}
+
+// Transmit sends a command APDU and returns the response APDU, chaining
+// in both directions as required by FSC and FSD.
+func (d *ISODEP) Transmit(cmd []byte) ([]byte, error) {
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("%w: empty APDU", ErrProtocol)
+	}
+	var resp block
+	for off, first := 0, true; off < len(cmd); first = false {
+		nad := d.UseNAD && first
+		size := d.FSC - d.prologue(nad) - 2
+		if size < 1 {
+			return nil, fmt.Errorf("%w: FSC %d leaves no room for data", ErrProtocol, d.FSC)
+		}
+		end := min(off+size, len(cmd))
+		more := end < len(cmd)
+		blk := iBlock(d.bn, more, cmd[off:end])
+		if nad {
+			blk.pcb |= pcbNAD
+		}
+		var err error
+		if resp, err = d.exchange(blk); err != nil {
+			return nil, err
+		}
+		off = end
+		if more {
+			if !resp.isR() || resp.bn() != d.bn {
+				return nil, fmt.Errorf("%w: unexpected %s while chaining", ErrProtocol, resp)
+			}
+			d.bn ^= 1
+		}
+	}
+
+	var out []byte
+	for {
+		if !resp.isI() || resp.bn() != d.bn {
+			return nil, fmt.Errorf("%w: unexpected %s awaiting the response", ErrProtocol, resp)
+		}
+		d.bn ^= 1
+		out = append(out, resp.inf...)
+		if !resp.more() {
+			return out, nil
+		}
+		var err error
+		if resp, err = d.exchange(rBlock(d.bn, false)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Deselect sends S(DESELECT), after which the PICC is in the HALT state.
+func (d *ISODEP) Deselect() error {
+	req := sBlock(pcbDeselect, nil)
+	for i := 0; i <= d.MaxRetries; i++ {
+		resp, err := d.transceive(req)
+		if errors.Is(err, errInvalidBlock) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !resp.isS() || resp.sType() != pcbDeselect {
+			return fmt.Errorf("%w: unexpected %s answering S(DESELECT)", ErrProtocol, resp)
+		}
+		d.bn = 0
+		return nil
+	}
+	return fmt.Errorf("%w: S(DESELECT) not answered", ErrProtocol)
+}
+
+// exchange sends blk and returns the next block of the PICC which is not
+// part of error recovery or a waiting time extension.
+func (d *ISODEP) exchange(blk block) (block, error) {
+	out, retries := blk, 0
+	for {
+		resp, err := d.transceive(out)
+		if errors.Is(err, errInvalidBlock) {
+			if retries++; retries > d.MaxRetries {
+				return block{}, fmt.Errorf("%w: %w after %d attempts", ErrProtocol, err, retries)
+			}
+			// Rule 4 asks for R(NAK), rule 5 repeats R(ACK) while the
+			// PICC is chaining.
+			out = rBlock(d.bn, true)
+			if blk.isR() {
+				out = blk
+			}
+			continue
+		}
+		if err != nil {
+			return block{}, err
+		}
+		switch {
+		case resp.isS() && resp.sType() == pcbWTX:
+			if len(resp.inf) != 1 {
+				return block{}, fmt.Errorf("%w: S(WTX) with %d bytes", ErrProtocol, len(resp.inf))
+			}
+			wtxm := resp.inf[0] & 0x3F
+			if ext, ok := d.t.(WaitingTimeExtender); ok {
+				ext.ExtendWaitingTime(int(wtxm))
+			}
+			out = sBlock(pcbWTX, []byte{wtxm})
+		case resp.isR() && resp.nak():
+			return block{}, fmt.Errorf("%w: R(NAK) from the PICC", ErrProtocol)
+		case resp.isR() && resp.bn() != d.bn:
+			// Rule 6: the PICC did not receive the last I-block.
+			if !blk.isI() {
+				return block{}, fmt.Errorf("%w: unexpected %s", ErrProtocol, resp)
+			}
+			if retries++; retries > d.MaxRetries {
+				return block{}, fmt.Errorf("%w: I-block not acknowledged after %d attempts", ErrProtocol, retries)
+			}
+			out = blk
+		default:
+			return resp, nil
+		}
+	}
+}
+
+// transceive sends b and decodes the answer. Lost, corrupted and
+// malformed frames are reported as errInvalidBlock.
+func (d *ISODEP) transceive(b block) (block, error) {
+	frame := []byte{b.pcb}
+	if d.UseCID {
+		frame[0] |= pcbCID
+		frame = append(frame, d.CID&0x0F)
+	}
+	if b.pcb&pcbNAD != 0 {
+		frame = append(frame, d.NAD)
+	}
+	frame = append(frame, b.inf...)
+	frame = append(frame, d.CRC(frame)...)
+
+	resp, bits, err := d.t.Transceive(frame, 8*len(frame))
+	if errors.Is(err, ErrNoResponse) || errors.Is(err, ErrCollision) {
+		return block{}, fmt.Errorf("%w: %w", errInvalidBlock, err)
+	}
+	if err != nil {
+		return block{}, err
+	}
+	if bits%8 != 0 || bits/8 > len(resp) {
+		return block{}, fmt.Errorf("%w: frame of %d bits", errInvalidBlock, bits)
+	}
+	resp = resp[:bits/8]
+	if len(resp) > d.FSD {
+		return block{}, fmt.Errorf("%w: frame of %d bytes exceeds FSD %d", ErrProtocol, len(resp), d.FSD)
+	}
+	return d.decode(resp)
+}
+
+// decode checks the CRC and strips the prologue of a received frame.
+func (d *ISODEP) decode(frame []byte) (block, error) {
+	if len(frame) < 3 || !bytes.Equal(d.CRC(frame[:len(frame)-2]), frame[len(frame)-2:]) {
+		return block{}, fmt.Errorf("%w: CRC error", errInvalidBlock)
+	}
+	b := block{pcb: frame[0]}
+	rest := frame[1 : len(frame)-2]
+	if !b.isI() && !b.isR() && !b.isS() {
+		return block{}, fmt.Errorf("%w: PCB %02X", errInvalidBlock, b.pcb)
+	}
+	if b.pcb&pcbCID != 0 {
+		if !d.UseCID || len(rest) == 0 || rest[0]&0x0F != d.CID&0x0F {
+			return block{}, fmt.Errorf("%w: unexpected CID", errInvalidBlock)
+		}
+		rest = rest[1:]
+	} else if d.UseCID {
+		return block{}, fmt.Errorf("%w: CID missing", errInvalidBlock)
+	}
+	if b.isI() && b.pcb&pcbNAD != 0 {
+		if len(rest) == 0 {
+			return block{}, fmt.Errorf("%w: NAD missing", errInvalidBlock)
+		}
+		rest = rest[1:]
+	}
+	b.pcb &^= pcbCID
+	if b.isI() {
+		b.pcb &^= pcbNAD
+	}
+	b.inf = rest
+	return b, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/protocols/iso7816"
+)
+
+// simPICC is the PICC side of ISO-DEP following the rules of ISO 14443-4
+// section 7.5.4, with faults injected by frame index.
+type simPICC struct {
+	handler func([]byte) []byte
+	fsd     int // largest frame the PCD accepts
+	cid     int // -1 without CID
+	wtx     int // S(WTX) requests before each response
+	crc     func([]byte) []byte
+
+	loseRequests  map[int]bool
+	loseResponses map[int]bool
+	corrupt       map[int]bool
+
+	frames     int
+	bn         byte
+	last       []byte
+	chain      []byte
+	pending    []byte
+	wtxLeft    int
+	received   [][]byte
+	multiplier []int
+	deselected bool
+}
+
+func newSimPICC(handler func([]byte) []byte) *simPICC {
+	return &simPICC{handler: handler, fsd: DefaultFSD, cid: -1, bn: 1, crc: CalculateCRCA}
+}
+
+func (s *simPICC) ExtendWaitingTime(m int) {
+	s.multiplier = append(s.multiplier, m)
+}
+
+func (s *simPICC) Transceive(data []byte, bits int) ([]byte, int, error) {
+	i := s.frames
+	s.frames++
+	if s.loseRequests[i] || bits != 8*len(data) {
+		return nil, 0, ErrNoResponse
+	}
+	resp := s.process(data)
+	if resp == nil {
+		return nil, 0, ErrNoResponse
+	}
+	s.last = resp
+	if s.loseResponses[i] {
+		return nil, 0, ErrNoResponse
+	}
+	if s.corrupt[i] {
+		resp = append([]byte(nil), resp...)
+		resp[len(resp)-1] ^= 0xFF
+	}
+	return resp, 8 * len(resp), nil
+}
+
+func (s *simPICC) frame(pcb byte, inf []byte) []byte {
+	out := []byte{pcb}
+	if s.cid >= 0 {
+		out[0] |= pcbCID
+		out = append(out, byte(s.cid))
+	}
+	out = append(out, inf...)
+	return append(out, s.crc(out)...)
+}
+
+func (s *simPICC) process(frame []byte) []byte {
+	if len(frame) < 3 || !bytes.Equal(s.crc(frame[:len(frame)-2]), frame[len(frame)-2:]) {
+		return nil
+	}
+	b := block{pcb: frame[0]}
+	rest := frame[1 : len(frame)-2]
+	if b.pcb&pcbCID != 0 {
+		if s.cid < 0 || int(rest[0]&0x0F) != s.cid {
+			return nil
+		}
+		rest = rest[1:]
+	}
+	if b.isI() && b.pcb&pcbNAD != 0 {
+		rest = rest[1:]
+	}
+	switch {
+	case b.isI():
+		s.bn = b.bn()
+		s.chain = append(s.chain, rest...)
+		if b.more() {
+			return s.frame(pcbR|s.bn, nil)
+		}
+		s.received = append(s.received, s.chain)
+		s.pending, s.chain = s.handler(s.chain), nil
+		s.wtxLeft = s.wtx
+		return s.next()
+	case b.isR() && b.bn() == s.bn:
+		return s.last
+	case b.isR() && b.nak():
+		return s.frame(pcbR|s.bn, nil)
+	case b.isR():
+		s.bn ^= 1
+		return s.next()
+	case b.isS() && b.sType() == pcbWTX:
+		return s.next()
+	case b.isS() && b.sType() == pcbDeselect:
+		s.deselected = true
+		return s.frame(pcbS, nil)
+	}
+	return nil
+}
+
+// next returns the next S(WTX) request or block of the pending response.
+func (s *simPICC) next() []byte {
+	if s.wtxLeft > 0 {
+		s.wtxLeft--
+		return s.frame(pcbS|pcbWTX, []byte{0x01 + byte(s.wtxLeft)})
+	}
+	size := s.fsd - 3
+	if s.cid >= 0 {
+		size--
+	}
+	n := min(size, len(s.pending))
+	blk := iBlock(s.bn, n < len(s.pending), s.pending[:n])
+	s.pending = s.pending[n:]
+	return s.frame(blk.pcb, blk.inf)
+}
+
+// echo answers an APDU with its data and 90 00.
+func echo(cmd []byte) []byte {
+	return append(append([]byte(nil), cmd[4:]...), 0x90, 0x00)
+}
+
+func apduOf(n int) []byte {
+	cmd := []byte{0x00, 0xD6, 0x00, 0x00}
+	for i := 0; i < n; i++ {
+		cmd = append(cmd, byte(i))
+	}
+	return cmd
+}
+
+func TestISODEPTransmit(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(d *ISODEP, s *simPICC)
+		cmd    []byte
+		frames int
+	}{
+		{"single frames", func(d *ISODEP, s *simPICC) {}, apduOf(10), 1},
+		{"command chaining", func(d *ISODEP, s *simPICC) { d.FSC = 16 }, apduOf(40), 4},
+		{"response chaining", func(d *ISODEP, s *simPICC) { d.FSD, s.fsd = 16, 16 }, apduOf(40), 5},
+		{"both chaining", func(d *ISODEP, s *simPICC) { d.FSC, d.FSD, s.fsd = 24, 16, 16 }, apduOf(300), 38},
+		{"CID and NAD", func(d *ISODEP, s *simPICC) {
+			d.CID, d.UseCID, d.NAD, d.UseNAD, d.FSC = 3, true, 0x12, true, 16
+			s.cid = 3
+		}, apduOf(20), 3},
+		{"waiting time extension", func(d *ISODEP, s *simPICC) { s.wtx = 2 }, apduOf(4), 3},
+		{"lost request", func(d *ISODEP, s *simPICC) { s.loseRequests = map[int]bool{0: true} }, apduOf(4), 3},
+		{"lost response", func(d *ISODEP, s *simPICC) { s.loseResponses = map[int]bool{0: true} }, apduOf(4), 2},
+		{"corrupted response", func(d *ISODEP, s *simPICC) { s.corrupt = map[int]bool{0: true} }, apduOf(4), 2},
+		{"lost chained request", func(d *ISODEP, s *simPICC) {
+			d.FSC = 16
+			s.loseRequests = map[int]bool{1: true}
+		}, apduOf(40), 6},
+		{"lost acknowledgement", func(d *ISODEP, s *simPICC) {
+			d.FSC = 16
+			s.loseResponses = map[int]bool{1: true}
+		}, apduOf(40), 5},
+		{"lost response chain block", func(d *ISODEP, s *simPICC) {
+			d.FSD, s.fsd = 16, 16
+			s.loseResponses = map[int]bool{1: true}
+		}, apduOf(40), 6},
+		{"lost WTX request", func(d *ISODEP, s *simPICC) {
+			s.wtx = 1
+			s.loseResponses = map[int]bool{0: true}
+		}, apduOf(4), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSimPICC(echo)
+			d := NewISODEP(s, DefaultFSC)
+			tt.setup(d, s)
+			for i := 0; i < 2; i++ {
+				s.frames = 0
+				got, err := d.Transmit(tt.cmd)
+				if err != nil {
+					t.Fatalf("Transmit() error = %v", err)
+				}
+				if !bytes.Equal(got, echo(tt.cmd)) {
+					t.Fatalf("Transmit() = % X", got)
+				}
+				if i == 0 && s.frames != tt.frames {
+					t.Errorf("Transmit() took %d frames, want %d", s.frames, tt.frames)
+				}
+				s.loseRequests, s.loseResponses, s.corrupt = nil, nil, nil
+			}
+			if len(s.received) != 2 || !bytes.Equal(s.received[0], tt.cmd) {
+				t.Errorf("PICC received %d APDUs", len(s.received))
+			}
+			if s.wtx > 0 && len(s.multiplier) < s.wtx {
+				t.Errorf("waiting time extended %v", s.multiplier)
+			}
+		})
+	}
+}
+
+func TestISODEPErrors(t *testing.T) {
+	s := newSimPICC(echo)
+	s.loseRequests = map[int]bool{0: true, 1: true, 2: true}
+	d := NewISODEP(s, DefaultFSC)
+	if _, err := d.Transmit(apduOf(4)); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Transmit() with a mute PICC error = %v", err)
+	}
+	if _, err := d.Transmit(nil); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Transmit(nil) error = %v", err)
+	}
+	d.FSC = 3
+	if _, err := d.Transmit(apduOf(4)); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Transmit() with FSC 3 error = %v", err)
+	}
+
+	s = newSimPICC(func([]byte) []byte { return make([]byte, 40) })
+	d = NewISODEP(s, DefaultFSC)
+	d.FSD = 16
+	if _, err := d.Transmit(apduOf(4)); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Transmit() of a frame above FSD error = %v", err)
+	}
+}
+
+func TestISODEPDeselect(t *testing.T) {
+	s := newSimPICC(echo)
+	s.loseResponses = map[int]bool{1: true}
+	d := NewISODEP(s, DefaultFSC)
+	if _, err := d.Transmit(apduOf(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Deselect(); err != nil || !s.deselected {
+		t.Errorf("Deselect() error = %v, deselected %v", err, s.deselected)
+	}
+}
+
+func TestISODEPCard(t *testing.T) {
+	p, err := iso7816.LoadVirtualProfile(strings.NewReader(`{"mf": {"children": [
+		{"fid": "0101", "structure": "transparent", "size": 200, "data": "CAFE"}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := iso7816.NewVirtualCard(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSimPICC(func(cmd []byte) []byte {
+		resp, _ := v.Transmit(cmd)
+		return resp
+	})
+	d := NewISODEP(s, DefaultFSC)
+	d.FSD = 64
+	s.fsd = 64
+	c := iso7816.NewCard(d)
+	if _, err := c.SelectFID(0x0101); err != nil {
+		t.Fatalf("SelectFID() error = %v", err)
+	}
+	data, err := c.ReadFile(0)
+	if err != nil || len(data) != 200 || data[0] != 0xCA {
+		t.Errorf("ReadFile() = %d bytes, %v", len(data), err)
+	}
+}
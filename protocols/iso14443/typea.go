@@ -0,0 +1,235 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Type A commands of ISO 14443-3.
+const (
+	CmdREQA byte = 0x26 // short frame of 7 bits
+	CmdWUPA byte = 0x52 // short frame of 7 bits
+	CmdHLTA byte = 0x50
+	CmdSEL1 byte = 0x93 // select code of cascade level 1
+	CmdSEL2 byte = 0x95
+	CmdSEL3 byte = 0x97
+)
+
+const (
+	// CascadeTag starts a UID part announcing a further cascade level.
+	CascadeTag byte = 0x88
+	// SAKCascade is set in the SAK while the UID is not complete.
+	SAKCascade byte = 0x04
+	// SAKISODEP is set in the SAK of a PICC compliant with ISO 14443-4.
+	SAKISODEP byte = 0x20
+)
+
+// shortFrameBits is the length of the REQA and WUPA short frames.
+const shortFrameBits = 7
+
+// ATQA is the answer to request, least significant byte first.
+type ATQA [2]byte
+
+// UIDSize returns the UID size in bytes announced by the ATQA, or zero
+// for the RFU coding.
+func (a ATQA) UIDSize() int {
+	switch a[0] >> 6 {
+	case 0:
+		return 4
+	case 1:
+		return 7
+	case 2:
+		return 10
+	}
+	return 0
+}
+
+// BitFrameAnticollision reports whether the ATQA announces bit frame
+// anticollision, which proprietary PICCs such as Topaz do not support.
+func (a ATQA) BitFrameAnticollision() bool {
+	b := a[0] & 0x1F
+	return b != 0 && b&(b-1) == 0
+}
+
+// RequestA sends REQA, or WUPA when wakeup is set, and returns the ATQA.
+// Different ATQAs of several PICCs collide: the error is then a
+// *CollisionError and the ATQA holds the bits received before it, which
+// does not prevent the anticollision loop.
+func RequestA(t Transceiver, wakeup bool) (ATQA, error) {
+	cmd := CmdREQA
+	if wakeup {
+		cmd = CmdWUPA
+	}
+	var atqa ATQA
+	resp, bits, err := t.Transceive([]byte{cmd}, shortFrameBits)
+	var ce *CollisionError
+	switch {
+	case errors.As(err, &ce):
+		copy(atqa[:], ce.Data)
+		return atqa, err
+	case err != nil:
+		return atqa, err
+	case bits != 16 || len(resp) < 2:
+		return atqa, fmt.Errorf("%w: ATQA of %d bits", ErrProtocol, bits)
+	}
+	copy(atqa[:], resp)
+	return atqa, nil
+}
+
+// HaltA puts the selected PICC into the HALT state, from which only WUPA
+// wakes it up. The PICC does not answer HLTA.
+func HaltA(t Transceiver) error {
+	frame := appendCRCA([]byte{CmdHLTA, 0x00})
+	_, _, err := t.Transceive(frame, 8*len(frame))
+	switch {
+	case errors.Is(err, ErrNoResponse):
+		return nil
+	case err != nil:
+		return err
+	}
+	return fmt.Errorf("%w: HLTA answered", ErrProtocol)
+}
+
+// ActivateA requests a PICC with REQA, or WUPA when wakeup is set, and
+// selects one of the PICCs answering through all cascade levels.
+func ActivateA(t Transceiver, wakeup bool) (*Card, error) {
+	atqa, err := RequestA(t, wakeup)
+	switch {
+	case errors.Is(err, ErrCollision):
+	case err != nil:
+		return nil, err
+	case !atqa.BitFrameAnticollision():
+		return nil, fmt.Errorf("%w: ATQA %02X%02X without bit frame anticollision", ErrProtocol, atqa[0], atqa[1])
+	}
+	card, err := SelectA(t)
+	if err != nil {
+		return nil, err
+	}
+	card.ATQA = atqa
+	return card, nil
+}
+
+// InventoryA activates and halts the PICCs in the field one after the
+// other until none answers REQA or max cards were found. Halted PICCs
+// stay silent until woken up with WUPA.
+func InventoryA(t Transceiver, max int) ([]*Card, error) {
+	var cards []*Card
+	for len(cards) < max {
+		card, err := ActivateA(t, false)
+		if errors.Is(err, ErrNoResponse) {
+			break
+		}
+		if err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+		if err := HaltA(t); err != nil {
+			return cards, err
+		}
+	}
+	return cards, nil
+}
+
+// SelectA runs the anticollision loop and SELECT on each cascade level
+// for PICCs in the READY state and returns the selected PICC, whose ATQA
+// is left unset.
+func SelectA(t Transceiver) (*Card, error) {
+	card := &Card{}
+	for level := 0; level < 3; level++ {
+		sel := CmdSEL1 + 2*byte(level)
+		uid, err := anticollision(t, sel)
+		if err != nil {
+			return nil, err
+		}
+		sak, err := selectLevel(t, sel, uid)
+		if err != nil {
+			return nil, err
+		}
+		if sak&SAKCascade == 0 {
+			card.UID = append(card.UID, uid[:4]...)
+			card.SAK = sak
+			return card, nil
+		}
+		if uid[0] != CascadeTag {
+			return nil, fmt.Errorf("%w: cascade level %d without cascade tag", ErrProtocol, level+1)
+		}
+		card.UID = append(card.UID, uid[1:4]...)
+	}
+	return nil, fmt.Errorf("%w: UID beyond cascade level 3", ErrProtocol)
+}
+
+// anticollision determines the UID CLn and BCC of one PICC at the cascade
+// level sel. On each collision the bit is resolved to 1, and the PICCs
+// with a 0 there drop out.
+func anticollision(t Transceiver, sel byte) ([5]byte, error) {
+	var uid [5]byte
+	for known := 0; ; {
+		frame := append([]byte{sel, anticollisionNVB(known)}, uid[:(known+7)/8]...)
+		resp, bits, err := t.Transceive(frame, 16+known)
+		var ce *CollisionError
+		collided := errors.As(err, &ce)
+		if collided {
+			resp, bits = ce.Data, ce.Bits
+		} else if err != nil {
+			return uid, err
+		}
+		if known+bits > 40 || bits > 8*len(resp) {
+			return uid, fmt.Errorf("%w: anticollision response of %d bits after %d", ErrProtocol, bits, known)
+		}
+		copyBits(uid[:], known, resp, bits)
+		known += bits
+		if !collided {
+			if known != 40 {
+				return uid, fmt.Errorf("%w: UID CLn of %d bits", ErrProtocol, known)
+			}
+			if uid[0]^uid[1]^uid[2]^uid[3] != uid[4] {
+				return uid, fmt.Errorf("%w: BCC mismatch in UID CLn % X", ErrProtocol, uid)
+			}
+			return uid, nil
+		}
+		if known >= 40 {
+			return uid, fmt.Errorf("%w: collision after the BCC", ErrProtocol)
+		}
+		uid[known/8] |= 1 << (known % 8)
+		known++
+	}
+}
+
+// anticollisionNVB codes the number of valid bits of an ANTICOLLISION
+// frame: whole bytes, SEL and NVB included, in the high nibble and the
+// further bits in the low nibble.
+func anticollisionNVB(knownBits int) byte {
+	return byte((2+knownBits/8)<<4 | knownBits%8)
+}
+
+// selectLevel sends SELECT for the UID CLn and BCC and returns the SAK.
+func selectLevel(t Transceiver, sel byte, uid [5]byte) (byte, error) {
+	frame := appendCRCA(append([]byte{sel, 0x70}, uid[:]...))
+	resp, bits, err := t.Transceive(frame, 8*len(frame))
+	if err != nil {
+		return 0, err
+	}
+	if bits != 24 || len(resp) < 3 || !VerifyCRCA(resp[:1], resp[1:3]) {
+		return 0, fmt.Errorf("%w: invalid SAK frame % X", ErrProtocol, resp)
+	}
+	return resp[0], nil
+}
+
+// appendCRCA appends the CRC-A of data.
+func appendCRCA(data []byte) []byte {
+	return append(data, CalculateCRCA(data)...)
+}
+
+// copyBits copies n bits of src, from bit 0, to dst starting at bit off,
+// least significant bit of each byte first.
+func copyBits(dst []byte, off int, src []byte, n int) {
+	for i := 0; i < n; i++ {
+		bit := src[i/8] >> (i % 8) & 1
+		j := off + i
+		dst[j/8] = dst[j/8]&^(1<<(j%8)) | bit<<(j%8)
+	}
+}
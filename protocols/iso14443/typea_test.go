@@ -0,0 +1,239 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+const (
+	simIdle = iota
+	simReady
+	simActive
+	simHalt
+)
+
+// simCardA is a Type A PICC of the simulated field.
+type simCardA struct {
+	uid    []byte
+	atqa   ATQA
+	sak    byte
+	badBCC bool
+	state  int
+	level  int
+}
+
+func (c *simCardA) levels() int {
+	return map[int]int{4: 1, 7: 2, 10: 3}[len(c.uid)]
+}
+
+// cl returns the UID CLn and BCC of cascade level n.
+func (c *simCardA) cl(n int) []byte {
+	var part []byte
+	switch {
+	case n == c.levels()-1:
+		part = c.uid[len(c.uid)-4:]
+	default:
+		part = append([]byte{CascadeTag}, c.uid[3*n:3*n+3]...)
+	}
+	bcc := part[0] ^ part[1] ^ part[2] ^ part[3]
+	if c.badBCC {
+		bcc ^= 0xFF
+	}
+	return append(append([]byte(nil), part...), bcc)
+}
+
+// simFieldA is an RF field with several PICCs whose responses are
+// superposed bit by bit, different bits colliding.
+type simFieldA struct {
+	cards []*simCardA
+}
+
+func bitAt(b []byte, i int) byte {
+	return b[i/8] >> (i % 8) & 1
+}
+
+func (f *simFieldA) Transceive(data []byte, bits int) ([]byte, int, error) {
+	var resps [][]byte
+	var n int
+	switch {
+	case bits == shortFrameBits && (data[0] == CmdREQA || data[0] == CmdWUPA):
+		n = 16
+		for _, c := range f.cards {
+			if c.state == simIdle || c.state == simHalt && data[0] == CmdWUPA {
+				c.state, c.level = simReady, 0
+				resps = append(resps, c.atqa[:])
+			}
+		}
+	case bits == 32 && data[0] == CmdHLTA && VerifyCRCA(data[:2], data[2:4]):
+		for _, c := range f.cards {
+			if c.state == simActive {
+				c.state = simHalt
+			}
+		}
+	case bits == 72 && data[1] == 0x70 && VerifyCRCA(data[:7], data[7:9]):
+		n = 24
+		level := int(data[0]-CmdSEL1) / 2
+		for _, c := range f.cards {
+			if c.state != simReady || c.level != level {
+				continue
+			}
+			if !bytes.Equal(c.cl(level), data[2:7]) {
+				c.state = simIdle
+				continue
+			}
+			sak := c.sak
+			if level < c.levels()-1 {
+				sak = SAKCascade
+				c.level++
+			} else {
+				c.state = simActive
+			}
+			resps = append(resps, appendCRCA([]byte{sak}))
+		}
+	case bits >= 16 && (data[0] == CmdSEL1 || data[0] == CmdSEL2 || data[0] == CmdSEL3):
+		known := bits - 16
+		if anticollisionNVB(known) != data[1] {
+			return nil, 0, errors.New("wrong NVB")
+		}
+		n = 40 - known
+		level := int(data[0]-CmdSEL1) / 2
+	cards:
+		for _, c := range f.cards {
+			if c.state != simReady || c.level != level {
+				continue
+			}
+			cl := c.cl(level)
+			for i := 0; i < known; i++ {
+				if bitAt(cl, i) != bitAt(data[2:], i) {
+					continue cards
+				}
+			}
+			resp := make([]byte, 5)
+			for i := 0; i < n; i++ {
+				resp[i/8] |= bitAt(cl, known+i) << (i % 8)
+			}
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		return nil, 0, ErrNoResponse
+	}
+	out := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		bit := bitAt(resps[0], i)
+		for _, r := range resps[1:] {
+			if bitAt(r, i) != bit {
+				return out, 0, &CollisionError{Data: out, Bits: i}
+			}
+		}
+		out[i/8] |= bit << (i % 8)
+	}
+	return out, n, nil
+}
+
+func TestATQA(t *testing.T) {
+	tests := []struct {
+		atqa    ATQA
+		size    int
+		bitAnti bool
+	}{
+		{ATQA{0x04, 0x00}, 4, true},
+		{ATQA{0x44, 0x00}, 7, true},
+		{ATQA{0x84, 0x03}, 10, true},
+		{ATQA{0x00, 0x0C}, 4, false},
+		{ATQA{0x06, 0x00}, 4, false},
+		{ATQA{0xC1, 0x00}, 0, true},
+	}
+	for _, tt := range tests {
+		if got := tt.atqa.UIDSize(); got != tt.size {
+			t.Errorf("ATQA % X UIDSize() = %d, want %d", tt.atqa, got, tt.size)
+		}
+		if got := tt.atqa.BitFrameAnticollision(); got != tt.bitAnti {
+			t.Errorf("ATQA % X BitFrameAnticollision() = %v, want %v", tt.atqa, got, tt.bitAnti)
+		}
+	}
+}
+
+func TestActivateA(t *testing.T) {
+	tests := []struct {
+		name string
+		card *simCardA
+	}{
+		{"single size", &simCardA{uid: []byte{0x01, 0x02, 0x03, 0x04}, atqa: ATQA{0x04, 0x00}, sak: 0x08}},
+		{"double size", &simCardA{uid: []byte{0x04, 0x66, 0x2A, 0x12, 0x34, 0x56, 0x80}, atqa: ATQA{0x44, 0x00}, sak: 0x00}},
+		{"triple size", &simCardA{uid: []byte{0x04, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}, atqa: ATQA{0x84, 0x00}, sak: SAKISODEP}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := DetectCard(ReaderConfig{Transceiver: &simFieldA{cards: []*simCardA{tt.card}}})
+			if err != nil {
+				t.Fatalf("DetectCard() error = %v", err)
+			}
+			if !bytes.Equal(card.UID, tt.card.uid) || card.SAK != tt.card.sak || card.ATQA != tt.card.atqa {
+				t.Errorf("DetectCard() = UID % X, SAK %02X, ATQA % X", card.UID, card.SAK, card.ATQA)
+			}
+			if tt.card.state != simActive {
+				t.Errorf("PICC state = %d, want active", tt.card.state)
+			}
+		})
+	}
+}
+
+func TestInventoryA(t *testing.T) {
+	cards := []*simCardA{
+		{uid: []byte{0x01, 0x02, 0x03, 0x04}, atqa: ATQA{0x04, 0x00}, sak: 0x08},
+		{uid: []byte{0x01, 0x02, 0x03, 0x05}, atqa: ATQA{0x04, 0x00}, sak: 0x08},
+		{uid: []byte{0x04, 0x66, 0x2A, 0x12, 0x34, 0x56, 0x80}, atqa: ATQA{0x44, 0x00}, sak: 0x00},
+		{uid: []byte{0x04, 0x66, 0x2A, 0x12, 0x34, 0x56, 0x81}, atqa: ATQA{0x44, 0x00}, sak: SAKISODEP},
+	}
+	field := &simFieldA{cards: cards}
+	found, err := InventoryA(field, 10)
+	if err != nil {
+		t.Fatalf("InventoryA() error = %v", err)
+	}
+	if len(found) != len(cards) {
+		t.Fatalf("InventoryA() found %d cards, want %d", len(found), len(cards))
+	}
+	for _, c := range cards {
+		seen := false
+		for _, f := range found {
+			seen = seen || bytes.Equal(f.UID, c.uid) && f.SAK == c.sak
+		}
+		if !seen {
+			t.Errorf("UID % X not found", c.uid)
+		}
+		if c.state != simHalt {
+			t.Errorf("UID % X state = %d, want halted", c.uid, c.state)
+		}
+	}
+
+	if _, err := ActivateA(field, false); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("ActivateA() with halted cards error = %v", err)
+	}
+	if _, err := ActivateA(field, true); err != nil {
+		t.Errorf("ActivateA(wakeup) error = %v", err)
+	}
+	// WUPA woke all cards and those not selected went back to idle.
+	if found, err := InventoryA(field, 10); err != nil || len(found) != len(cards)-1 {
+		t.Errorf("InventoryA() after wake-up = %d, %v", len(found), err)
+	}
+}
+
+func TestActivateAErrors(t *testing.T) {
+	bad := &simFieldA{cards: []*simCardA{{uid: []byte{1, 2, 3, 4}, atqa: ATQA{0x04, 0x00}, badBCC: true}}}
+	if _, err := ActivateA(bad, false); !errors.Is(err, ErrProtocol) {
+		t.Errorf("ActivateA(bad BCC) error = %v", err)
+	}
+	topaz := &simFieldA{cards: []*simCardA{{uid: []byte{1, 2, 3, 4}, atqa: ATQA{0x00, 0x0C}}}}
+	if _, err := ActivateA(topaz, false); !errors.Is(err, ErrProtocol) {
+		t.Errorf("ActivateA(no bit frame anticollision) error = %v", err)
+	}
+	if _, err := DetectCard(ReaderConfig{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("DetectCard(no transceiver) error = %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Type B commands of ISO 14443-3.
+const (
+	// CmdREQB is the anticollision prefix APf of REQB and WUPB.
+	CmdREQB   byte = 0x05
+	CmdATTRIB byte = 0x1D
+	CmdHLTB   byte = 0x50
+	// ATQBPrefix starts every ATQB.
+	ATQBPrefix byte = 0x50
+)
+
+// reqbWakeup is the PARAM bit turning REQB into WUPB.
+const reqbWakeup = 0x08
+
+// MaxSlots is the largest number of anticollision slots of REQB.
+const MaxSlots = 16
+
+// ATQB is the answer to REQB, WUPB or a slot marker.
+type ATQB struct {
+	// PUPI is the pseudo-unique PICC identifier.
+	PUPI []byte
+	// AppData holds the AFI, the CRC-B of the AID and the number of
+	// applications, or proprietary data.
+	AppData []byte
+	// ProtocolInfo holds the protocol parameters decoded below, 3 bytes
+	// or 4 in an extended ATQB.
+	ProtocolInfo []byte
+
+	// BitRates codes the supported bit rates like TA of the ATS.
+	BitRates byte
+	// FSCI codes the largest frame the PICC accepts.
+	FSCI byte
+	// ProtocolType has bit 1 set for ISO 14443-4 compliance.
+	ProtocolType byte
+	// FWI codes the frame waiting time, SFGI the start-up frame guard
+	// time of an extended ATQB.
+	FWI  byte
+	SFGI byte
+	// ADC is the application data coding.
+	ADC byte
+	// NAD and CID report whether the PICC supports them.
+	NAD bool
+	CID bool
+}
+
+// ParseATQB decodes an ATQB without its CRC.
+func ParseATQB(data []byte) (*ATQB, error) {
+	if (len(data) != 12 && len(data) != 13) || data[0] != ATQBPrefix {
+		return nil, fmt.Errorf("%w: ATQB % X", ErrProtocol, data)
+	}
+	a := &ATQB{
+		PUPI:         bytes.Clone(data[1:5]),
+		AppData:      bytes.Clone(data[5:9]),
+		ProtocolInfo: bytes.Clone(data[9:]),
+	}
+	p := a.ProtocolInfo
+	a.BitRates = p[0]
+	a.FSCI, a.ProtocolType = p[1]>>4, p[1]&0x0F
+	a.FWI, a.ADC = p[2]>>4, p[2]>>2&0x03
+	a.NAD, a.CID = p[2]&0x02 != 0, p[2]&0x01 != 0
+	if len(p) == 4 {
+		a.SFGI = p[3] >> 4
+	}
+	return a, nil
+}
+
+// Bytes returns the ATQB without CRC.
+func (a *ATQB) Bytes() []byte {
+	out := append([]byte{ATQBPrefix}, a.PUPI...)
+	return append(append(out, a.AppData...), a.ProtocolInfo...)
+}
+
+// FSC returns the largest frame size the PICC accepts.
+func (a *ATQB) FSC() int {
+	return FrameSize(a.FSCI)
+}
+
+// FWT returns the frame waiting time. The RFU FWI 15 is read as 4.
+func (a *ATQB) FWT() time.Duration {
+	if a.FWI == 15 {
+		return fcUnit(4)
+	}
+	return fcUnit(a.FWI)
+}
+
+// ISODEP reports whether the PICC supports ISO 14443-4.
+func (a *ATQB) ISODEP() bool {
+	return a.ProtocolType&0x01 != 0
+}
+
+// appendCRCB appends the CRC-B of data.
+func appendCRCB(data []byte) []byte {
+	return append(data, CalculateCRCB(data)...)
+}
+
+// transceiveB sends a frame with CRC-B and returns the answer checked
+// and stripped of its CRC. A CRC error is reported as a collision, its
+// likely cause during anticollision.
+func transceiveB(t Transceiver, frame []byte) ([]byte, error) {
+	frame = appendCRCB(frame)
+	resp, bits, err := t.Transceive(frame, 8*len(frame))
+	if err != nil {
+		return nil, err
+	}
+	if bits%8 != 0 || bits/8 < 3 || bits/8 > len(resp) {
+		return nil, fmt.Errorf("%w: frame of %d bits", ErrProtocol, bits)
+	}
+	n := bits/8 - 2
+	if !VerifyCRCB(resp[:n], resp[n:n+2]) {
+		return nil, fmt.Errorf("%w: CRC_B error", ErrCollision)
+	}
+	return resp[:n], nil
+}
+
+// slotCode returns the N code of REQB for slots slots.
+func slotCode(slots int) (byte, error) {
+	for code := byte(0); code <= 4; code++ {
+		if 1<<code == slots {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %d slots", ErrProtocol, slots)
+}
+
+// RequestB sends REQB, or WUPB when wakeup is set, to the PICCs of the
+// application family afi, 00 for all, with slots anticollision slots
+// out of 1, 2, 4, 8 and 16. It returns the ATQB answered in the first
+// slot; a garbled answer is reported as ErrCollision.
+func RequestB(t Transceiver, afi byte, slots int, wakeup bool) (*ATQB, error) {
+	param, err := slotCode(slots)
+	if err != nil {
+		return nil, err
+	}
+	if wakeup {
+		param |= reqbWakeup
+	}
+	resp, err := transceiveB(t, []byte{CmdREQB, afi, param})
+	if err != nil {
+		return nil, err
+	}
+	return ParseATQB(resp)
+}
+
+// SlotMarker opens slot number slot, from 2 to 16, of the anticollision
+// started by RequestB and returns the ATQB answered in it.
+func SlotMarker(t Transceiver, slot int) (*ATQB, error) {
+	if slot < 2 || slot > MaxSlots {
+		return nil, fmt.Errorf("%w: slot %d", ErrProtocol, slot)
+	}
+	resp, err := transceiveB(t, []byte{byte(slot-1)<<4 | CmdREQB})
+	if err != nil {
+		return nil, err
+	}
+	return ParseATQB(resp)
+}
+
+// HaltB puts the PICC identified by pupi into the HALT state.
+func HaltB(t Transceiver, pupi []byte) error {
+	resp, err := transceiveB(t, append([]byte{CmdHLTB}, pupi...))
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 || resp[0] != 0x00 {
+		return fmt.Errorf("%w: HLTB answered % X", ErrProtocol, resp)
+	}
+	return nil
+}
+
+// InventoryB collects the ATQBs of the PICCs of family afi with the
+// slotted anticollision, halting each PICC found so that it leaves the
+// following rounds. Rounds repeat while collisions occur, at most
+// maxRounds times.
+func InventoryB(t Transceiver, afi byte, slots, maxRounds int) ([]*ATQB, error) {
+	var found []*ATQB
+	for round := 0; round < maxRounds; round++ {
+		collided, start := false, len(found)
+		for slot := 1; slot <= slots; slot++ {
+			var atqb *ATQB
+			var err error
+			if slot == 1 {
+				atqb, err = RequestB(t, afi, slots, false)
+			} else {
+				atqb, err = SlotMarker(t, slot)
+			}
+			switch {
+			case errors.Is(err, ErrNoResponse):
+				continue
+			case errors.Is(err, ErrCollision):
+				collided = true
+				continue
+			case err != nil:
+				return found, err
+			}
+			found = append(found, atqb)
+		}
+		for _, atqb := range found[start:] {
+			if err := HaltB(t, atqb.PUPI); err != nil && !errors.Is(err, ErrNoResponse) {
+				return found, err
+			}
+		}
+		if !collided {
+			break
+		}
+	}
+	return found, nil
+}
+
+// Attrib selects the PICC of atqb for ISO 14443-4 with ATTRIB: the PCD
+// accepts frames of fsd bytes, assigns the card identifier cid and sets
+// the bit rates ds from PICC to PCD and dr from PCD to PICC. The higher
+// layer inf is sent along; the MBLI and the higher layer answer are
+// returned.
+func Attrib(t Transceiver, atqb *ATQB, fsd int, cid byte, ds, dr BitRate, inf []byte) (int, []byte, error) {
+	if cid > MaxCID || ds > BitRate848 || dr > BitRate848 {
+		return 0, nil, fmt.Errorf("%w: ATTRIB for CID %d, DSI %d, DRI %d", ErrProtocol, cid, ds, dr)
+	}
+	frame := append([]byte{CmdATTRIB}, atqb.PUPI...)
+	frame = append(frame,
+		0x00,
+		byte(ds)<<6|byte(dr)<<4|FrameSizeCode(fsd),
+		atqb.ProtocolType&0x0F,
+		cid)
+	resp, err := transceiveB(t, append(frame, inf...))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(resp) == 0 || resp[0]&0x0F != cid {
+		return 0, nil, fmt.Errorf("%w: ATTRIB answered % X", ErrProtocol, resp)
+	}
+	return int(resp[0] >> 4), resp[1:], nil
+}
+
+// ActivateB requests a Type B PICC of family afi in a single slot, waking
+// halted PICCs when wakeup is set. The Card carries the PUPI as UID.
+func ActivateB(t Transceiver, afi byte, wakeup bool) (*Card, error) {
+	atqb, err := RequestB(t, afi, 1, wakeup)
+	if err != nil {
+		return nil, err
+	}
+	return &Card{UID: atqb.PUPI, ATQB: atqb}, nil
+}
+
+// ActivateISODEPB selects the Type B PICC card with ATTRIB at 106 kbit/s
+// and returns an ISO-DEP engine set up from its ATQB.
+func ActivateISODEPB(t Transceiver, card *Card, fsd int, cid byte) (*ISODEP, error) {
+	if card.ATQB == nil {
+		return nil, fmt.Errorf("%w: card without ATQB", ErrProtocol)
+	}
+	if _, _, err := Attrib(t, card.ATQB, fsd, cid, BitRate106, BitRate106, nil); err != nil {
+		return nil, err
+	}
+	d := NewISODEP(t, card.ATQB.FSC())
+	d.FSD = FrameSize(FrameSizeCode(fsd))
+	d.CID, d.UseCID = cid, card.ATQB.CID && cid > 0
+	d.CRC = CalculateCRCB
+	return d, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso14443
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// simCardB is a Type B PICC of the simulated field.
+type simCardB struct {
+	pupi  []byte
+	afi   byte
+	state int
+	slot  int
+}
+
+func (c *simCardB) atqb() []byte {
+	return appendCRCB(append(append([]byte{ATQBPrefix}, c.pupi...), c.afi, 0x12, 0x34, 0x01, 0x00, 0x81, 0x81))
+}
+
+// simFieldB is an RF field with Type B PICCs. Each PICC answers REQB in
+// a slot drawn from a seeded source; answers in the same slot superpose
+// into a frame failing its CRC.
+type simFieldB struct {
+	cards  []*simCardB
+	rand   *rand.Rand
+	attrib []byte
+}
+
+func (f *simFieldB) Transceive(data []byte, bits int) ([]byte, int, error) {
+	n := len(data) - 2
+	if bits != 8*len(data) || n < 1 || !VerifyCRCB(data[:n], data[n:]) {
+		return nil, 0, ErrNoResponse
+	}
+	var resps [][]byte
+	switch {
+	case data[0] == CmdREQB && n == 3:
+		slots := 1 << (data[2] & 0x07)
+		for _, c := range f.cards {
+			awake := c.state == simIdle || c.state == simReady || c.state == simHalt && data[2]&reqbWakeup != 0
+			if awake && (data[1] == 0 || data[1] == c.afi) {
+				c.state = simReady
+				c.slot = 1 + f.rand.Intn(slots)
+				if c.slot == 1 {
+					resps = append(resps, c.atqb())
+				}
+			}
+		}
+	case data[0]&0x0F == CmdREQB && n == 1:
+		for _, c := range f.cards {
+			if c.state == simReady && c.slot == int(data[0]>>4)+1 {
+				resps = append(resps, c.atqb())
+			}
+		}
+	case data[0] == CmdHLTB && n == 5:
+		for _, c := range f.cards {
+			if (c.state == simReady || c.state == simActive) && bytes.Equal(c.pupi, data[1:5]) {
+				c.state = simHalt
+				resps = append(resps, appendCRCB([]byte{0x00}))
+			}
+		}
+	case data[0] == CmdATTRIB && n >= 9:
+		for _, c := range f.cards {
+			if c.state == simReady && bytes.Equal(c.pupi, data[1:5]) {
+				c.state = simActive
+				f.attrib = append([]byte(nil), data[:n]...)
+				resps = append(resps, appendCRCB(append([]byte{0x10 | data[8]}, data[9:n]...)))
+			}
+		}
+	}
+	if len(resps) == 0 {
+		return nil, 0, ErrNoResponse
+	}
+	out := append([]byte(nil), resps[0]...)
+	for _, r := range resps[1:] {
+		for i := range out {
+			out[i] |= r[i]
+		}
+	}
+	return out, 8 * len(out), nil
+}
+
+func TestParseATQB(t *testing.T) {
+	a, err := ParseATQB([]byte{0x50, 0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x00, 0x77, 0x81, 0x71, 0x80})
+	if err != nil {
+		t.Fatalf("ParseATQB() error = %v", err)
+	}
+	if !bytes.Equal(a.PUPI, []byte{1, 2, 3, 4}) || a.BitRates != 0x77 || a.FSC() != 256 || !a.ISODEP() ||
+		a.FWI != 7 || a.ADC != 0 || a.NAD || !a.CID || a.SFGI != 8 {
+		t.Errorf("ParseATQB() = %+v", a)
+	}
+	for _, b := range [][]byte{nil, {0x50, 1, 2, 3}, {0x51, 1, 2, 3, 4, 0, 0, 0, 0, 0, 0, 0}} {
+		if _, err := ParseATQB(b); !errors.Is(err, ErrProtocol) {
+			t.Errorf("ParseATQB(% X) error = %v", b, err)
+		}
+	}
+}
+
+func TestRequestB(t *testing.T) {
+	card := &simCardB{pupi: []byte{0xA1, 0xB2, 0xC3, 0xD4}, afi: 0x10}
+	field := &simFieldB{cards: []*simCardB{card}, rand: rand.New(rand.NewSource(1))}
+	if _, err := RequestB(field, 0x20, 1, false); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("RequestB(other AFI) error = %v", err)
+	}
+	c, err := ActivateB(field, 0x10, false)
+	if err != nil || !bytes.Equal(c.UID, card.pupi) || c.ATQB.FSC() != 256 {
+		t.Fatalf("ActivateB() = %+v, %v", c, err)
+	}
+	if err := HaltB(field, card.pupi); err != nil || card.state != simHalt {
+		t.Fatalf("HaltB() error = %v, state %d", err, card.state)
+	}
+	if _, err := RequestB(field, 0, 1, false); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("RequestB() of a halted card error = %v", err)
+	}
+	if _, err := RequestB(field, 0, 1, true); err != nil {
+		t.Errorf("RequestB(wakeup) error = %v", err)
+	}
+	if _, err := RequestB(field, 0, 3, false); !errors.Is(err, ErrProtocol) {
+		t.Errorf("RequestB(3 slots) error = %v", err)
+	}
+
+	raw, err := c.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := UnmarshalCard(raw)
+	if err != nil || !bytes.Equal(back.ATQB.Bytes(), c.ATQB.Bytes()) || !bytes.Equal(back.UID, c.UID) {
+		t.Errorf("UnmarshalCard(%s) = %+v, %v", raw, back, err)
+	}
+}
+
+func TestInventoryB(t *testing.T) {
+	var cards []*simCardB
+	for i := 0; i < 6; i++ {
+		cards = append(cards, &simCardB{pupi: []byte{0x10, 0x20, 0x30, byte(3 * i)}})
+	}
+	field := &simFieldB{cards: cards, rand: rand.New(rand.NewSource(1))}
+	found, err := InventoryB(field, 0, 4, 8)
+	if err != nil {
+		t.Fatalf("InventoryB() error = %v", err)
+	}
+	if len(found) != len(cards) {
+		t.Fatalf("InventoryB() found %d cards, want %d", len(found), len(cards))
+	}
+	for _, c := range cards {
+		if c.state != simHalt {
+			t.Errorf("PUPI % X state = %d, want halted", c.pupi, c.state)
+		}
+	}
+}
+
+func TestActivateISODEPB(t *testing.T) {
+	card := &simCardB{pupi: []byte{0xA1, 0xB2, 0xC3, 0xD4}}
+	field := &simFieldB{cards: []*simCardB{card}, rand: rand.New(rand.NewSource(1))}
+	picc := newSimPICC(echo)
+	picc.crc, picc.cid = CalculateCRCB, 2
+	t2 := transceiverFunc(func(data []byte, bits int) ([]byte, int, error) {
+		if card.state == simActive {
+			return picc.Transceive(data, bits)
+		}
+		return field.Transceive(data, bits)
+	})
+	c, err := ActivateB(t2, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ActivateISODEPB(t2, c, 256, 2)
+	if err != nil {
+		t.Fatalf("ActivateISODEPB() error = %v", err)
+	}
+	if want := []byte{CmdATTRIB, 0xA1, 0xB2, 0xC3, 0xD4, 0x00, 0x08, 0x01, 0x02}; !bytes.Equal(field.attrib, want) {
+		t.Errorf("ATTRIB = % X, want % X", field.attrib, want)
+	}
+	if got, err := d.Transmit(apduOf(300)); err != nil || !bytes.Equal(got, echo(apduOf(300))) {
+		t.Errorf("Transmit() = %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// ErrInvalidATR is returned for an answer to reset which can not be parsed.
+var ErrInvalidATR = errors.New("iso7816: invalid ATR")
+
+const (
+	// TSDirect is the initial character of the direct convention.
+	TSDirect = 0x3B
+	// TSInverse is the initial character of the inverse convention.
+	TSInverse = 0x3F
+
+	// ProtocolT0 is the character oriented half duplex transmission protocol.
+	ProtocolT0 = 0
+	// ProtocolT1 is the block oriented half duplex transmission protocol.
+	ProtocolT1 = 1
+	// ProtocolT15 is not a transmission protocol, it qualifies global interface bytes.
+	ProtocolT15 = 15
+)
+
+// fiTable and fmaxTable map TA1 bits 8 to 5 to the clock rate conversion
+// integer Fi and the maximum clock frequency in kHz, zero marks RFU values.
+var (
+	fiTable   = [16]int{372, 372, 558, 744, 1116, 1488, 1860, 0, 0, 512, 768, 1024, 1536, 2048, 0, 0}
+	fmaxTable = [16]int{4000, 5000, 6000, 8000, 12000, 16000, 20000, 0, 0, 5000, 7500, 10000, 15000, 20000, 0, 0}
+	diTable   = [16]int{0, 1, 2, 4, 8, 16, 32, 64, 12, 20, 0, 0, 0, 0, 0, 0}
+)
+
+// InterfaceBytes is the group i of interface bytes TAi, TBi, TCi and TDi.
+type InterfaceBytes struct {
+	TA, TB, TC, TD             byte
+	HasTA, HasTB, HasTC, HasTD bool
+}
+
+// ATR is a parsed answer to reset as defined in ISO 7816-3 section 8.
+type ATR struct {
+	Raw        []byte
+	TS         byte
+	T0         byte
+	Interface  []InterfaceBytes // Interface[0] holds TA1, TB1, TC1 and TD1
+	Historical []byte
+	TCK        byte
+	HasTCK     bool
+}
+
+// ParseATR parses an answer to reset. When the ATR announces a protocol
+// other than T=0 the check character TCK is required and verified.
+func ParseATR(data []byte) (*ATR, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidATR, len(data))
+	}
+	a := &ATR{Raw: append([]byte(nil), data...), TS: data[0], T0: data[1]}
+	if a.TS != TSDirect && a.TS != TSInverse {
+		return nil, fmt.Errorf("%w: TS %02X", ErrInvalidATR, a.TS)
+	}
+
+	off := 2
+	y := a.T0 >> 4
+	needTCK := false
+	for {
+		var g InterfaceBytes
+		for bit, dst := range []struct {
+			b   *byte
+			has *bool
+		}{{&g.TA, &g.HasTA}, {&g.TB, &g.HasTB}, {&g.TC, &g.HasTC}, {&g.TD, &g.HasTD}} {
+			if y&(1<<bit) == 0 {
+				continue
+			}
+			if off >= len(data) {
+				return nil, fmt.Errorf("%w: truncated interface bytes of group %d", ErrInvalidATR, len(a.Interface)+1)
+			}
+			*dst.b, *dst.has = data[off], true
+			off++
+		}
+		a.Interface = append(a.Interface, g)
+		if !g.HasTD {
+			break
+		}
+		if g.TD&0x0F != ProtocolT0 {
+			needTCK = true
+		}
+		y = g.TD >> 4
+	}
+
+	k := int(a.T0 & 0x0F)
+	if off+k > len(data) {
+		return nil, fmt.Errorf("%w: %d historical bytes announced, %d present", ErrInvalidATR, k, len(data)-off)
+	}
+	a.Historical = append([]byte(nil), data[off:off+k]...)
+	off += k
+
+	if needTCK {
+		if off >= len(data) {
+			return nil, fmt.Errorf("%w: missing TCK", ErrInvalidATR)
+		}
+		a.TCK, a.HasTCK = data[off], true
+		off++
+		var x byte
+		for _, b := range data[1:off] {
+			x ^= b
+		}
+		if x != 0 {
+			return nil, fmt.Errorf("%w: TCK %02X does not match checksum", ErrInvalidATR, a.TCK)
+		}
+	}
+	if off != len(data) {
+		return nil, fmt.Errorf("%w: %d unexpected trailing bytes", ErrInvalidATR, len(data)-off)
+	}
+	return a, nil
+}
+
+// TA returns the interface byte TAi, i counting from 1.
+func (a *ATR) TA(i int) (byte, bool) {
+	if i < 1 || i > len(a.Interface) {
+		return 0, false
+	}
+	g := a.Interface[i-1]
+	return g.TA, g.HasTA
+}
+
+// TB returns the interface byte TBi, i counting from 1.
+func (a *ATR) TB(i int) (byte, bool) {
+	if i < 1 || i > len(a.Interface) {
+		return 0, false
+	}
+	g := a.Interface[i-1]
+	return g.TB, g.HasTB
+}
+
+// TC returns the interface byte TCi, i counting from 1.
+func (a *ATR) TC(i int) (byte, bool) {
+	if i < 1 || i > len(a.Interface) {
+		return 0, false
+	}
+	g := a.Interface[i-1]
+	return g.TC, g.HasTC
+}
+
+// TD returns the interface byte TDi, i counting from 1.
+func (a *ATR) TD(i int) (byte, bool) {
+	if i < 1 || i > len(a.Interface) {
+		return 0, false
+	}
+	g := a.Interface[i-1]
+	return g.TD, g.HasTD
+}
+
+// Protocols returns the protocols indicated by the TD bytes in order of
+// appearance, T=0 when there are none.
+func (a *ATR) Protocols() []int {
+	var (
+		ps   []int
+		seen [16]bool
+	)
+	for _, g := range a.Interface {
+		if !g.HasTD {
+			break
+		}
+		t := int(g.TD & 0x0F)
+		if !seen[t] {
+			seen[t] = true
+			ps = append(ps, t)
+		}
+	}
+	if len(ps) == 0 {
+		ps = []int{ProtocolT0}
+	}
+	return ps
+}
+
+// Supports reports whether protocol t is indicated by the ATR.
+func (a *ATR) Supports(t int) bool {
+	for _, p := range a.Protocols() {
+		if p == t {
+			return true
+		}
+	}
+	return false
+}
+
+// specific returns the first interface byte of the kind selected by pick
+// in a group following a TD indicating protocol t, i.e. from group 3 on.
+func (a *ATR) specific(t int, pick func(InterfaceBytes) (byte, bool)) (byte, bool) {
+	for i := 1; i < len(a.Interface); i++ {
+		prev := a.Interface[i-1]
+		if i < 2 || !prev.HasTD || int(prev.TD&0x0F) != t {
+			continue
+		}
+		if b, ok := pick(a.Interface[i]); ok {
+			return b, true
+		}
+	}
+	return 0, false
+}
+
+// Fi returns the clock rate conversion integer, 372 by default and zero
+// for RFU values of TA1.
+func (a *ATR) Fi() int {
+	ta1, ok := a.TA(1)
+	if !ok {
+		return 372
+	}
+	return fiTable[ta1>>4]
+}
+
+// Di returns the baud rate adjustment integer, 1 by default and zero for
+// RFU values of TA1.
+func (a *ATR) Di() int {
+	ta1, ok := a.TA(1)
+	if !ok {
+		return 1
+	}
+	return diTable[ta1&0x0F]
+}
+
+// MaxFrequency returns the maximum clock frequency in kHz, 5 MHz by
+// default and zero for RFU values of TA1.
+func (a *ATR) MaxFrequency() int {
+	ta1, ok := a.TA(1)
+	if !ok {
+		return 5000
+	}
+	return fmaxTable[ta1>>4]
+}
+
+// ExtraGuardTime returns N encoded in TC1, the extra guard time in ETUs.
+func (a *ATR) ExtraGuardTime() int {
+	tc1, _ := a.TC(1)
+	return int(tc1)
+}
+
+// WaitingTimeInteger returns the T=0 waiting time integer WI from TC2, 10 by default.
+func (a *ATR) WaitingTimeInteger() int {
+	if tc2, ok := a.TC(2); ok && tc2 != 0 {
+		return int(tc2)
+	}
+	return 10
+}
+
+// IsSpecificMode reports whether TA2 is present, putting the card in
+// specific mode with the protocol returned by SpecificProtocol.
+func (a *ATR) IsSpecificMode() bool {
+	_, ok := a.TA(2)
+	return ok
+}
+
+// SpecificProtocol returns the protocol of the specific mode.
+func (a *ATR) SpecificProtocol() (int, bool) {
+	ta2, ok := a.TA(2)
+	return int(ta2 & 0x0F), ok
+}
+
+// CanChangeMode reports whether a card in specific mode is able to change
+// to negotiable mode after a warm reset. Cards in negotiable mode report true.
+func (a *ATR) CanChangeMode() bool {
+	ta2, ok := a.TA(2)
+	return !ok || ta2&0x80 == 0
+}
+
+// IFSC returns the T=1 information field size of the card, 32 by default
+// or when TA holds one of the RFU values 00 and FF.
+func (a *ATR) IFSC() int {
+	if ta, ok := a.specific(ProtocolT1, func(g InterfaceBytes) (byte, bool) { return g.TA, g.HasTA }); ok && ta != 0x00 && ta != 0xFF {
+		return int(ta)
+	}
+	return 32
+}
+
+// BWI returns the T=1 block waiting time integer, 4 by default.
+func (a *ATR) BWI() int {
+	if tb, ok := a.specific(ProtocolT1, func(g InterfaceBytes) (byte, bool) { return g.TB, g.HasTB }); ok {
+		return int(tb >> 4)
+	}
+	return 4
+}
+
+// CWI returns the T=1 character waiting time integer, 13 by default.
+func (a *ATR) CWI() int {
+	if tb, ok := a.specific(ProtocolT1, func(g InterfaceBytes) (byte, bool) { return g.TB, g.HasTB }); ok {
+		return int(tb & 0x0F)
+	}
+	return 13
+}
+
+// UsesCRC reports whether the T=1 error detection code is a CRC rather
+// than the default LRC.
+func (a *ATR) UsesCRC() bool {
+	tc, ok := a.specific(ProtocolT1, func(g InterfaceBytes) (byte, bool) { return g.TC, g.HasTC })
+	return ok && tc&0x01 != 0
+}
+
+// HistoricalBytes decodes the historical bytes of the ATR.
+func (a *ATR) HistoricalBytes() (*HistoricalBytes, error) {
+	return ParseHistoricalBytes(a.Historical)
+}
+
+// Compact-TLV tags of the historical bytes, ISO 7816-4 section 8.1.1.
+const (
+	HistCountryCode     = 0x1
+	HistIssuerID        = 0x2
+	HistCardServiceData = 0x3
+	HistInitialAccess   = 0x4
+	HistIssuerData      = 0x5
+	HistPreIssuingData  = 0x6
+	HistCapabilities    = 0x7
+	HistStatusIndicator = 0x8
+	HistApplicationID   = 0xF
+)
+
+// HistoricalBytes are the decoded historical bytes of an ATR.
+type HistoricalBytes struct {
+	Category byte
+	// Objects are the compact-TLV data objects of categories 00 and 80.
+	Objects []tlv.Compact
+	// Status is the status indicator, the last three bytes for category 00
+	// or the value of tag 8 for category 80.
+	Status []byte
+	// Capabilities is set when the card capabilities tag 7 is present.
+	Capabilities *CardCapabilities
+	// Proprietary holds the bytes following a proprietary category indicator
+	// and the DIR data reference of category 10.
+	Proprietary []byte
+}
+
+// Find returns the value of the first compact-TLV object with tag.
+func (h *HistoricalBytes) Find(tag byte) ([]byte, bool) {
+	for _, o := range h.Objects {
+		if o.Tag == tag {
+			return o.Value, true
+		}
+	}
+	return nil, false
+}
+
+// CardCapabilities is the decoded card capabilities data object.
+type CardCapabilities struct {
+	// SelectionMethods is the first software function table, DF selection
+	// and EF management methods.
+	SelectionMethods byte
+	// DataCoding is the data coding byte of the second software function table.
+	DataCoding byte
+	// The third software function table.
+	CommandChaining       bool
+	ExtendedLength        bool
+	ExtendedLengthInfo    bool // extended length information in EF.ATR/INFO
+	ChannelsByCard        bool // logical channel number assignment by the card
+	ChannelsByInterface   bool // logical channel number assignment by the interface device
+	MaxLogicalChannels    int
+	HasThirdFunctionTable bool
+}
+
+// ParseHistoricalBytes decodes historical bytes. Categories 00 and 80
+// are decoded as compact-TLV, other categories are kept as proprietary data.
+func ParseHistoricalBytes(data []byte) (*HistoricalBytes, error) {
+	h := &HistoricalBytes{}
+	if len(data) == 0 {
+		return h, nil
+	}
+	h.Category = data[0]
+	body := data[1:]
+	switch h.Category {
+	case 0x00:
+		if len(body) < 3 {
+			return nil, fmt.Errorf("%w: category 00 without status indicator", ErrInvalidATR)
+		}
+		h.Status = body[len(body)-3:]
+		body = body[:len(body)-3]
+	case 0x80:
+	default:
+		h.Proprietary = body
+		return h, nil
+	}
+
+	objs, err := tlv.ParseCompact(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: historical bytes: %v", ErrInvalidATR, err)
+	}
+	h.Objects = objs
+	if v, ok := h.Find(HistStatusIndicator); ok && h.Category == 0x80 {
+		h.Status = v
+	}
+	if v, ok := h.Find(HistCapabilities); ok {
+		h.Capabilities = parseCardCapabilities(v)
+	}
+	return h, nil
+}
+
+func parseCardCapabilities(v []byte) *CardCapabilities {
+	c := &CardCapabilities{MaxLogicalChannels: 1}
+	if len(v) > 0 {
+		c.SelectionMethods = v[0]
+	}
+	if len(v) > 1 {
+		c.DataCoding = v[1]
+	}
+	if len(v) > 2 {
+		b := v[2]
+		c.HasThirdFunctionTable = true
+		c.CommandChaining = b&0x80 != 0
+		c.ExtendedLength = b&0x40 != 0
+		c.ExtendedLengthInfo = b&0x20 != 0
+		c.ChannelsByCard = b&0x10 != 0
+		c.ChannelsByInterface = b&0x08 != 0
+		if y := int(b & 0x07); y == 7 {
+			c.MaxLogicalChannels = 8
+		} else {
+			c.MaxLogicalChannels = y + 1
+		}
+	}
+	return c
+}
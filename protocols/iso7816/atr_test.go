@@ -0,0 +1,165 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseATR(t *testing.T) {
+	tests := []struct {
+		name      string
+		atr       []byte
+		protocols []int
+		fi, di    int
+		fmax      int
+		ifsc      int
+		bwi, cwi  int
+		hist      []byte
+	}{
+		{
+			name:      "T=0 only",
+			atr:       []byte{0x3B, 0x02, 0x14, 0x50},
+			protocols: []int{ProtocolT0},
+			fi:        372, di: 1, fmax: 5000,
+			ifsc: 32, bwi: 4, cwi: 13,
+			hist: []byte{0x14, 0x50},
+		},
+		{
+			name: "T=1 token",
+			atr: []byte{
+				0x3B, 0xFD, 0x13, 0x00, 0x00, 0x81, 0x31, 0xFE, 0x15, 0x80, 0x73, 0xC0, 0x21,
+				0xC0, 0x57, 0x59, 0x75, 0x62, 0x69, 0x4B, 0x65, 0x79, 0x40,
+			},
+			protocols: []int{ProtocolT1},
+			fi:        372, di: 4, fmax: 5000,
+			ifsc: 254, bwi: 1, cwi: 5,
+			hist: []byte{0x80, 0x73, 0xC0, 0x21, 0xC0, 0x57, 0x59, 0x75, 0x62, 0x69, 0x4B, 0x65, 0x79},
+		},
+		{
+			name: "T=0 and T=1 with T=15 globals",
+			atr: []byte{
+				0x3B, 0xDF, 0x96, 0x00, 0x80, 0xB1, 0xFE, 0x45, 0x1F, 0x83, 0x00, 0x31, 0xC0, 0x64,
+				0xC7, 0xFC, 0x10, 0x00, 0x01, 0x90, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+			protocols: []int{ProtocolT0, ProtocolT1, ProtocolT15},
+			fi:        512, di: 32, fmax: 5000,
+			ifsc: 254, bwi: 4, cwi: 5,
+			hist: []byte{0x00, 0x31, 0xC0, 0x64, 0xC7, 0xFC, 0x10, 0x00, 0x01, 0x90, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atr := append([]byte(nil), tt.atr...)
+			fixTCK(atr)
+			a, err := ParseATR(atr)
+			if err != nil {
+				t.Fatalf("ParseATR() error = %v", err)
+			}
+			if got := a.Protocols(); !reflect.DeepEqual(got, tt.protocols) {
+				t.Errorf("Protocols() = %v, want %v", got, tt.protocols)
+			}
+			if a.Fi() != tt.fi || a.Di() != tt.di || a.MaxFrequency() != tt.fmax {
+				t.Errorf("Fi, Di, fmax = %d, %d, %d, want %d, %d, %d", a.Fi(), a.Di(), a.MaxFrequency(), tt.fi, tt.di, tt.fmax)
+			}
+			if a.IFSC() != tt.ifsc || a.BWI() != tt.bwi || a.CWI() != tt.cwi {
+				t.Errorf("IFSC, BWI, CWI = %d, %d, %d, want %d, %d, %d", a.IFSC(), a.BWI(), a.CWI(), tt.ifsc, tt.bwi, tt.cwi)
+			}
+			if !bytes.Equal(a.Historical, tt.hist) {
+				t.Errorf("Historical = % X, want % X", a.Historical, tt.hist)
+			}
+		})
+	}
+}
+
+// fixTCK recomputes the check character of an ATR ending in TCK, so test
+// vectors can be edited by hand.
+func fixTCK(atr []byte) {
+	if len(atr) < 3 || atr[1]&0x80 == 0 {
+		return
+	}
+	var x byte
+	for _, b := range atr[1 : len(atr)-1] {
+		x ^= b
+	}
+	atr[len(atr)-1] = x
+}
+
+func TestParseATRErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		atr  []byte
+	}{
+		{"too short", []byte{0x3B}},
+		{"bad TS", []byte{0x3C, 0x00}},
+		{"truncated interface bytes", []byte{0x3B, 0xF0, 0x11}},
+		{"truncated historical bytes", []byte{0x3B, 0x03, 0x01}},
+		{"missing TCK", []byte{0x3B, 0x80, 0x01}},
+		{"wrong TCK", []byte{0x3B, 0x80, 0x01, 0x00}},
+		{"trailing bytes", []byte{0x3B, 0x00, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseATR(tt.atr); !errors.Is(err, ErrInvalidATR) {
+				t.Errorf("ParseATR() error = %v, want %v", err, ErrInvalidATR)
+			}
+		})
+	}
+}
+
+func TestATRModes(t *testing.T) {
+	// TA2 = 0x11: specific mode T=1, able to change mode. TC3 selects CRC.
+	atr := []byte{0x3B, 0xB0, 0x11, 0x00, 0x91, 0x11, 0x41, 0x01, 0x00}
+	fixTCK(atr)
+	a, err := ParseATR(atr)
+	if err != nil {
+		t.Fatalf("ParseATR() error = %v", err)
+	}
+	if p, ok := a.SpecificProtocol(); !a.IsSpecificMode() || !ok || p != ProtocolT1 {
+		t.Errorf("SpecificProtocol() = %d, %v", p, ok)
+	}
+	if !a.CanChangeMode() {
+		t.Errorf("CanChangeMode() = false")
+	}
+	if !a.UsesCRC() {
+		t.Errorf("UsesCRC() = false")
+	}
+	if a.ExtraGuardTime() != 0 {
+		t.Errorf("ExtraGuardTime() = %d", a.ExtraGuardTime())
+	}
+}
+
+func TestHistoricalBytes(t *testing.T) {
+	h, err := ParseHistoricalBytes([]byte{0x80, 0x73, 0xC0, 0x21, 0xC0, 0x57, 0x59, 0x75, 0x62, 0x69, 0x4B, 0x65, 0x79})
+	if err != nil {
+		t.Fatalf("ParseHistoricalBytes() error = %v", err)
+	}
+	c := h.Capabilities
+	if c == nil || !c.CommandChaining || !c.ExtendedLength || c.MaxLogicalChannels != 1 {
+		t.Errorf("Capabilities = %+v", c)
+	}
+	if v, ok := h.Find(HistIssuerData); !ok || string(v) != "YubiKey" {
+		t.Errorf("Find(issuer data) = %q, %v", v, ok)
+	}
+
+	h, err = ParseHistoricalBytes([]byte{0x00, 0x31, 0xC0, 0x73, 0xC0, 0x01, 0x87, 0x01, 0x90, 0x00})
+	if err != nil {
+		t.Fatalf("ParseHistoricalBytes() error = %v", err)
+	}
+	if !bytes.Equal(h.Status, []byte{0x01, 0x90, 0x00}) {
+		t.Errorf("Status = % X", h.Status)
+	}
+	if c := h.Capabilities; c == nil || c.ExtendedLength || !c.CommandChaining || c.MaxLogicalChannels != 8 {
+		t.Errorf("Capabilities = %+v", c)
+	}
+
+	if _, err := ParseHistoricalBytes([]byte{0x80, 0x75, 0x01}); !errors.Is(err, ErrInvalidATR) {
+		t.Errorf("ParseHistoricalBytes() error = %v, want %v", err, ErrInvalidATR)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// Dynamic authentication template and its data objects, ISO 7816-4 table 120.
+const (
+	TagDynamicAuth            tlv.Tag = 0x7C
+	TagAuthWitness            tlv.Tag = 0x80
+	TagAuthChallenge          tlv.Tag = 0x81
+	TagAuthResponse           tlv.Tag = 0x82
+	TagAuthCommittedChallenge tlv.Tag = 0x83
+	TagAuthCode               tlv.Tag = 0x84
+	TagAuthExponential        tlv.Tag = 0x85
+	TagAuthIdentificationData tlv.Tag = 0xA0
+)
+
+// GetChallengeCommand builds GET CHALLENGE for n bytes, 256 meaning
+// "as many as the card returns".
+func GetChallengeCommand(cla byte, n int) *apdu.Command {
+	return apdu.CreateCommand(cla, INSGetChallenge, 0x00, 0x00, nil, n)
+}
+
+// InternalAuthenticateCommand builds INTERNAL AUTHENTICATE asking the
+// card to authenticate itself over challenge with algorithm alg and the
+// key referenced by ref.
+func InternalAuthenticateCommand(cla, alg, ref byte, challenge []byte) *apdu.Command {
+	return apdu.CreateCommand(cla, INSInternalAuthenticate, alg, ref, challenge, apdu.MaxShortNe)
+}
+
+// ExternalAuthenticateCommand builds EXTERNAL AUTHENTICATE presenting the
+// cryptogram data. With ne above zero it is the MUTUAL AUTHENTICATE form
+// where the card answers with its own cryptogram.
+func ExternalAuthenticateCommand(cla, alg, ref byte, data []byte, ne int) *apdu.Command {
+	return apdu.CreateCommand(cla, INSExternalAuthenticate, alg, ref, data, ne)
+}
+
+// GeneralAuthenticateCommand builds GENERAL AUTHENTICATE carrying objs in
+// the dynamic authentication template. When more is set the command
+// chaining bit announces further steps, as in PACE.
+func GeneralAuthenticateCommand(cla, alg, ref byte, objs tlv.List, more bool) (*apdu.Command, error) {
+	data, err := tlv.NewConstructed(TagDynamicAuth, objs...).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if more {
+		cla |= apdu.ClaChaining
+	}
+	return apdu.CreateCommand(cla, INSGeneralAuthenticate, alg, ref, data, apdu.MaxShortNe), nil
+}
+
+// ParseDynamicAuthData returns the data objects of the dynamic
+// authentication template answering GENERAL AUTHENTICATE.
+func ParseDynamicAuthData(data []byte) (tlv.List, error) {
+	objs, err := tlv.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apdu.ErrInvalidResponse, err)
+	}
+	if len(objs) != 1 || objs[0].Tag != TagDynamicAuth {
+		return nil, fmt.Errorf("%w: dynamic authentication template missing", apdu.ErrInvalidResponse)
+	}
+	return objs[0].Children, nil
+}
+
+// GetChallenge returns n random bytes generated by the card. With n 256
+// any non-empty challenge up to 256 bytes is accepted, since Le 00 asks
+// for as many bytes as the card returns.
+func (c *Card) GetChallenge(n int) ([]byte, error) {
+	if n < 1 || n > apdu.MaxShortNe {
+		return nil, fmt.Errorf("%w: challenge of %d bytes", ErrInvalidArgument, n)
+	}
+	resp, err := c.Send(GetChallengeCommand(c.CLA, n))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 || len(resp.Data) > n || n < apdu.MaxShortNe && len(resp.Data) != n {
+		return nil, fmt.Errorf("%w: challenge of %d bytes, want %d", apdu.ErrInvalidResponse, len(resp.Data), n)
+	}
+	return resp.Data, nil
+}
+
+// InternalAuthenticate returns the authentication data the card computes
+// over challenge.
+func (c *Card) InternalAuthenticate(alg, ref byte, challenge []byte) ([]byte, error) {
+	resp, err := c.Send(InternalAuthenticateCommand(c.CLA, alg, ref, challenge))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// ExternalAuthenticate presents the cryptogram computed by the terminal
+// over a challenge of the card.
+func (c *Card) ExternalAuthenticate(alg, ref byte, cryptogram []byte) error {
+	_, err := c.Send(ExternalAuthenticateCommand(c.CLA, alg, ref, cryptogram, 0))
+	return err
+}
+
+// MutualAuthenticate presents the cryptogram of the terminal and returns
+// the cryptogram of the card, as used by BAC.
+func (c *Card) MutualAuthenticate(alg, ref byte, cryptogram []byte) ([]byte, error) {
+	resp, err := c.Send(ExternalAuthenticateCommand(c.CLA, alg, ref, cryptogram, apdu.MaxShortNe))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// GeneralAuthenticate performs one step of GENERAL AUTHENTICATE and
+// returns the data objects of the response template. Set more on every
+// step but the last of a chained protocol.
+func (c *Card) GeneralAuthenticate(alg, ref byte, objs tlv.List, more bool) (tlv.List, error) {
+	cmd, err := GeneralAuthenticateCommand(c.CLA, alg, ref, objs, more)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Send(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDynamicAuthData(resp.Data)
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+func TestAuthenticateCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  func() (*apdu.Command, error)
+		want string
+	}{
+		{
+			name: "GET CHALLENGE",
+			cmd:  func() (*apdu.Command, error) { return GetChallengeCommand(0x00, 8), nil },
+			want: "0084000008",
+		},
+		{
+			name: "INTERNAL AUTHENTICATE",
+			cmd: func() (*apdu.Command, error) {
+				return InternalAuthenticateCommand(0x00, 0x00, 0x00, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}), nil
+			},
+			want: "00880000080102030405060708" + "00",
+		},
+		{
+			name: "EXTERNAL AUTHENTICATE",
+			cmd: func() (*apdu.Command, error) {
+				return ExternalAuthenticateCommand(0x00, 0x00, 0x81, []byte{0xAA, 0xBB}, 0), nil
+			},
+			want: "0082008102AABB",
+		},
+		{
+			name: "GENERAL AUTHENTICATE chained step",
+			cmd: func() (*apdu.Command, error) {
+				return GeneralAuthenticateCommand(0x00, 0x00, 0x00, nil, true)
+			},
+			want: "10860000027C0000",
+		},
+		{
+			name: "GENERAL AUTHENTICATE last step",
+			cmd: func() (*apdu.Command, error) {
+				return GeneralAuthenticateCommand(0x00, 0x00, 0x00, tlv.List{tlv.New(0x85, []byte{0x01, 0x02})}, false)
+			},
+			want: "00860000067C0485020102" + "00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := tt.cmd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, err := apdu.MarshalCommand(cmd)
+			if err != nil || !bytes.Equal(raw, mustHex(t, tt.want)) {
+				t.Errorf("command = %X, %v, want %s", raw, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"0084000008":                    "01020304050607089000",
+		"0084000004":                    "01029000",
+		"0084000000":                    "01020304050607089000",
+		"10860000027C0000":              "7C0A8008AABBCCDDEEFF00119000",
+		"00860000067C0485020102" + "00": "7C0486020304" + "9000",
+		"00860000027C0000":              "0102" + "9000",
+		"008200000401020304" + "00":     "AABB9000",
+		"0082000004FFFFFFFF":            "63C2",
+	}}
+	c := NewCard(card)
+
+	if rnd, err := c.GetChallenge(8); err != nil || len(rnd) != 8 {
+		t.Errorf("GetChallenge() = % X, %v", rnd, err)
+	}
+	if _, err := c.GetChallenge(4); !errors.Is(err, apdu.ErrInvalidResponse) {
+		t.Errorf("GetChallenge() short error = %v", err)
+	}
+	if rnd, err := c.GetChallenge(apdu.MaxShortNe); err != nil || len(rnd) != 8 {
+		t.Errorf("GetChallenge(256) = % X, %v", rnd, err)
+	}
+
+	objs, err := c.GeneralAuthenticate(0x00, 0x00, nil, true)
+	if err != nil || objs.Find(TagAuthWitness) == nil {
+		t.Fatalf("GeneralAuthenticate() = %v, %v", objs, err)
+	}
+	objs, err = c.GeneralAuthenticate(0x00, 0x00, tlv.List{tlv.New(TagAuthExponential, []byte{0x01, 0x02})}, false)
+	if err != nil || !bytes.Equal(objs.Find(0x86).Value, []byte{0x03, 0x04}) {
+		t.Fatalf("GeneralAuthenticate() = %v, %v", objs, err)
+	}
+	if _, err := c.GeneralAuthenticate(0x00, 0x00, nil, false); !errors.Is(err, apdu.ErrInvalidResponse) {
+		t.Errorf("GeneralAuthenticate() without template error = %v", err)
+	}
+
+	if got, err := c.MutualAuthenticate(0x00, 0x00, []byte{0x01, 0x02, 0x03, 0x04}); err != nil || !bytes.Equal(got, []byte{0xAA, 0xBB}) {
+		t.Errorf("MutualAuthenticate() = % X, %v", got, err)
+	}
+	if err := c.ExternalAuthenticate(0x00, 0x00, []byte{0xFF, 0xFF, 0xFF, 0xFF}); !errors.Is(err, apdu.ErrVerificationFailed) {
+		t.Errorf("ExternalAuthenticate() error = %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"sync"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+// Card issues ISO 7816-4 interindustry commands to a card. Commands of
+// one Card, and of the Cards of logical channels opened from it, may be
+// sent from several goroutines: each exchange holds the connection until
+// its response, including any GET RESPONSE, is complete.
+type Card struct {
+	// CLA is the class byte of every command, 00 unless changed for a
+	// logical channel or a proprietary class.
+	CLA byte
+	// SafePIN makes commands presenting a PIN query the retry counter
+	// first and refuse to run when a wrong PIN would block it.
+	SafePIN bool
+
+	t *lockedTransmitter
+}
+
+// NewCard returns a Card sending through t. Status words 61xx and 6Cxx
+// are handled transparently.
+func NewCard(t apdu.Transmitter) *Card {
+	return &Card{t: &lockedTransmitter{t: apdu.NewAutoTransmitter(t, 0)}}
+}
+
+// lockedTransmitter serialises the exchanges of all Cards sharing a connection.
+type lockedTransmitter struct {
+	mu sync.Mutex
+	t  apdu.Transmitter
+}
+
+func (l *lockedTransmitter) Transmit(cmd []byte) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.t.Transmit(cmd)
+}
+
+// transmitChain sends cmd as a command chain of size byte links without
+// letting the exchanges of another Card in between.
+func (l *lockedTransmitter) transmitChain(cmd *apdu.Command, size int) (*apdu.Response, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return apdu.TransmitChain(l.t, cmd, size)
+}
+
+// Send transmits cmd and returns the response. The error is the
+// *apdu.StatusError of any status other than normal processing; the
+// response is returned along with it so warnings can be inspected.
+func (c *Card) Send(cmd *apdu.Command) (*apdu.Response, error) {
+	raw, err := apdu.MarshalCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.t.Transmit(raw)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := apdu.UnmarshalResponse(out)
+	if err != nil {
+		return nil, err
+	}
+	return resp, apdu.CheckStatus(resp.SW1, resp.SW2)
+}
+
+// command builds a command with the class byte of the card.
+func (c *Card) command(ins, p1, p2 byte, data []byte, ne int) *apdu.Command {
+	return apdu.CreateCommand(c.CLA, ins, p1, p2, data, ne)
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+const (
+	// MaxBasicChannel is the last channel coded in the first interindustry class.
+	MaxBasicChannel = 3
+	// MaxChannel is the last channel coded in the further interindustry class.
+	MaxChannel = 19
+)
+
+// IsInterindustryCLA reports whether cla belongs to the first or further
+// interindustry class, the only ones carrying a logical channel number.
+func IsInterindustryCLA(cla byte) bool {
+	return cla&0xE0 == 0x00 || cla&0xC0 == 0x40
+}
+
+// CLAChannel returns the logical channel number coded in an interindustry
+// class byte.
+func CLAChannel(cla byte) int {
+	if cla&0x40 != 0 {
+		return int(cla&0x0F) + MaxBasicChannel + 1
+	}
+	return int(cla & 0x03)
+}
+
+// ChannelCLA recodes the interindustry class byte cla for channel,
+// switching between the first class for channels 0 to 3 and the further
+// class for channels 4 to 19. Command chaining and secure messaging are
+// kept; secure messaging moved to the first class is indicated as
+// "command header not processed", the only format both classes share.
+func ChannelCLA(cla byte, channel int) (byte, error) {
+	if !IsInterindustryCLA(cla) {
+		return 0, fmt.Errorf("%w: class %02X is not interindustry", ErrInvalidArgument, cla)
+	}
+	if channel < 0 || channel > MaxChannel {
+		return 0, fmt.Errorf("%w: logical channel %d", ErrInvalidArgument, channel)
+	}
+	chaining := cla & apdu.ClaChaining
+	sm := cla&0x40 != 0 && cla&0x20 != 0 || cla&0x40 == 0 && cla&0x0C != 0
+
+	if channel <= MaxBasicChannel {
+		out := chaining | byte(channel)
+		switch {
+		case cla&0x40 == 0:
+			out |= cla & 0x0C
+		case sm:
+			out |= 0x08
+		}
+		return out, nil
+	}
+	out := 0x40 | chaining | byte(channel-MaxBasicChannel-1)
+	if sm {
+		out |= 0x20
+	}
+	return out, nil
+}
+
+// Channel returns the logical channel the Card sends its commands on.
+func (c *Card) Channel() int {
+	return CLAChannel(c.CLA)
+}
+
+// OpenChannel opens a logical channel numbered by the card with MANAGE
+// CHANNEL and returns a Card for it sharing the connection of c.
+func (c *Card) OpenChannel() (*Card, error) {
+	resp, err := c.Send(c.command(INSManageChannel, 0x00, 0x00, nil, 1))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != 1 {
+		return nil, fmt.Errorf("%w: MANAGE CHANNEL returned %d bytes", apdu.ErrInvalidResponse, len(resp.Data))
+	}
+	return c.channelCard(int(resp.Data[0]))
+}
+
+// OpenChannelNumber opens the logical channel n with MANAGE CHANNEL.
+func (c *Card) OpenChannelNumber(n int) (*Card, error) {
+	if n < 1 || n > MaxChannel {
+		return nil, fmt.Errorf("%w: logical channel %d", ErrInvalidArgument, n)
+	}
+	if _, err := c.Send(c.command(INSManageChannel, 0x00, byte(n), nil, 0)); err != nil {
+		return nil, err
+	}
+	return c.channelCard(n)
+}
+
+func (c *Card) channelCard(n int) (*Card, error) {
+	cla, err := ChannelCLA(c.CLA, n)
+	if err != nil {
+		return nil, err
+	}
+	return &Card{CLA: cla, SafePIN: c.SafePIN, t: c.t}, nil
+}
+
+// CloseChannel closes the logical channel of the Card, which must not be
+// used afterwards. The basic channel 0 cannot be closed.
+func (c *Card) CloseChannel() error {
+	n := c.Channel()
+	if n == 0 {
+		return fmt.Errorf("%w: the basic channel cannot be closed", ErrInvalidArgument)
+	}
+	_, err := c.Send(c.command(INSManageChannel, 0x80, byte(n), nil, 0))
+	return err
+}
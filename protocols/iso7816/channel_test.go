@@ -0,0 +1,187 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChannelCLA(t *testing.T) {
+	tests := []struct {
+		cla     byte
+		channel int
+		want    byte
+	}{
+		{0x00, 0, 0x00},
+		{0x00, 3, 0x03},
+		{0x10, 2, 0x12},
+		{0x0C, 1, 0x0D},
+		{0x00, 4, 0x40},
+		{0x00, 19, 0x4F},
+		{0x1C, 5, 0x71},
+		{0x61, 0, 0x08},
+		{0x53, 1, 0x11},
+	}
+	for _, tt := range tests {
+		got, err := ChannelCLA(tt.cla, tt.channel)
+		if err != nil || got != tt.want {
+			t.Errorf("ChannelCLA(%02X, %d) = %02X, %v, want %02X", tt.cla, tt.channel, got, err, tt.want)
+		}
+		if CLAChannel(got) != tt.channel {
+			t.Errorf("CLAChannel(%02X) = %d, want %d", got, CLAChannel(got), tt.channel)
+		}
+	}
+	for _, tt := range []struct {
+		cla     byte
+		channel int
+	}{{0x80, 1}, {0xA0, 0}, {0x00, 20}, {0x00, -1}} {
+		if _, err := ChannelCLA(tt.cla, tt.channel); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("ChannelCLA(%02X, %d) error = %v", tt.cla, tt.channel, err)
+		}
+	}
+}
+
+func TestOpenCloseChannel(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"0070000001":       "059000",
+		"00700003":         "9000",
+		"41A4040002A00000": "9000",
+		"41708005":         "9000",
+	}}
+	c := NewCard(card)
+	ch, err := c.OpenChannel()
+	if err != nil {
+		t.Fatalf("OpenChannel() error = %v", err)
+	}
+	if ch.Channel() != 5 || ch.CLA != 0x41 {
+		t.Fatalf("Channel() = %d, CLA %02X", ch.Channel(), ch.CLA)
+	}
+	if _, err := ch.SelectName([]byte{0xA0, 0x00}); err != nil {
+		t.Errorf("SelectName() error = %v", err)
+	}
+	if err := ch.CloseChannel(); err != nil {
+		t.Errorf("CloseChannel() error = %v", err)
+	}
+	if ch3, err := c.OpenChannelNumber(3); err != nil || ch3.CLA != 0x03 {
+		t.Errorf("OpenChannelNumber() = %v, %v", ch3, err)
+	}
+	if err := c.CloseChannel(); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("CloseChannel() on channel 0 error = %v", err)
+	}
+}
+
+// interleaveCard answers every command with 61 01 and expects the GET
+// RESPONSE of the same channel next, failing on interleaved exchanges.
+type interleaveCard struct {
+	mu      sync.Mutex
+	pending int
+	errs    []string
+}
+
+func (c *interleaveCard) Transmit(cmd []byte) ([]byte, error) {
+	if !c.mu.TryLock() {
+		return nil, fmt.Errorf("concurrent Transmit")
+	}
+	defer c.mu.Unlock()
+	ch := CLAChannel(cmd[0])
+	if cmd[1] == 0xC0 {
+		if c.pending != ch {
+			c.errs = append(c.errs, fmt.Sprintf("GET RESPONSE on %d while %d pending", ch, c.pending))
+		}
+		c.pending = -1
+		return []byte{byte(ch), 0x90, 0x00}, nil
+	}
+	if c.pending != -1 {
+		c.errs = append(c.errs, fmt.Sprintf("command on %d while %d pending", ch, c.pending))
+	}
+	c.pending = ch
+	return []byte{0x61, 0x01}, nil
+}
+
+func TestChannelsConcurrent(t *testing.T) {
+	card := &interleaveCard{pending: -1}
+	c := NewCard(card)
+	var wg sync.WaitGroup
+	for _, n := range []int{0, 2, 7} {
+		ch := c
+		if n > 0 {
+			ch, _ = c.channelCard(n)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				data, err := ch.ReadBinary(0, 1)
+				if err != nil || len(data) != 1 || int(data[0]) != ch.Channel() {
+					t.Errorf("channel %d: ReadBinary() = % X, %v", ch.Channel(), data, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, e := range card.errs {
+		t.Error(e)
+	}
+}
+
+// chainCard expects the links of a command chain back to back and fails
+// on commands of another channel sent while a chain is open.
+type chainCard struct {
+	open int
+	errs []string
+}
+
+func (c *chainCard) Transmit(cmd []byte) ([]byte, error) {
+	ch := CLAChannel(cmd[0])
+	if c.open != -1 && c.open != ch {
+		c.errs = append(c.errs, fmt.Sprintf("command on %d inside the chain of %d", ch, c.open))
+	}
+	c.open = -1
+	if cmd[0]&0x10 != 0 {
+		c.open = ch
+		// Long enough for a waiting exchange to be handed the lock.
+		time.Sleep(time.Millisecond)
+	}
+	if cmd[1] == 0xB0 {
+		return []byte{byte(ch), 0x90, 0x00}, nil
+	}
+	return []byte{0x90, 0x00}, nil
+}
+
+func TestChannelsConcurrentChain(t *testing.T) {
+	card := &chainCard{open: -1}
+	c := NewCard(card)
+	ch, _ := c.channelCard(3)
+	long := make([]byte, 600)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := c.Decipher(PaddingNoIndication, long); err != nil {
+				t.Errorf("Decipher() error = %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if _, err := ch.ReadBinary(0, 1); err != nil {
+				t.Errorf("ReadBinary() error = %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	for _, e := range card.errs {
+		t.Error(e)
+	}
+}
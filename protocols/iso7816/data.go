@@ -0,0 +1,235 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+const (
+	// TagTagList is the tag list of the odd INS GET DATA.
+	TagTagList tlv.Tag = 0x5C
+	// TagDiscretionaryData wraps the value of a PIV data object.
+	TagDiscretionaryData tlv.Tag = 0x53
+	// FIDCurrentDF addresses the current DF in P1-P2 of the odd INS forms.
+	FIDCurrentDF = 0x3FFF
+)
+
+// ErrUnknownDataObject is returned when a named data object is not registered.
+var ErrUnknownDataObject = errors.New("iso7816: unknown data object")
+
+// dataP1P2 checks that tag fits P1-P2 of the even INS forms.
+func dataP1P2(tag tlv.Tag) (byte, byte, error) {
+	if tag == 0 || tag > 0xFFFF {
+		return 0, 0, fmt.Errorf("%w: tag %s does not fit P1-P2", ErrInvalidArgument, tag)
+	}
+	return byte(tag >> 8), byte(tag), nil
+}
+
+// GetDataCommand builds GET DATA of the data object tag, coded in P1-P2.
+func GetDataCommand(cla byte, tag tlv.Tag) (*apdu.Command, error) {
+	p1, p2, err := dataP1P2(tag)
+	if err != nil {
+		return nil, err
+	}
+	return apdu.CreateCommand(cla, INSGetData, p1, p2, nil, apdu.MaxShortNe), nil
+}
+
+// PutDataCommand builds PUT DATA of value for the data object tag, coded
+// in P1-P2.
+func PutDataCommand(cla byte, tag tlv.Tag, value []byte) (*apdu.Command, error) {
+	p1, p2, err := dataP1P2(tag)
+	if err != nil {
+		return nil, err
+	}
+	return apdu.CreateCommand(cla, INSPutData, p1, p2, value, 0), nil
+}
+
+// GetDataListCommand builds the odd INS GET DATA of the data objects
+// listed by tags in the file fid, FIDCurrentDF for the current DF.
+func GetDataListCommand(cla byte, fid uint16, tags ...tlv.Tag) (*apdu.Command, error) {
+	var list []byte
+	for _, tag := range tags {
+		if !tag.Valid() {
+			return nil, fmt.Errorf("%w: tag %s", ErrInvalidArgument, tag)
+		}
+		list = append(list, tag.Bytes()...)
+	}
+	data, err := tlv.New(TagTagList, list).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return apdu.CreateCommand(cla, INSGetDataOdd, byte(fid>>8), byte(fid), data, apdu.MaxShortNe), nil
+}
+
+// PutDataObjectsCommand builds the odd INS PUT DATA of objs into the file fid.
+func PutDataObjectsCommand(cla byte, fid uint16, objs tlv.List) (*apdu.Command, error) {
+	data, err := objs.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return apdu.CreateCommand(cla, INSPutDataOdd, byte(fid>>8), byte(fid), data, 0), nil
+}
+
+// GetData returns the response data to GET DATA of tag, which most cards
+// code as the complete data object, tag and length included.
+func (c *Card) GetData(tag tlv.Tag) ([]byte, error) {
+	cmd, err := GetDataCommand(c.CLA, tag)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Send(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// PutData writes value into the data object tag.
+func (c *Card) PutData(tag tlv.Tag, value []byte) error {
+	cmd, err := PutDataCommand(c.CLA, tag, value)
+	if err != nil {
+		return err
+	}
+	_, err = c.sendChained(cmd)
+	return err
+}
+
+// GetDataObjects returns the data objects listed by tags from the file fid.
+func (c *Card) GetDataObjects(fid uint16, tags ...tlv.Tag) (tlv.List, error) {
+	cmd, err := GetDataListCommand(c.CLA, fid, tags...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Send(cmd)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := tlv.Parse(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apdu.ErrInvalidResponse, err)
+	}
+	return objs, nil
+}
+
+// PutDataObjects writes objs into the file fid.
+func (c *Card) PutDataObjects(fid uint16, objs tlv.List) error {
+	cmd, err := PutDataObjectsCommand(c.CLA, fid, objs)
+	if err != nil {
+		return err
+	}
+	_, err = c.sendChained(cmd)
+	return err
+}
+
+// DataObject describes a data object reachable with GET and PUT DATA.
+type DataObject struct {
+	Tag tlv.Tag
+	// FID selects the odd INS forms addressing the object in that file,
+	// as PIV does with FIDCurrentDF; zero uses the even INS forms.
+	FID uint16
+	// Wrapper is the tag carrying the value in the odd INS forms,
+	// TagDiscretionaryData for PIV. PUT DATA then sends the tag list
+	// followed by the wrapper. Zero exchanges the data object itself.
+	Wrapper     tlv.Tag
+	Description string
+}
+
+// Dictionary names the data objects of an application.
+type Dictionary struct {
+	Name    string
+	Objects map[string]DataObject
+}
+
+var (
+	dictionariesMu sync.RWMutex
+	dictionaries   = map[string]*Dictionary{}
+)
+
+// RegisterDictionary makes the data objects of d available by name,
+// replacing a dictionary of the same name. Application packages call it
+// from init.
+func RegisterDictionary(d *Dictionary) {
+	dictionariesMu.Lock()
+	defer dictionariesMu.Unlock()
+	dictionaries[d.Name] = d
+}
+
+// LookupDataObject returns the data object name of the dictionary dict.
+func LookupDataObject(dict, name string) (DataObject, bool) {
+	dictionariesMu.RLock()
+	defer dictionariesMu.RUnlock()
+	d, ok := dictionaries[dict]
+	if !ok {
+		return DataObject{}, false
+	}
+	do, ok := d.Objects[name]
+	return do, ok
+}
+
+func lookupDataObject(dict, name string) (DataObject, error) {
+	do, ok := LookupDataObject(dict, name)
+	if !ok {
+		return DataObject{}, fmt.Errorf("%w: %s %q", ErrUnknownDataObject, dict, name)
+	}
+	return do, nil
+}
+
+// GetNamedData returns the value of the data object name registered in
+// the dictionary dict. Responses to the even INS form that are not coded
+// as the data object itself are returned as they are.
+func (c *Card) GetNamedData(dict, name string) ([]byte, error) {
+	do, err := lookupDataObject(dict, name)
+	if err != nil {
+		return nil, err
+	}
+	if do.FID == 0 {
+		data, err := c.GetData(do.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if objs, err := tlv.Parse(data); err == nil && len(objs) == 1 && objs[0].Tag == do.Tag {
+			return objs[0].Value, nil
+		}
+		return data, nil
+	}
+	objs, err := c.GetDataObjects(do.FID, do.Tag)
+	if err != nil {
+		return nil, err
+	}
+	tag := do.Tag
+	if do.Wrapper != 0 {
+		tag = do.Wrapper
+	}
+	o := objs.Find(tag)
+	if o == nil {
+		return nil, fmt.Errorf("%w: %s missing from response", apdu.ErrInvalidResponse, tag)
+	}
+	return o.Value, nil
+}
+
+// PutNamedData writes value into the data object name registered in the
+// dictionary dict.
+func (c *Card) PutNamedData(dict, name string, value []byte) error {
+	do, err := lookupDataObject(dict, name)
+	if err != nil {
+		return err
+	}
+	if do.FID == 0 {
+		return c.PutData(do.Tag, value)
+	}
+	if do.Wrapper == 0 {
+		return c.PutDataObjects(do.FID, tlv.List{tlv.New(do.Tag, value)})
+	}
+	return c.PutDataObjects(do.FID, tlv.List{
+		tlv.New(TagTagList, do.Tag.Bytes()),
+		tlv.New(do.Wrapper, value),
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+func TestDataCommands(t *testing.T) {
+	mustCmd := func(cmd *apdu.Command, err error) *apdu.Command {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+	tests := []struct {
+		name string
+		cmd  *apdu.Command
+		want string
+	}{
+		{"get", mustCmd(GetDataCommand(0x80, 0x9F36)), "80CA9F3600"},
+		{"get one byte tag", mustCmd(GetDataCommand(0x00, 0x6E)), "00CA006E00"},
+		{"put", mustCmd(PutDataCommand(0x00, 0x5B, []byte("Doe"))), "00DA005B03446F65"},
+		{"get list", mustCmd(GetDataListCommand(0x00, FIDCurrentDF, 0x5FC105)), "00CB3FFF055C035FC10500"},
+		{"put objects", mustCmd(PutDataObjectsCommand(0x00, FIDCurrentDF, tlv.List{
+			tlv.New(0x5C, []byte{0x5F, 0xC1, 0x05}),
+			tlv.New(0x53, []byte{0x01}),
+		})), "00DB3FFF085C035FC105530101"},
+	}
+	for _, tt := range tests {
+		raw, err := apdu.MarshalCommand(tt.cmd)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(raw, mustHex(t, tt.want)) {
+			t.Errorf("%s = %X, want %s", tt.name, raw, tt.want)
+		}
+	}
+	if _, err := GetDataCommand(0x00, 0x5FC105); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("GetDataCommand(3 byte tag) error = %v", err)
+	}
+}
+
+func TestNamedData(t *testing.T) {
+	RegisterDictionary(&Dictionary{
+		Name: "test",
+		Objects: map[string]DataObject{
+			"counter": {Tag: 0x9F36},
+			"chuid":   {Tag: 0x5FC102, FID: FIDCurrentDF, Wrapper: TagDiscretionaryData},
+		},
+	})
+	card := &tableCard{t: t, responses: map[string]string{
+		"00CA9F3600":                     "9F360200119000",
+		"00CB3FFF055C035FC10200":         "5303AABBCC9000",
+		"00DB3FFF0A5C035FC1025303010203": "9000",
+	}}
+	c := NewCard(card)
+
+	if got, err := c.GetNamedData("test", "counter"); err != nil || !bytes.Equal(got, []byte{0x00, 0x11}) {
+		t.Errorf("GetNamedData(counter) = % X, %v", got, err)
+	}
+	if got, err := c.GetNamedData("test", "chuid"); err != nil || !bytes.Equal(got, []byte{0xAA, 0xBB, 0xCC}) {
+		t.Errorf("GetNamedData(chuid) = % X, %v", got, err)
+	}
+	if err := c.PutNamedData("test", "chuid", []byte{1, 2, 3}); err != nil {
+		t.Errorf("PutNamedData(chuid) error = %v", err)
+	}
+	if _, err := c.GetNamedData("test", "missing"); !errors.Is(err, ErrUnknownDataObject) {
+		t.Errorf("GetNamedData(missing) error = %v", err)
+	}
+	if _, err := c.GetData(0x0101); !errors.Is(err, apdu.ErrFileNotFound) {
+		t.Errorf("GetData(unknown) error = %v", err)
+	}
+}
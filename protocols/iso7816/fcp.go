@@ -0,0 +1,308 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// ErrInvalidFileInfo is returned when FCP, FCI or FMD templates cannot be decoded.
+var ErrInvalidFileInfo = errors.New("iso7816: invalid file control information")
+
+// File control templates and the data objects they carry, ISO 7816-4 table 12.
+const (
+	TagFCP tlv.Tag = 0x62
+	TagFMD tlv.Tag = 0x64
+	TagFCI tlv.Tag = 0x6F
+
+	TagFileSize              tlv.Tag = 0x80
+	TagFileTotalSize         tlv.Tag = 0x81
+	TagFileDescriptor        tlv.Tag = 0x82
+	TagFileID                tlv.Tag = 0x83
+	TagDFName                tlv.Tag = 0x84
+	TagProprietary           tlv.Tag = 0x85
+	TagSecurityProprietary   tlv.Tag = 0x86
+	TagShortFileID           tlv.Tag = 0x88
+	TagLifeCycle             tlv.Tag = 0x8A
+	TagSecurityReference     tlv.Tag = 0x8B
+	TagSecurityCompact       tlv.Tag = 0x8C
+	TagSecurityEnvironmentID tlv.Tag = 0x8D
+	TagProprietaryTemplate   tlv.Tag = 0xA5
+	TagSecurityExpanded      tlv.Tag = 0xAB
+)
+
+// FileType is the category of a file given by its descriptor byte.
+type FileType uint8
+
+const (
+	FileTypeUnknown FileType = iota
+	FileTypeWorkingEF
+	FileTypeInternalEF
+	FileTypeDF
+)
+
+// String returns the name of the file type.
+func (t FileType) String() string {
+	switch t {
+	case FileTypeWorkingEF:
+		return "working EF"
+	case FileTypeInternalEF:
+		return "internal EF"
+	case FileTypeDF:
+		return "DF"
+	}
+	return "unknown"
+}
+
+// FileStructure is the EF structure coded in bits 3 to 1 of the file
+// descriptor byte.
+type FileStructure uint8
+
+const (
+	StructureNone FileStructure = iota
+	StructureTransparent
+	StructureLinearFixed
+	StructureLinearFixedTLV
+	StructureLinearVariable
+	StructureLinearVariableTLV
+	StructureCyclic
+	StructureCyclicTLV
+)
+
+// String returns the name of the structure.
+func (s FileStructure) String() string {
+	switch s {
+	case StructureTransparent:
+		return "transparent"
+	case StructureLinearFixed:
+		return "linear fixed"
+	case StructureLinearFixedTLV:
+		return "linear fixed, SIMPLE-TLV"
+	case StructureLinearVariable:
+		return "linear variable"
+	case StructureLinearVariableTLV:
+		return "linear variable, SIMPLE-TLV"
+	case StructureCyclic:
+		return "cyclic"
+	case StructureCyclicTLV:
+		return "cyclic, SIMPLE-TLV"
+	}
+	return "no information"
+}
+
+// IsRecord reports whether the structure holds records.
+func (s FileStructure) IsRecord() bool {
+	return s >= StructureLinearFixed
+}
+
+// LifeCycle is the life cycle status byte, ISO 7816-4 table 13.
+type LifeCycle byte
+
+// String returns the life cycle state.
+func (l LifeCycle) String() string {
+	switch {
+	case l == 0x00:
+		return "no information"
+	case l == 0x01:
+		return "creation"
+	case l == 0x03:
+		return "initialisation"
+	case l&0xFD == 0x05:
+		return "operational, activated"
+	case l&0xFD == 0x04:
+		return "operational, deactivated"
+	case l&0xFC == 0x0C:
+		return "termination"
+	case l >= 0x10:
+		return "proprietary"
+	}
+	return "RFU"
+}
+
+// Activated reports whether the file is in the operational activated state.
+func (l LifeCycle) Activated() bool {
+	return l&0xFD == 0x05
+}
+
+// FileInfo is the decoded file control information returned by SELECT.
+type FileInfo struct {
+	// Template is the tag of the outer template: TagFCP, TagFMD or TagFCI.
+	Template tlv.Tag
+	// Descriptor is the file descriptor byte, zero when absent.
+	Descriptor byte
+	Type       FileType
+	Structure  FileStructure
+	Shareable  bool
+	DataCoding byte
+	// MaxRecordSize and Records are given for record based EFs.
+	MaxRecordSize int
+	Records       int
+	FID           uint16
+	HasFID        bool
+	DFName        []byte
+	// Size is the number of data bytes without structural information
+	// and TotalSize the number including it; -1 when absent.
+	Size      int
+	TotalSize int
+	// SFI is the short EF identifier, zero when the EF has none or did
+	// not announce it.
+	SFI       byte
+	LifeCycle LifeCycle
+	// Security attributes in the formats present in the template.
+	SecurityCompact     []byte
+	SecurityExpanded    []byte
+	SecurityReference   []byte
+	SecurityProprietary []byte
+	Proprietary         []byte
+	// Objects holds every data object of the template for anything not
+	// decoded above.
+	Objects tlv.List
+}
+
+// IsDF reports whether the file is a dedicated file.
+func (f *FileInfo) IsDF() bool {
+	return f.Type == FileTypeDF || f.Type == FileTypeUnknown && f.DFName != nil
+}
+
+// String summarises the file for listings.
+func (f *FileInfo) String() string {
+	s := f.Type.String()
+	if f.HasFID {
+		s = fmt.Sprintf("%04X %s", f.FID, s)
+	}
+	if f.DFName != nil {
+		s += fmt.Sprintf(" name %X", f.DFName)
+	}
+	if f.Structure != StructureNone {
+		s += ", " + f.Structure.String()
+	}
+	if f.Structure.IsRecord() && f.Records > 0 {
+		s += fmt.Sprintf(", %d records of %d bytes", f.Records, f.MaxRecordSize)
+	} else if f.Size >= 0 {
+		s += fmt.Sprintf(", %d bytes", f.Size)
+	}
+	if f.SFI != 0 {
+		s += fmt.Sprintf(", SFI %02X", f.SFI)
+	}
+	if f.LifeCycle != 0 {
+		s += ", " + f.LifeCycle.String()
+	}
+	return s
+}
+
+// ParseFileInfo decodes an FCP, FMD or FCI template. Templates nested in
+// an FCI are merged, and a response without any template is decoded as
+// a bare list of file control parameters.
+func ParseFileInfo(data []byte) (*FileInfo, error) {
+	objs, err := tlv.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFileInfo, err)
+	}
+	f := &FileInfo{Size: -1, TotalSize: -1}
+	if len(objs) == 1 && (objs[0].Tag == TagFCP || objs[0].Tag == TagFMD || objs[0].Tag == TagFCI) {
+		f.Template = objs[0].Tag
+		objs = objs[0].Children
+	}
+	f.Objects = objs
+
+	for _, o := range objs {
+		if o.Tag == TagFCP || o.Tag == TagFMD {
+			for _, c := range o.Children {
+				if err := f.decode(c); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := f.decode(o); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *FileInfo) decode(o *tlv.Object) error {
+	v := o.Value
+	switch o.Tag {
+	case TagFileSize:
+		f.Size = beInt(v)
+	case TagFileTotalSize:
+		f.TotalSize = beInt(v)
+	case TagFileDescriptor:
+		if len(v) == 0 || len(v) > 6 {
+			return fmt.Errorf("%w: file descriptor of %d bytes", ErrInvalidFileInfo, len(v))
+		}
+		f.setDescriptor(v[0])
+		if len(v) > 1 {
+			f.DataCoding = v[1]
+		}
+		switch len(v) {
+		case 3:
+			f.MaxRecordSize = int(v[2])
+		case 4:
+			f.MaxRecordSize = beInt(v[2:4])
+		case 5:
+			f.MaxRecordSize, f.Records = beInt(v[2:4]), int(v[4])
+		case 6:
+			f.MaxRecordSize, f.Records = beInt(v[2:4]), beInt(v[4:6])
+		}
+	case TagFileID:
+		if len(v) != 2 {
+			return fmt.Errorf("%w: file identifier of %d bytes", ErrInvalidFileInfo, len(v))
+		}
+		f.FID, f.HasFID = uint16(v[0])<<8|uint16(v[1]), true
+	case TagDFName:
+		f.DFName = v
+	case TagShortFileID:
+		if len(v) == 1 {
+			f.SFI = v[0] >> 3
+		}
+	case TagLifeCycle:
+		if len(v) == 1 {
+			f.LifeCycle = LifeCycle(v[0])
+		}
+	case TagSecurityCompact:
+		f.SecurityCompact = v
+	case TagSecurityExpanded:
+		f.SecurityExpanded = v
+	case TagSecurityReference:
+		f.SecurityReference = v
+	case TagSecurityProprietary:
+		f.SecurityProprietary = v
+	case TagProprietary, TagProprietaryTemplate:
+		f.Proprietary = v
+	}
+	return nil
+}
+
+func (f *FileInfo) setDescriptor(b byte) {
+	f.Descriptor = b
+	if b&0x80 != 0 {
+		return // proprietary coding
+	}
+	f.Shareable = b&0x40 != 0
+	switch b >> 3 & 0x07 {
+	case 0x00:
+		f.Type = FileTypeWorkingEF
+	case 0x01:
+		f.Type = FileTypeInternalEF
+	case 0x07:
+		f.Type = FileTypeDF
+		return
+	}
+	f.Structure = FileStructure(b & 0x07)
+}
+
+// beInt decodes a big endian unsigned integer of up to four bytes.
+func beInt(b []byte) int {
+	n := 0
+	for _, x := range b {
+		n = n<<8 | int(x)
+	}
+	return n
+}
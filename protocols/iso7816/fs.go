@@ -0,0 +1,399 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+// FIDMasterFile is the file identifier reserved for the MF.
+const FIDMasterFile = 0x3F00
+
+// maxBinaryOffset is the largest offset READ and UPDATE BINARY encode in P1-P2.
+const maxBinaryOffset = 0x7FFF
+
+// ErrInvalidArgument is returned when a command parameter cannot be encoded.
+var ErrInvalidArgument = errors.New("iso7816: invalid argument")
+
+// SelectMethod is the selection method coded in P1 of SELECT.
+type SelectMethod byte
+
+const (
+	SelectByFID      SelectMethod = 0x00
+	SelectChildDF    SelectMethod = 0x01
+	SelectChildEF    SelectMethod = 0x02
+	SelectParentDF   SelectMethod = 0x03
+	SelectByDFName   SelectMethod = 0x04
+	SelectPathFromMF SelectMethod = 0x08
+	SelectPathFromDF SelectMethod = 0x09
+)
+
+// SelectReturn is the response requested in P2 of SELECT, combined with
+// one of the Occurrence values.
+type SelectReturn byte
+
+const (
+	ReturnFCI  SelectReturn = 0x00
+	ReturnFCP  SelectReturn = 0x04
+	ReturnFMD  SelectReturn = 0x08
+	ReturnNone SelectReturn = 0x0C
+)
+
+// Occurrence selects among several DFs matching a partial DF name.
+const (
+	OccurrenceFirst    SelectReturn = 0x00
+	OccurrenceLast     SelectReturn = 0x01
+	OccurrenceNext     SelectReturn = 0x02
+	OccurrencePrevious SelectReturn = 0x03
+)
+
+// Select issues SELECT with the given method and data and decodes the
+// returned file control information. With ReturnNone the FileInfo is
+// empty apart from its size fields set to -1. On a warning status such
+// as 6283, selected file deactivated, the file is selected all the same:
+// the FileInfo is returned together with the *apdu.StatusError.
+func (c *Card) Select(method SelectMethod, data []byte, ret SelectReturn) (*FileInfo, error) {
+	ne := apdu.MaxShortNe
+	if ret&0x0C == ReturnNone {
+		ne = 0
+	}
+	resp, err := c.Send(c.command(INSSelect, byte(method), byte(ret), data, ne))
+	var se *apdu.StatusError
+	if err != nil && !(errors.As(err, &se) && se.Category == apdu.CategoryWarning) {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return &FileInfo{Size: -1, TotalSize: -1}, err
+	}
+	info, perr := ParseFileInfo(resp.Data)
+	if perr != nil {
+		return nil, perr
+	}
+	return info, err
+}
+
+// SelectMF selects the master file.
+func (c *Card) SelectMF() (*FileInfo, error) {
+	return c.Select(SelectByFID, nil, ReturnFCP)
+}
+
+// SelectFID selects a file by identifier among the children and the
+// parent of the current DF.
+func (c *Card) SelectFID(fid uint16) (*FileInfo, error) {
+	return c.Select(SelectByFID, fidBytes(fid), ReturnFCP)
+}
+
+// SelectChild selects a DF, or an EF when ef is set, under the current DF.
+func (c *Card) SelectChild(fid uint16, ef bool) (*FileInfo, error) {
+	method := SelectChildDF
+	if ef {
+		method = SelectChildEF
+	}
+	return c.Select(method, fidBytes(fid), ReturnFCP)
+}
+
+// SelectParent selects the parent DF of the current DF.
+func (c *Card) SelectParent() (*FileInfo, error) {
+	return c.Select(SelectParentDF, nil, ReturnFCP)
+}
+
+// SelectName selects the first DF, typically an application, whose name
+// starts with name.
+func (c *Card) SelectName(name []byte) (*FileInfo, error) {
+	return c.Select(SelectByDFName, name, ReturnFCI|OccurrenceFirst)
+}
+
+// SelectNextName selects the next DF whose name starts with name.
+func (c *Card) SelectNextName(name []byte) (*FileInfo, error) {
+	return c.Select(SelectByDFName, name, ReturnFCI|OccurrenceNext)
+}
+
+// SelectPath selects a file by path. A path starting with the MF
+// identifier is absolute, otherwise it is relative to the current DF.
+func (c *Card) SelectPath(path ...uint16) (*FileInfo, error) {
+	method := SelectPathFromDF
+	if len(path) > 0 && path[0] == FIDMasterFile {
+		method, path = SelectPathFromMF, path[1:]
+	}
+	if len(path) == 0 {
+		return c.SelectMF()
+	}
+	data := make([]byte, 0, 2*len(path))
+	for _, fid := range path {
+		data = append(data, fidBytes(fid)...)
+	}
+	return c.Select(method, data, ReturnFCP)
+}
+
+func fidBytes(fid uint16) []byte {
+	return []byte{byte(fid >> 8), byte(fid)}
+}
+
+// ReadBinary reads up to n bytes, or 256 when n is zero, from offset of
+// the current transparent EF. At the end of the file the data read is
+// returned with the apdu.ErrEndOfFile warning.
+func (c *Card) ReadBinary(offset, n int) ([]byte, error) {
+	if offset < 0 || offset > maxBinaryOffset {
+		return nil, fmt.Errorf("%w: offset %d", ErrInvalidArgument, offset)
+	}
+	return c.readBinary(byte(offset>>8), byte(offset), n)
+}
+
+// ReadBinarySFI reads from the EF with the short identifier sfi, which
+// becomes the current EF. The offset is limited to 255.
+func (c *Card) ReadBinarySFI(sfi byte, offset, n int) ([]byte, error) {
+	if sfi == 0 || sfi > 30 || offset < 0 || offset > 0xFF {
+		return nil, fmt.Errorf("%w: SFI %d, offset %d", ErrInvalidArgument, sfi, offset)
+	}
+	return c.readBinary(0x80|sfi, byte(offset), n)
+}
+
+func (c *Card) readBinary(p1, p2 byte, n int) ([]byte, error) {
+	if n <= 0 {
+		n = apdu.MaxShortNe
+	}
+	resp, err := c.Send(c.command(INSReadBinary, p1, p2, nil, n))
+	if resp == nil {
+		return nil, err
+	}
+	return resp.Data, err
+}
+
+// ReadFile reads the current transparent EF from the start. When size
+// is zero or less it reads until the card reports the end of the file.
+func (c *Card) ReadFile(size int) ([]byte, error) {
+	var out []byte
+	for (size <= 0 || len(out) < size) && len(out) <= maxBinaryOffset {
+		n := apdu.MaxShortNe
+		if size > 0 {
+			n = min(n, size-len(out))
+		}
+		data, err := c.ReadBinary(len(out), n)
+		out = append(out, data...)
+		switch {
+		case errors.Is(err, apdu.ErrEndOfFile), errors.Is(err, apdu.ErrWrongParameters) && size <= 0:
+			return out, nil
+		case err != nil:
+			return out, err
+		case len(data) == 0:
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// UpdateBinary writes data at offset of the current transparent EF,
+// splitting it into commands of at most 255 bytes.
+func (c *Card) UpdateBinary(offset int, data []byte) error {
+	for len(data) > 0 {
+		if offset < 0 || offset > maxBinaryOffset {
+			return fmt.Errorf("%w: offset %d", ErrInvalidArgument, offset)
+		}
+		n := min(len(data), apdu.MaxShortNc)
+		if _, err := c.Send(c.command(INSUpdateBinary, byte(offset>>8), byte(offset), data[:n], 0)); err != nil {
+			return err
+		}
+		offset += n
+		data = data[n:]
+	}
+	return nil
+}
+
+// UpdateBinarySFI writes data at offset of the EF with the short
+// identifier sfi, which becomes the current EF.
+func (c *Card) UpdateBinarySFI(sfi byte, offset int, data []byte) error {
+	if sfi == 0 || sfi > 30 || offset < 0 || offset > 0xFF || len(data) > apdu.MaxShortNc {
+		return fmt.Errorf("%w: SFI %d, offset %d", ErrInvalidArgument, sfi, offset)
+	}
+	_, err := c.Send(c.command(INSUpdateBinary, 0x80|sfi, byte(offset), data, 0))
+	return err
+}
+
+// recordP2 codes the short EF identifier, zero for the current EF, and
+// the record reference mode of READ, UPDATE and SEARCH RECORD.
+func recordP2(sfi, mode byte) (byte, error) {
+	if sfi > 30 {
+		return 0, fmt.Errorf("%w: SFI %d", ErrInvalidArgument, sfi)
+	}
+	return sfi<<3 | mode, nil
+}
+
+// ReadRecord reads record number rec of the EF identified by sfi, or of
+// the current EF when sfi is zero.
+func (c *Card) ReadRecord(sfi byte, rec int) ([]byte, error) {
+	p2, err := recordP2(sfi, 0x04)
+	if err != nil {
+		return nil, err
+	}
+	if rec < 1 || rec > 0xFE {
+		return nil, fmt.Errorf("%w: record %d", ErrInvalidArgument, rec)
+	}
+	resp, err := c.Send(c.command(INSReadRecord, byte(rec), p2, nil, apdu.MaxShortNe))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// ReadRecords reads all records of an EF from record 1 until the card
+// reports the record is not found.
+func (c *Card) ReadRecords(sfi byte) ([][]byte, error) {
+	var out [][]byte
+	for rec := 1; rec <= 0xFE; rec++ {
+		data, err := c.ReadRecord(sfi, rec)
+		if errors.Is(err, apdu.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+// UpdateRecord replaces record number rec of the EF identified by sfi,
+// or of the current EF when sfi is zero.
+func (c *Card) UpdateRecord(sfi byte, rec int, data []byte) error {
+	p2, err := recordP2(sfi, 0x04)
+	if err != nil {
+		return err
+	}
+	if rec < 1 || rec > 0xFE {
+		return fmt.Errorf("%w: record %d", ErrInvalidArgument, rec)
+	}
+	_, err = c.Send(c.command(INSUpdateRecord, byte(rec), p2, data, 0))
+	return err
+}
+
+// AppendRecord adds a record at the end of a linear EF, or writes the
+// oldest record of a cyclic EF.
+func (c *Card) AppendRecord(sfi byte, data []byte) error {
+	p2, err := recordP2(sfi, 0x00)
+	if err != nil {
+		return err
+	}
+	_, err = c.Send(c.command(INSAppendRecord, 0x00, p2, data, 0))
+	return err
+}
+
+// SearchRecord performs a simple search for pattern in the records of
+// an EF starting at record from and returns the numbers of the matching
+// records.
+func (c *Card) SearchRecord(sfi byte, from int, pattern []byte) ([]int, error) {
+	p2, err := recordP2(sfi, 0x04)
+	if err != nil {
+		return nil, err
+	}
+	if from < 1 || from > 0xFE || len(pattern) == 0 {
+		return nil, fmt.Errorf("%w: record %d, %d byte pattern", ErrInvalidArgument, from, len(pattern))
+	}
+	resp, err := c.Send(c.command(INSSearchRecord, byte(from), p2, pattern, apdu.MaxShortNe))
+	if err != nil {
+		if errors.Is(err, apdu.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	recs := make([]int, len(resp.Data))
+	for i, b := range resp.Data {
+		recs[i] = int(b)
+	}
+	return recs, nil
+}
+
+// MaxWalkDepth limits how deep Walk descends into nested DFs.
+const MaxWalkDepth = 8
+
+// WalkFunc is called by Walk for every file found. The path starts with
+// the MF identifier.
+type WalkFunc func(path []uint16, info *FileInfo) error
+
+// Walk explores the file system below the MF. Since ISO 7816-4 has no
+// directory listing, each DF is probed for the candidate identifiers by
+// absolute path selection; files which are missing or not accessible
+// are skipped, files selected with a warning such as deactivated ones
+// are walked. Walk stops at the first error returned by fn or by the
+// transport.
+func (c *Card) Walk(candidates []uint16, fn WalkFunc) error {
+	info, err := c.SelectMF()
+	if info == nil {
+		return err
+	}
+	root := []uint16{FIDMasterFile}
+	if err := fn(root, info); err != nil {
+		return err
+	}
+	return c.walk(root, candidates, fn)
+}
+
+func (c *Card) walk(dir, candidates []uint16, fn WalkFunc) error {
+	if len(dir) > MaxWalkDepth {
+		return nil
+	}
+	for _, fid := range candidates {
+		if fid == FIDMasterFile || fid == 0x3FFF || fid == 0xFFFF || pathContains(dir, fid) {
+			continue
+		}
+		path := append(append([]uint16(nil), dir...), fid)
+		info, err := c.SelectPath(path...)
+		var se *apdu.StatusError
+		if info == nil && errors.As(err, &se) {
+			continue
+		}
+		if info == nil {
+			return err
+		}
+		if err := fn(path, info); err != nil {
+			return err
+		}
+		if info.IsDF() {
+			if err := c.walk(path, candidates, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func pathContains(path []uint16, fid uint16) bool {
+	for _, p := range path {
+		if p == fid {
+			return true
+		}
+	}
+	return false
+}
+
+// Dump writes an indented listing of the file system found by Walk.
+func (c *Card) Dump(w io.Writer, candidates []uint16) error {
+	return c.Walk(candidates, func(path []uint16, info *FileInfo) error {
+		// FileInfo prints the identifier, which the FCP may leave out.
+		f := *info
+		f.FID, f.HasFID = path[len(path)-1], true
+		_, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", len(path)-1), &f)
+		return err
+	})
+}
+
+// FIDRange returns the file identifiers from first to last inclusive,
+// for use as Walk candidates.
+func FIDRange(first, last uint16) []uint16 {
+	if last < first {
+		return nil
+	}
+	out := make([]uint16, 0, int(last-first)+1)
+	for fid := first; ; fid++ {
+		out = append(out, fid)
+		if fid == last {
+			return out
+		}
+	}
+}
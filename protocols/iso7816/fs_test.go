@@ -0,0 +1,215 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+// tableCard answers commands from a table keyed by the hex encoded
+// command and records what it received. Unknown commands get 6A82.
+type tableCard struct {
+	t         *testing.T
+	responses map[string]string
+	received  []string
+}
+
+func (c *tableCard) Transmit(cmd []byte) ([]byte, error) {
+	key := strings.ToUpper(hex.EncodeToString(cmd))
+	c.received = append(c.received, key)
+	resp, ok := c.responses[key]
+	if !ok {
+		resp = "6A82"
+	}
+	b, err := hex.DecodeString(resp)
+	if err != nil {
+		c.t.Fatalf("bad response %q: %v", resp, err)
+	}
+	return b, nil
+}
+
+func TestParseFileInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "transparent EF",
+			data: "620F8202010183022F00800200208A0105",
+			want: "2F00 working EF, transparent, 32 bytes, operational, activated",
+		},
+		{
+			name: "linear fixed EF with SFI",
+			data: "621682054221001A0483026F3A8A01058801508C03030101",
+			want: "6F3A working EF, linear fixed, 4 records of 26 bytes, SFI 0A, operational, activated",
+		},
+		{
+			name: "DF in FCI",
+			data: "6F1584074F50454E504750620A820138830250008A0105",
+			want: "5000 DF name 4F50454E504750, operational, activated",
+		},
+		{
+			name: "application FCI without FCP",
+			data: "6F108407A0000000041010A5055003414243",
+			want: "unknown name A0000000041010",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.data)
+			f, err := ParseFileInfo(data)
+			if err != nil {
+				t.Fatalf("ParseFileInfo() error = %v", err)
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	data, _ := hex.DecodeString("621682054221001A0483026F3A8A01058801508C03030101")
+	f, _ := ParseFileInfo(data)
+	if !bytes.Equal(f.SecurityCompact, []byte{0x03, 0x01, 0x01}) || f.DataCoding != 0x21 || f.Shareable != true {
+		t.Errorf("FileInfo = %+v", f)
+	}
+
+	if _, err := ParseFileInfo([]byte{0x62, 0x03, 0x83, 0x01, 0x3F}); !errors.Is(err, ErrInvalidFileInfo) {
+		t.Errorf("ParseFileInfo() error = %v, want %v", err, ErrInvalidFileInfo)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"00A40804047F106F3A00":       "6204830260AA9000",
+		"00A40004023F0000":           "6204830260AA9000",
+		"00A4040007A000000004101000": "9000",
+		"00A4030400":                 "6204830260AA9000",
+		"00A40004027F3000":           "620782013883027F306283",
+	}}
+	c := NewCard(card)
+	if _, err := c.SelectPath(FIDMasterFile, 0x7F10, 0x6F3A); err != nil {
+		t.Errorf("SelectPath() error = %v", err)
+	}
+	if _, err := c.SelectFID(FIDMasterFile); err != nil {
+		t.Errorf("SelectFID() error = %v", err)
+	}
+	if _, err := c.SelectName([]byte{0xA0, 0x00, 0x00, 0x00, 0x04, 0x10, 0x10}); err != nil {
+		t.Errorf("SelectName() error = %v", err)
+	}
+	if _, err := c.SelectParent(); err != nil {
+		t.Errorf("SelectParent() error = %v", err)
+	}
+	if _, err := c.Select(SelectPathFromMF, nil, ReturnNone); err == nil {
+		// 00 A4 08 0C has no table entry.
+		t.Errorf("Select() error = nil")
+	}
+	if info, err := c.SelectFID(0x7F30); !errors.Is(err, apdu.ErrFileDeactivated) || info == nil || info.FID != 0x7F30 {
+		t.Errorf("SelectFID(deactivated) = %v, %v", info, err)
+	}
+	if _, err := c.SelectChild(0x1234, true); !errors.Is(err, apdu.ErrFileNotFound) {
+		t.Errorf("SelectChild() error = %v, want %v", err, apdu.ErrFileNotFound)
+	}
+}
+
+func TestReadUpdateBinary(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"00B0000000":       strings.Repeat("AB", 256) + "9000",
+		"00B0010000":       "CDCD6282",
+		"00B0000302":       "01029000",
+		"00B0850000":       "EEEE9000",
+		"00D6000102AABB":   "9000",
+		"00D6850003AABBCC": "9000",
+	}}
+	c := NewCard(card)
+
+	data, err := c.ReadFile(0)
+	if err != nil || len(data) != 258 || data[257] != 0xCD {
+		t.Errorf("ReadFile() = %d bytes, %v", len(data), err)
+	}
+	if data, err := c.ReadBinary(3, 2); err != nil || !bytes.Equal(data, []byte{0x01, 0x02}) {
+		t.Errorf("ReadBinary() = % X, %v", data, err)
+	}
+	if data, err := c.ReadBinarySFI(5, 0, 0); err != nil || !bytes.Equal(data, []byte{0xEE, 0xEE}) {
+		t.Errorf("ReadBinarySFI() = % X, %v", data, err)
+	}
+	if err := c.UpdateBinary(1, []byte{0xAA, 0xBB}); err != nil {
+		t.Errorf("UpdateBinary() error = %v", err)
+	}
+	if err := c.UpdateBinarySFI(5, 0, []byte{0xAA, 0xBB, 0xCC}); err != nil {
+		t.Errorf("UpdateBinarySFI() error = %v", err)
+	}
+	if _, err := c.ReadBinary(0x8000, 1); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("ReadBinary() error = %v, want %v", err, ErrInvalidArgument)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"00B2010C00":     "70039F01019000",
+		"00B2020C00":     "70039F01029000",
+		"00B2030C00":     "6A83",
+		"00DC0204020102": "9000",
+		"00E2000002AABB": "9000",
+		"00A2010C01AA00": "01039000",
+	}}
+	c := NewCard(card)
+
+	recs, err := c.ReadRecords(1)
+	if err != nil || len(recs) != 2 || recs[1][4] != 0x02 {
+		t.Errorf("ReadRecords() = % X, %v", recs, err)
+	}
+	if err := c.UpdateRecord(0, 2, []byte{0x01, 0x02}); err != nil {
+		t.Errorf("UpdateRecord() error = %v", err)
+	}
+	if err := c.AppendRecord(0, []byte{0xAA, 0xBB}); err != nil {
+		t.Errorf("AppendRecord() error = %v", err)
+	}
+	if got, err := c.SearchRecord(1, 1, []byte{0xAA}); err != nil || !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("SearchRecord() = %v, %v", got, err)
+	}
+	if _, err := c.ReadRecord(31, 1); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("ReadRecord() error = %v, want %v", err, ErrInvalidArgument)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"00A4000400":           "620A82013883023F008A01059000",
+		"00A40804022F0000":     "620C8202010183022F00800200209000",
+		"00A40804027F1000":     "62038201389000",
+		"00A40804047F106F3A00": "620B82054221001A0483026F3A9000",
+		"00A40804027F2000":     "6982",
+		"00A40804027F3000":     "620A82013883027F308A01046283",
+	}}
+	var out bytes.Buffer
+	if err := NewCard(card).Dump(&out, []uint16{0x2F00, 0x3F00, 0x6F3A, 0x7F10, 0x7F20, 0x7F30}); err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	want := "3F00 DF, operational, activated\n" +
+		"  2F00 working EF, transparent, 32 bytes\n" +
+		"  7F10 DF\n" +
+		"    6F3A working EF, linear fixed, 4 records of 26 bytes\n" +
+		"  7F30 DF, operational, deactivated\n"
+	if out.String() != want {
+		t.Errorf("Dump() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestFIDRange(t *testing.T) {
+	if got := FIDRange(0xFFFE, 0xFFFF); !reflect.DeepEqual(got, []uint16{0xFFFE, 0xFFFF}) {
+		t.Errorf("FIDRange() = %X", got)
+	}
+	if got := FIDRange(2, 1); got != nil {
+		t.Errorf("FIDRange() = %X", got)
+	}
+}
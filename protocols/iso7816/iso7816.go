@@ -7,10 +7,33 @@
 // file system operations, security mechanisms, and communication protocols.
 package iso7816
 
+import "github.com/happy-sdk/scardkit/apdu"
+
 const (
 	// Constants for ISO 7816 specific values, e.g., instruction codes
-	INSReadBinary = 0xB0
-	// ...
+	INSVerify                    = 0x20
+	INSManageSecurityEnvironment = 0x22
+	INSChangeReferenceData       = 0x24
+	INSDisableVerification       = 0x26
+	INSEnableVerification        = 0x28
+	INSPerformSecurityOperation  = 0x2A
+	INSResetRetryCounter         = 0x2C
+	INSManageChannel             = 0x70
+	INSExternalAuthenticate      = 0x82
+	INSGetChallenge              = 0x84
+	INSGeneralAuthenticate       = 0x86
+	INSInternalAuthenticate      = 0x88
+	INSSearchRecord              = 0xA2
+	INSSelect                    = 0xA4
+	INSReadBinary                = 0xB0
+	INSReadRecord                = 0xB2
+	INSGetData                   = 0xCA
+	INSGetDataOdd                = 0xCB
+	INSUpdateBinary              = 0xD6
+	INSPutData                   = 0xDA
+	INSPutDataOdd                = 0xDB
+	INSUpdateRecord              = 0xDC
+	INSAppendRecord              = 0xE2
 )
 
 // NewCommandAPDU creates a new ISO 7816 Command APDU.
@@ -26,7 +49,8 @@ func NewResponseAPDU(data []byte, sw1, sw2 byte) *ResponseAPDU { return nil }
 func UnmarshalResponseAPDU(data []byte) (*ResponseAPDU, error) { return nil, nil }
 
 // CheckResponseStatus interprets the SW1 and SW2 status words of a response APDU.
-func CheckResponseStatus(sw1, sw2 byte) error { return nil }
+// It returns nil on normal processing and an *apdu.StatusError otherwise.
+func CheckResponseStatus(sw1, sw2 byte) error { return apdu.CheckStatus(sw1, sw2) }
 
 // CommandAPDU represents an ISO 7816 command APDU structure.
 type CommandAPDU struct {
@@ -0,0 +1,225 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+var (
+	// ErrInvalidPIN is returned when a PIN cannot be encoded in the requested format.
+	ErrInvalidPIN = errors.New("iso7816: invalid PIN")
+	// ErrPINSafety is returned by a Card with SafePIN set when presenting
+	// a PIN could block its reference data.
+	ErrPINSafety = errors.New("iso7816: PIN not presented, retry counter unsafe")
+)
+
+// PINFormat is the encoding of a PIN in the command data field.
+type PINFormat uint8
+
+const (
+	// PINASCII encodes each digit as an ASCII character.
+	PINASCII PINFormat = iota
+	// PINBCD packs two digits per byte, the last nibble filled with F.
+	PINBCD
+	// PINFormat2 is the ISO 9564 format 2 PIN block of eight bytes.
+	PINFormat2
+)
+
+// PINPadding is the byte filling an encoded PIN up to its padded length.
+const PINPadding = 0xFF
+
+// EncodePIN encodes the decimal pin and pads it with PINPadding to padTo
+// bytes; padTo is ignored for PINFormat2 which always has eight bytes.
+func EncodePIN(pin string, format PINFormat, padTo int) ([]byte, error) {
+	if pin == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidPIN)
+	}
+	for _, r := range pin {
+		if format != PINASCII && (r < '0' || r > '9') {
+			return nil, fmt.Errorf("%w: %q is not a digit", ErrInvalidPIN, r)
+		}
+	}
+
+	var out []byte
+	switch format {
+	case PINASCII:
+		out = []byte(pin)
+	case PINBCD:
+		out = packBCD(pin, 0x0F)
+	case PINFormat2:
+		if len(pin) < 4 || len(pin) > 12 {
+			return nil, fmt.Errorf("%w: format 2 needs 4 to 12 digits, got %d", ErrInvalidPIN, len(pin))
+		}
+		out = packBCD(fmt.Sprintf("2%X%s", len(pin), pin), 0x0F)
+		for len(out) < 8 {
+			out = append(out, PINPadding)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown format %d", ErrInvalidPIN, format)
+	}
+	if padTo > 0 && len(out) > padTo {
+		return nil, fmt.Errorf("%w: %d bytes exceed padded length %d", ErrInvalidPIN, len(out), padTo)
+	}
+	for len(out) < padTo {
+		out = append(out, PINPadding)
+	}
+	return out, nil
+}
+
+// packBCD packs hex digits two per byte, filling an odd last nibble.
+func packBCD(digits string, fill byte) []byte {
+	out := make([]byte, 0, (len(digits)+1)/2)
+	for i := 0; i < len(digits); i += 2 {
+		hi := hexNibble(digits[i])
+		lo := fill
+		if i+1 < len(digits) {
+			lo = hexNibble(digits[i+1])
+		}
+		out = append(out, hi<<4|lo)
+	}
+	return out
+}
+
+func hexNibble(c byte) byte {
+	if c >= 'A' {
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// RetriesLeft extracts the remaining tries from a 63Cx warning or a 6983
+// blocked reference returned by a PIN command.
+func RetriesLeft(err error) (int, bool) {
+	var se *apdu.StatusError
+	if !errors.As(err, &se) {
+		return 0, false
+	}
+	switch {
+	case se.SW1 == 0x63 && se.SW2&0xF0 == 0xC0:
+		return int(se.SW2 & 0x0F), true
+	case se.SW() == 0x6983:
+		return 0, true
+	}
+	return 0, false
+}
+
+// PINStatus is the state of a PIN reference queried by VERIFY without data.
+type PINStatus struct {
+	// Verified is set when the PIN was already verified or is not required.
+	Verified bool
+	// Retries is the remaining number of tries, -1 when not reported.
+	Retries int
+}
+
+// Blocked reports whether no tries remain.
+func (s PINStatus) Blocked() bool { return s.Retries == 0 }
+
+// PINStatus queries the verification state and retry counter of the
+// reference data ref, the P2 of VERIFY.
+func (c *Card) PINStatus(ref byte) (PINStatus, error) {
+	_, err := c.Send(c.command(INSVerify, 0x00, ref, nil, 0))
+	if err == nil {
+		return PINStatus{Verified: true, Retries: -1}, nil
+	}
+	if n, ok := RetriesLeft(err); ok {
+		return PINStatus{Retries: n}, nil
+	}
+	return PINStatus{Retries: -1}, err
+}
+
+// Verify presents pin for the reference data ref. A wrong PIN returns
+// the 63Cx status error, from which RetriesLeft reports the tries left.
+func (c *Card) Verify(ref byte, pin []byte) error {
+	if err := c.checkPINSafety(ref); err != nil {
+		return err
+	}
+	_, err := c.Send(c.command(INSVerify, 0x00, ref, pin, 0))
+	return err
+}
+
+// ChangeReferenceData replaces the reference data ref with newPIN. When
+// oldPIN is nil it is not sent, for cards which verified it separately.
+func (c *Card) ChangeReferenceData(ref byte, oldPIN, newPIN []byte) error {
+	p1 := byte(0x01)
+	if oldPIN != nil {
+		p1 = 0x00
+		if err := c.checkPINSafety(ref); err != nil {
+			return err
+		}
+	}
+	_, err := c.Send(c.command(INSChangeReferenceData, p1, ref, append(append([]byte(nil), oldPIN...), newPIN...), 0))
+	return err
+}
+
+// ResetRetryCounter unblocks the reference data ref with the resetting
+// code puk and optionally sets newPIN; either may be nil. The retry
+// counter of the resetting code is not checked by SafePIN.
+func (c *Card) ResetRetryCounter(ref byte, puk, newPIN []byte) error {
+	var p1 byte
+	switch {
+	case puk != nil && newPIN != nil:
+		p1 = 0x00
+	case puk != nil:
+		p1 = 0x01
+	case newPIN != nil:
+		p1 = 0x02
+	default:
+		p1 = 0x03
+	}
+	data := append(append([]byte(nil), puk...), newPIN...)
+	if len(data) == 0 {
+		data = nil
+	}
+	_, err := c.Send(c.command(INSResetRetryCounter, p1, ref, data, 0))
+	return err
+}
+
+// EnableVerification switches the verification requirement of ref on,
+// presenting pin when it is not nil.
+func (c *Card) EnableVerification(ref byte, pin []byte) error {
+	return c.verificationRequirement(INSEnableVerification, ref, pin)
+}
+
+// DisableVerification switches the verification requirement of ref off,
+// presenting pin when it is not nil.
+func (c *Card) DisableVerification(ref byte, pin []byte) error {
+	return c.verificationRequirement(INSDisableVerification, ref, pin)
+}
+
+func (c *Card) verificationRequirement(ins, ref byte, pin []byte) error {
+	p1 := byte(0x01)
+	if pin != nil {
+		p1 = 0x00
+		if err := c.checkPINSafety(ref); err != nil {
+			return err
+		}
+	}
+	_, err := c.Send(c.command(ins, p1, ref, pin, 0))
+	return err
+}
+
+// checkPINSafety refuses to present a PIN in SafePIN mode when the card
+// reports fewer than two remaining tries, or neither the counter nor a
+// verified state.
+func (c *Card) checkPINSafety(ref byte) error {
+	if !c.SafePIN {
+		return nil
+	}
+	st, err := c.PINStatus(ref)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %w", ErrPINSafety, err)
+	case st.Retries == -1 && !st.Verified:
+		return fmt.Errorf("%w: retry counter of %02X unknown", ErrPINSafety, ref)
+	case st.Retries >= 0 && st.Retries < 2:
+		return fmt.Errorf("%w: %d tries left for %02X", ErrPINSafety, st.Retries, ref)
+	}
+	return nil
+}
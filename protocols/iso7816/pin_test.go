@@ -0,0 +1,136 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+func TestEncodePIN(t *testing.T) {
+	tests := []struct {
+		pin    string
+		format PINFormat
+		padTo  int
+		want   []byte
+	}{
+		{"1234", PINASCII, 0, []byte{0x31, 0x32, 0x33, 0x34}},
+		{"1234", PINASCII, 8, []byte{0x31, 0x32, 0x33, 0x34, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"12345", PINBCD, 0, []byte{0x12, 0x34, 0x5F}},
+		{"1234", PINBCD, 4, []byte{0x12, 0x34, 0xFF, 0xFF}},
+		{"1234", PINFormat2, 0, []byte{0x24, 0x12, 0x34, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"123456789012", PINFormat2, 0, []byte{0x2C, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12, 0xFF}},
+		{"12345", PINFormat2, 0, []byte{0x25, 0x12, 0x34, 0x5F, 0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		got, err := EncodePIN(tt.pin, tt.format, tt.padTo)
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("EncodePIN(%q, %d, %d) = % X, %v, want % X", tt.pin, tt.format, tt.padTo, got, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		pin    string
+		format PINFormat
+		padTo  int
+	}{
+		{"", PINASCII, 0},
+		{"12a4", PINBCD, 0},
+		{"123", PINFormat2, 0},
+		{"123456789", PINASCII, 8},
+	} {
+		if _, err := EncodePIN(tt.pin, tt.format, tt.padTo); !errors.Is(err, ErrInvalidPIN) {
+			t.Errorf("EncodePIN(%q) error = %v, want %v", tt.pin, err, ErrInvalidPIN)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"002000810431323334": "9000",
+		"002000810431313131": "63C2",
+		"00200082":           "6983",
+	}}
+	c := NewCard(card)
+	pin, _ := EncodePIN("1234", PINASCII, 0)
+	if err := c.Verify(0x81, pin); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	wrong, _ := EncodePIN("1111", PINASCII, 0)
+	err := c.Verify(0x81, wrong)
+	if n, ok := RetriesLeft(err); !ok || n != 2 || !errors.Is(err, apdu.ErrVerificationFailed) {
+		t.Errorf("Verify() error = %v, RetriesLeft() = %d, %v", err, n, ok)
+	}
+	if st, err := c.PINStatus(0x82); err != nil || !st.Blocked() {
+		t.Errorf("PINStatus() = %+v, %v", st, err)
+	}
+}
+
+func TestSafePIN(t *testing.T) {
+	pin, _ := EncodePIN("1234", PINASCII, 0)
+	tests := []struct {
+		name   string
+		status string
+		sent   int
+		err    error
+	}{
+		{"enough tries", "63C3", 2, nil},
+		{"last try", "63C1", 1, ErrPINSafety},
+		{"blocked", "6983", 1, ErrPINSafety},
+		{"already verified", "9000", 2, nil},
+		{"counter not reported", "6A86", 1, ErrPINSafety},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := &tableCard{t: t, responses: map[string]string{
+				"00200081":           tt.status,
+				"002000810431323334": "9000",
+			}}
+			c := NewCard(card)
+			c.SafePIN = true
+			if err := c.Verify(0x81, pin); !errors.Is(err, tt.err) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if len(card.received) != tt.sent {
+				t.Errorf("sent %d commands, want %d", len(card.received), tt.sent)
+			}
+		})
+	}
+}
+
+func TestPINCommands(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"00240081083132333435363738": "9000",
+		"002401810435363738":         "9000",
+		"002C0081083132333435363738": "9000",
+		"002C0381":                   "9000",
+		"002600810431323334":         "9000",
+		"00280181":                   "9000",
+	}}
+	c := NewCard(card)
+	oldPIN, _ := EncodePIN("1234", PINASCII, 0)
+	newPIN, _ := EncodePIN("5678", PINASCII, 0)
+	if err := c.ChangeReferenceData(0x81, oldPIN, newPIN); err != nil {
+		t.Errorf("ChangeReferenceData() error = %v", err)
+	}
+	if err := c.ChangeReferenceData(0x81, nil, newPIN); err != nil {
+		t.Errorf("ChangeReferenceData() without old PIN error = %v", err)
+	}
+	if err := c.ResetRetryCounter(0x81, oldPIN, newPIN); err != nil {
+		t.Errorf("ResetRetryCounter() error = %v", err)
+	}
+	if err := c.ResetRetryCounter(0x81, nil, nil); err != nil {
+		t.Errorf("ResetRetryCounter() without data error = %v", err)
+	}
+	if err := c.DisableVerification(0x81, oldPIN); err != nil {
+		t.Errorf("DisableVerification() error = %v", err)
+	}
+	if err := c.EnableVerification(0x81, nil); err != nil {
+		t.Errorf("EnableVerification() error = %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// Control reference templates, the P2 of MSE SET.
+const (
+	CRTAuthentication  byte = 0xA4 // AT
+	CRTKeyAgreement    byte = 0xA6 // KAT
+	CRTHash            byte = 0xAA // HT
+	CRTChecksum        byte = 0xB4 // CCT
+	CRTSignature       byte = 0xB6 // DST
+	CRTConfidentiality byte = 0xB8 // CT
+)
+
+// MSE SET variants, the P1 of MSE naming the operations the template is
+// set for.
+const (
+	// MSESetComputation sets the template for computation, decipherment,
+	// internal authentication and key agreement.
+	MSESetComputation byte = 0x41
+	// MSESetVerification sets the template for verification, encipherment
+	// and external authentication.
+	MSESetVerification byte = 0x81
+	// MSERestore replaces the current environment by a stored one.
+	MSERestore byte = 0xF3
+)
+
+// Padding indicator bytes prefixing enciphered data, ISO 7816-8 table 2.
+const (
+	PaddingNoIndication byte = 0x00
+	PaddingISO9797      byte = 0x01 // 80 00 ... padding
+	PaddingNone         byte = 0x02
+)
+
+// ControlReference is the content of a control reference template.
+type ControlReference struct {
+	// Algorithm is DO'80', the cryptographic mechanism reference.
+	Algorithm []byte
+	// File is DO'81', the file reference of the key.
+	File []byte
+	// Key is DO'83', the reference of a secret or public key.
+	Key []byte
+	// PrivateKey is DO'84', the reference of a private or session key.
+	PrivateKey []byte
+	// Usage is DO'95', the usage qualifier byte.
+	Usage []byte
+	// Objects are appended after the data objects above.
+	Objects tlv.List
+}
+
+// Marshal encodes the data objects of the template which are set.
+func (r *ControlReference) Marshal() ([]byte, error) {
+	var objs tlv.List
+	for _, do := range []struct {
+		tag   tlv.Tag
+		value []byte
+	}{{0x80, r.Algorithm}, {0x81, r.File}, {0x83, r.Key}, {0x84, r.PrivateKey}, {0x95, r.Usage}} {
+		if do.value != nil {
+			objs = append(objs, tlv.New(do.tag, do.value))
+		}
+	}
+	return append(objs, r.Objects...).Marshal()
+}
+
+// MSESetCommand builds MANAGE SECURITY ENVIRONMENT SET of the template crt
+// for the operations given by p1, MSESetComputation or MSESetVerification.
+func MSESetCommand(cla, p1, crt byte, ref *ControlReference) (*apdu.Command, error) {
+	data, err := ref.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return apdu.CreateCommand(cla, INSManageSecurityEnvironment, p1, crt, data, 0), nil
+}
+
+// MSERestoreCommand builds MANAGE SECURITY ENVIRONMENT RESTORE of the
+// security environment se.
+func MSERestoreCommand(cla, se byte) *apdu.Command {
+	return apdu.CreateCommand(cla, INSManageSecurityEnvironment, MSERestore, se, nil, 0)
+}
+
+// PSO P1-P2 pairs naming the operation, ISO 7816-8 table 4.
+const (
+	psoSignature         = 0x9E9A
+	psoHash              = 0x9080
+	psoHashTemplate      = 0x90A0
+	psoDecipher          = 0x8086
+	psoEncipher          = 0x8680
+	psoVerifyCertificate = 0x00BE
+)
+
+// psoCommand builds PERFORM SECURITY OPERATION for the P1-P2 operation op.
+func psoCommand(cla byte, op uint16, data []byte, ne int) *apdu.Command {
+	return apdu.CreateCommand(cla, INSPerformSecurityOperation, byte(op>>8), byte(op), data, ne)
+}
+
+// ComputeSignatureCommand builds PSO COMPUTE DIGITAL SIGNATURE over the
+// prepared input, such as a DigestInfo or a hash.
+func ComputeSignatureCommand(cla byte, input []byte) *apdu.Command {
+	return psoCommand(cla, psoSignature, input, apdu.MaxShortNe)
+}
+
+// HashCommand builds PSO HASH of data computed by the card.
+func HashCommand(cla byte, data []byte) *apdu.Command {
+	return psoCommand(cla, psoHash, data, 0)
+}
+
+// HashFinalCommand builds PSO HASH completing the intermediate hash
+// computed outside the card with the last block of data.
+func HashFinalCommand(cla byte, intermediate, last []byte) (*apdu.Command, error) {
+	data, err := tlv.List{tlv.New(0x90, intermediate), tlv.New(0x80, last)}.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return psoCommand(cla, psoHashTemplate, data, 0), nil
+}
+
+// DecipherCommand builds PSO DECIPHER of cryptogram, prefixed with the
+// padding indicator.
+func DecipherCommand(cla, padding byte, cryptogram []byte) *apdu.Command {
+	return psoCommand(cla, psoDecipher, append([]byte{padding}, cryptogram...), apdu.MaxShortNe)
+}
+
+// EncipherCommand builds PSO ENCIPHER of plain.
+func EncipherCommand(cla byte, plain []byte) *apdu.Command {
+	return psoCommand(cla, psoEncipher, plain, apdu.MaxShortNe)
+}
+
+// VerifyCertificateCommand builds PSO VERIFY CERTIFICATE of a certificate
+// given as data objects, such as a card verifiable certificate.
+func VerifyCertificateCommand(cla byte, cert []byte) *apdu.Command {
+	return psoCommand(cla, psoVerifyCertificate, cert, 0)
+}
+
+// ManageSecurityEnvironment sets the template crt of the current
+// security environment.
+func (c *Card) ManageSecurityEnvironment(p1, crt byte, ref *ControlReference) error {
+	cmd, err := MSESetCommand(c.CLA, p1, crt, ref)
+	if err != nil {
+		return err
+	}
+	_, err = c.sendChained(cmd)
+	return err
+}
+
+// RestoreSecurityEnvironment restores the stored security environment se.
+func (c *Card) RestoreSecurityEnvironment(se byte) error {
+	_, err := c.Send(MSERestoreCommand(c.CLA, se))
+	return err
+}
+
+// ComputeSignature returns the signature of input with the key set in
+// the digital signature template.
+func (c *Card) ComputeSignature(input []byte) ([]byte, error) {
+	return c.pso(ComputeSignatureCommand(c.CLA, input))
+}
+
+// Hash has the card hash data. Cards keep the result for a following
+// signature and may return it as well.
+func (c *Card) Hash(data []byte) ([]byte, error) {
+	return c.pso(HashCommand(c.CLA, data))
+}
+
+// HashFinal has the card complete a hash from an intermediate result and
+// the last block of data.
+func (c *Card) HashFinal(intermediate, last []byte) ([]byte, error) {
+	cmd, err := HashFinalCommand(c.CLA, intermediate, last)
+	if err != nil {
+		return nil, err
+	}
+	return c.pso(cmd)
+}
+
+// Decipher returns the plain value of cryptogram, sent with the padding
+// indicator byte.
+func (c *Card) Decipher(padding byte, cryptogram []byte) ([]byte, error) {
+	return c.pso(DecipherCommand(c.CLA, padding, cryptogram))
+}
+
+// Encipher returns the padding indicator and the cryptogram of plain.
+func (c *Card) Encipher(plain []byte) (byte, []byte, error) {
+	out, err := c.pso(EncipherCommand(c.CLA, plain))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(out) == 0 {
+		return 0, nil, fmt.Errorf("%w: padding indicator missing", apdu.ErrInvalidResponse)
+	}
+	return out[0], out[1:], nil
+}
+
+// VerifyCertificate has the card verify cert with the public key set in
+// the digital signature template.
+func (c *Card) VerifyCertificate(cert []byte) error {
+	_, err := c.pso(VerifyCertificateCommand(c.CLA, cert))
+	return err
+}
+
+func (c *Card) pso(cmd *apdu.Command) ([]byte, error) {
+	resp, err := c.sendChained(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// sendChained sends cmd as a command chain when its data does not fit a
+// short APDU; cards of the PKI profiles rarely accept extended lengths.
+func (c *Card) sendChained(cmd *apdu.Command) (*apdu.Response, error) {
+	if len(cmd.Data) <= apdu.MaxShortNc {
+		return c.Send(cmd)
+	}
+	return c.t.transmitChain(cmd, apdu.MaxShortNc)
+}
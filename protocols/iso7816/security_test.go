@@ -0,0 +1,72 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+func TestManageSecurityEnvironment(t *testing.T) {
+	card := &tableCard{t: t, responses: map[string]string{
+		"002241B606800142840102": "9000",
+		"002281B806830181950140": "9000",
+		"0022F303":               "9000",
+	}}
+	c := NewCard(card)
+	if err := c.ManageSecurityEnvironment(MSESetComputation, CRTSignature, &ControlReference{
+		Algorithm:  []byte{0x42},
+		PrivateKey: []byte{0x02},
+	}); err != nil {
+		t.Errorf("ManageSecurityEnvironment(DST) error = %v", err)
+	}
+	if err := c.ManageSecurityEnvironment(MSESetVerification, CRTConfidentiality, &ControlReference{
+		Key:   []byte{0x81},
+		Usage: []byte{0x40},
+	}); err != nil {
+		t.Errorf("ManageSecurityEnvironment(CT) error = %v", err)
+	}
+	if err := c.RestoreSecurityEnvironment(3); err != nil {
+		t.Errorf("RestoreSecurityEnvironment() error = %v", err)
+	}
+}
+
+func TestPerformSecurityOperation(t *testing.T) {
+	sig := strings.Repeat("5A", 256)
+	long := bytes.Repeat([]byte{0xC1}, 256)
+	card := &tableCard{t: t, responses: map[string]string{
+		"002A9E9A0401020304" + "00":                sig + "9000",
+		"002A908003616263":                         "9000",
+		"002A90A00A90040102030480026465":           "9000",
+		"102A8086FF00" + strings.Repeat("C1", 254): "9000",
+		"002A808602C1C1" + "00":                    "48454C4C4F9000",
+		"002A868002414200":                         "01AABBCCDD9000",
+		"002A00BE047F210100":                       "6A80",
+	}}
+	c := NewCard(card)
+
+	if got, err := c.ComputeSignature([]byte{0x01, 0x02, 0x03, 0x04}); err != nil || len(got) != 256 {
+		t.Errorf("ComputeSignature() = %d bytes, %v", len(got), err)
+	}
+	if _, err := c.Hash([]byte("abc")); err != nil {
+		t.Errorf("Hash() error = %v", err)
+	}
+	if _, err := c.HashFinal([]byte{0x01, 0x02, 0x03, 0x04}, []byte("de")); err != nil {
+		t.Errorf("HashFinal() error = %v", err)
+	}
+	if got, err := c.Decipher(PaddingNoIndication, long); err != nil || string(got) != "HELLO" {
+		t.Errorf("Decipher() = %q, %v", got, err)
+	}
+	if pad, got, err := c.Encipher([]byte("AB")); err != nil || pad != PaddingISO9797 || !bytes.Equal(got, []byte{0xAA, 0xBB, 0xCC, 0xDD}) {
+		t.Errorf("Encipher() = %02X % X, %v", pad, got, err)
+	}
+	if err := c.VerifyCertificate([]byte{0x7F, 0x21, 0x01, 0x00}); !errors.Is(err, apdu.ErrIncorrectData) {
+		t.Errorf("VerifyCertificate() error = %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// Secure messaging data objects, ISO 7816-4 section 10.
+const (
+	TagSMPlainValue    tlv.Tag = 0x81
+	TagSMCryptogram    tlv.Tag = 0x85 // BER-TLV encoded plain data, odd INS
+	TagSMPaddedCrypto  tlv.Tag = 0x87 // padding indicator and cryptogram
+	TagSMChecksum      tlv.Tag = 0x8E
+	TagSMLe            tlv.Tag = 0x97
+	TagSMStatus        tlv.Tag = 0x99
+	smPaddingIndicator         = 0x01
+)
+
+var (
+	// ErrSMInvalidResponse is returned when a protected response lacks
+	// mandatory data objects or cannot be decrypted.
+	ErrSMInvalidResponse = errors.New("iso7816: invalid secure messaging response")
+	// ErrSMChecksum is returned when the checksum of a response does not verify.
+	ErrSMChecksum = errors.New("iso7816: secure messaging checksum mismatch")
+	// ErrSMInvalidCipher is returned for an SMCipher missing a function
+	// or a block size.
+	ErrSMInvalidCipher = errors.New("iso7816: invalid secure messaging cipher")
+)
+
+// SMCipher supplies the cryptographic functions of a secure messaging
+// session, such as the session keys agreed by BAC or PACE.
+type SMCipher struct {
+	// Encrypt and Decrypt process data padded to BlockSize. The current
+	// send sequence counter is passed for ciphers deriving their IV from it.
+	Encrypt func(ssc, data []byte) ([]byte, error)
+	Decrypt func(ssc, data []byte) ([]byte, error)
+	// MAC returns the cryptographic checksum of data padded to BlockSize.
+	MAC func(data []byte) ([]byte, error)
+	// BlockSize is the padding block size, 8 for DES and 16 for AES.
+	BlockSize int
+}
+
+// SecureMessaging is a Transmitter protecting every command and
+// verifying every response with secure messaging.
+type SecureMessaging struct {
+	cipher SMCipher
+	ssc    []byte
+	t      apdu.Transmitter
+}
+
+// NewSecureMessaging returns a SecureMessaging session sending through t,
+// which handles 61xx and 6Cxx below the protection. The send sequence
+// counter ssc is incremented before each command and response and
+// prepended to the checksum input; with a nil ssc it is not used.
+func NewSecureMessaging(t apdu.Transmitter, cipher SMCipher, ssc []byte) (*SecureMessaging, error) {
+	if cipher.Encrypt == nil || cipher.Decrypt == nil || cipher.MAC == nil {
+		return nil, fmt.Errorf("%w: Encrypt, Decrypt and MAC are required", ErrSMInvalidCipher)
+	}
+	if cipher.BlockSize <= 0 {
+		return nil, fmt.Errorf("%w: block size %d", ErrSMInvalidCipher, cipher.BlockSize)
+	}
+	return &SecureMessaging{
+		cipher: cipher,
+		ssc:    append([]byte(nil), ssc...),
+		t:      apdu.NewAutoTransmitter(t, 0),
+	}, nil
+}
+
+// SSC returns a copy of the current send sequence counter.
+func (sm *SecureMessaging) SSC() []byte {
+	return append([]byte(nil), sm.ssc...)
+}
+
+// Transmit protects cmd, sends it and returns the verified plain response.
+func (sm *SecureMessaging) Transmit(raw []byte) ([]byte, error) {
+	cmd, err := apdu.UnmarshalCommand(raw)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := sm.Wrap(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if raw, err = apdu.MarshalCommand(wrapped); err != nil {
+		return nil, err
+	}
+	out, err := sm.t.Transmit(raw)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := apdu.UnmarshalResponse(out)
+	if err != nil {
+		return nil, err
+	}
+	if resp, err = sm.Unwrap(resp); err != nil {
+		return nil, err
+	}
+	return apdu.MarshalResponse(resp)
+}
+
+// Wrap returns the protected form of cmd: the data field is encrypted
+// into DO'87', or DO'85' for an odd INS, Le moves into DO'97' and DO'8E'
+// authenticates the header and both data objects.
+func (sm *SecureMessaging) Wrap(cmd *apdu.Command) (*apdu.Command, error) {
+	cla := cmd.CLA | 0x0C
+	if cmd.CLA&0x40 != 0 {
+		// Further interindustry class, SM indicated by bit 6.
+		cla = cmd.CLA | 0x20
+	}
+	sm.increment()
+
+	var objs tlv.List
+	if len(cmd.Data) > 0 {
+		enc, err := sm.cipher.Encrypt(sm.ssc, padISO(cmd.Data, sm.cipher.BlockSize))
+		if err != nil {
+			return nil, err
+		}
+		if cmd.INS&0x01 != 0 {
+			objs = append(objs, tlv.New(TagSMCryptogram, enc))
+		} else {
+			objs = append(objs, tlv.New(TagSMPaddedCrypto, append([]byte{smPaddingIndicator}, enc...)))
+		}
+	}
+	if cmd.Ne > 0 {
+		le := []byte{byte(cmd.Ne)}
+		if cmd.IsExtended() {
+			le = []byte{byte(cmd.Ne >> 8), byte(cmd.Ne)}
+		}
+		objs = append(objs, tlv.New(TagSMLe, le))
+	}
+	dos, err := objs.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	header := padISO([]byte{cla, cmd.INS, cmd.P1, cmd.P2}, sm.cipher.BlockSize)
+	mac, err := sm.mac(append(header, dos...))
+	if err != nil {
+		return nil, err
+	}
+	data, err := append(objs, tlv.New(TagSMChecksum, mac)).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	ne := apdu.MaxShortNe
+	ext := cmd.IsExtended() || len(data) > apdu.MaxShortNc
+	if ext {
+		ne = apdu.MaxExtendedNe
+	}
+	return &apdu.Command{CLA: cla, INS: cmd.INS, P1: cmd.P1, P2: cmd.P2, Data: data, Ne: ne, Extended: ext}, nil
+}
+
+// Unwrap verifies the checksum of a protected response and returns the
+// plain response with the status of DO'99'. Errors without data objects,
+// such as 6987 and 6988 reporting broken secure messaging, are returned
+// as they are; a successful status without them is rejected.
+func (sm *SecureMessaging) Unwrap(resp *apdu.Response) (*apdu.Response, error) {
+	sm.increment()
+	if len(resp.Data) == 0 {
+		if apdu.CategoryOf(resp.SW1, resp.SW2) == apdu.CategoryNormal {
+			return nil, fmt.Errorf("%w: unprotected status %04X", ErrSMInvalidResponse, resp.SW())
+		}
+		return resp, nil
+	}
+
+	raws, err := tlv.Split(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSMInvalidResponse, err)
+	}
+	var input []byte
+	var enc, plain, mac []byte
+	sw1, sw2 := resp.SW1, resp.SW2
+	for _, raw := range raws {
+		objs, err := tlv.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSMInvalidResponse, err)
+		}
+		o := objs[0]
+		switch o.Tag {
+		case TagSMChecksum:
+			mac = o.Value
+		case TagSMPaddedCrypto:
+			if len(o.Value) < 1 || o.Value[0] != smPaddingIndicator {
+				return nil, fmt.Errorf("%w: unknown padding indicator", ErrSMInvalidResponse)
+			}
+			enc = o.Value[1:]
+		case TagSMCryptogram:
+			enc = o.Value
+		case TagSMPlainValue:
+			plain = o.Value
+		case TagSMStatus:
+			if len(o.Value) != 2 {
+				return nil, fmt.Errorf("%w: DO'99' of %d bytes", ErrSMInvalidResponse, len(o.Value))
+			}
+			sw1, sw2 = o.Value[0], o.Value[1]
+		}
+		// Only data objects with an odd tag are covered by the checksum,
+		// in the encoding the card sent.
+		if raw[0]&0x01 != 0 {
+			input = append(input, raw...)
+		}
+	}
+	if mac == nil {
+		return nil, fmt.Errorf("%w: DO'8E' missing", ErrSMInvalidResponse)
+	}
+	want, err := sm.mac(input)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(mac, want) != 1 {
+		return nil, ErrSMChecksum
+	}
+
+	data := plain
+	if enc != nil {
+		dec, err := sm.cipher.Decrypt(sm.ssc, enc)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = unpadISO(dec); err != nil {
+			return nil, err
+		}
+	}
+	return apdu.CreateResponse(data, sw1, sw2), nil
+}
+
+// mac computes the checksum over the send sequence counter and data.
+func (sm *SecureMessaging) mac(data []byte) ([]byte, error) {
+	input := append(append([]byte(nil), sm.ssc...), data...)
+	return sm.cipher.MAC(padISO(input, sm.cipher.BlockSize))
+}
+
+// increment adds one to the big endian send sequence counter.
+func (sm *SecureMessaging) increment() {
+	for i := len(sm.ssc) - 1; i >= 0; i-- {
+		sm.ssc[i]++
+		if sm.ssc[i] != 0 {
+			return
+		}
+	}
+}
+
+// padISO applies ISO/IEC 9797-1 padding method 2.
+func padISO(data []byte, blockSize int) []byte {
+	out := append(append([]byte(nil), data...), 0x80)
+	for len(out)%blockSize != 0 {
+		out = append(out, 0x00)
+	}
+	return out
+}
+
+func unpadISO(data []byte) ([]byte, error) {
+	i := len(data) - 1
+	for i >= 0 && data[i] == 0x00 {
+		i--
+	}
+	if i < 0 || data[i] != 0x80 {
+		return nil, fmt.Errorf("%w: bad padding", ErrSMInvalidResponse)
+	}
+	return data[:i], nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// bacCipher returns the 3DES secure messaging of ICAO Doc 9303 part 11:
+// CBC with a zero IV and the ISO 9797-1 MAC algorithm 3.
+func bacCipher(t *testing.T, kenc, kmac []byte) SMCipher {
+	enc, err := des.NewTripleDESCipher(append(append([]byte(nil), kenc...), kenc[:8]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1, _ := des.NewCipher(kmac[:8])
+	k2, _ := des.NewCipher(kmac[8:])
+	iv := make([]byte, 8)
+	return SMCipher{
+		Encrypt: func(_, data []byte) ([]byte, error) {
+			out := make([]byte, len(data))
+			cipher.NewCBCEncrypter(enc, iv).CryptBlocks(out, data)
+			return out, nil
+		},
+		Decrypt: func(_, data []byte) ([]byte, error) {
+			out := make([]byte, len(data))
+			cipher.NewCBCDecrypter(enc, iv).CryptBlocks(out, data)
+			return out, nil
+		},
+		MAC: func(data []byte) ([]byte, error) {
+			h := make([]byte, 8)
+			for i := 0; i < len(data); i += 8 {
+				for j := range h {
+					h[j] ^= data[i+j]
+				}
+				k1.Encrypt(h, h)
+			}
+			k2.Decrypt(h, h)
+			k1.Encrypt(h, h)
+			return h, nil
+		},
+		BlockSize: 8,
+	}
+}
+
+func TestSecureMessaging(t *testing.T) {
+	kenc := mustHex(t, "979EC13B1CBFE9DCD01AB0FED307EAE5")
+	kmac := mustHex(t, "F1CB1F1FB5ADF208806B89DC579DC1F8")
+	card := &tableCard{t: t, responses: map[string]string{
+		"0CA4020C158709016375432908C044F68E08BF8B92D635FF24F800": "990290008E08FA855A5D4C50A8ED9000",
+		"0CB000000D9701048E08ED6705417E96BA5500":                 "8709019FF0EC34F9922651990290008E08AD55CC17140B2DED9000",
+		"0CB000040D9701128E082EA28A70F3C7B53500":                 "6988",
+	}}
+	sm, err := NewSecureMessaging(card, bacCipher(t, kenc, kmac), mustHex(t, "887022120C06C226"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Examples of ICAO Doc 9303 part 11, appendix D.4.
+	resp, err := sm.Transmit(mustHex(t, "00A4020C02011E"))
+	if err != nil || !bytes.Equal(resp, []byte{0x90, 0x00}) {
+		t.Fatalf("SELECT = % X, %v", resp, err)
+	}
+	resp, err = sm.Transmit(mustHex(t, "00B0000004"))
+	if err != nil || !bytes.Equal(resp, mustHex(t, "60145F019000")) {
+		t.Fatalf("READ BINARY = % X, %v", resp, err)
+	}
+	if got := sm.SSC(); !bytes.Equal(got, mustHex(t, "887022120C06C22A")) {
+		t.Errorf("SSC() = % X", got)
+	}
+
+	// Status words reporting broken secure messaging come back unprotected.
+	resp, err = sm.Transmit(mustHex(t, "00B0000412"))
+	if err != nil || !errors.Is(apdu.CheckStatusFromData(resp), apdu.ErrSMDataObjectsIncorrect) {
+		t.Errorf("READ BINARY = % X, %v", resp, err)
+	}
+}
+
+func TestSecureMessagingErrors(t *testing.T) {
+	kenc := mustHex(t, "979EC13B1CBFE9DCD01AB0FED307EAE5")
+	kmac := mustHex(t, "F1CB1F1FB5ADF208806B89DC579DC1F8")
+	tests := []struct {
+		name string
+		resp string
+		err  error
+	}{
+		{"wrong checksum", "990290008E08FA855A5D4C50A8EE9000", ErrSMChecksum},
+		{"checksum missing", "990290009000", ErrSMInvalidResponse},
+		{"unprotected success", "9000", ErrSMInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := &tableCard{t: t, responses: map[string]string{
+				"0CA4020C158709016375432908C044F68E08BF8B92D635FF24F800": tt.resp,
+			}}
+			sm, err := NewSecureMessaging(card, bacCipher(t, kenc, kmac), mustHex(t, "887022120C06C226"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sm.Transmit(mustHex(t, "00A4020C02011E")); !errors.Is(err, tt.err) {
+				t.Errorf("Transmit() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewSecureMessagingInvalidCipher(t *testing.T) {
+	valid := bacCipher(t, make([]byte, 16), make([]byte, 16))
+	noBlock, noMAC := valid, valid
+	noBlock.BlockSize = 0
+	noMAC.MAC = nil
+	for name, c := range map[string]SMCipher{"block size 0": noBlock, "nil MAC": noMAC, "zero value": {}} {
+		if _, err := NewSecureMessaging(&tableCard{t: t}, c, nil); !errors.Is(err, ErrSMInvalidCipher) {
+			t.Errorf("NewSecureMessaging(%s) error = %v", name, err)
+		}
+	}
+}
+
+func TestSecureMessagingUnwrapRaw(t *testing.T) {
+	kmac := mustHex(t, "F1CB1F1FB5ADF208806B89DC579DC1F8")
+	c := bacCipher(t, kmac, kmac)
+	// DO'99' with a long form length is checksummed as received, the
+	// even tag DO'80' is not checksummed.
+	mac, err := c.MAC(padISO(mustHex(t, "0000000000000001"+"9981029000"), 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"as sent", "8002AABB" + "9981029000", nil},
+		{"other unprotected value", "8002CCDD" + "9981029000", nil},
+		{"re-encoded length", "8002AABB" + "99029000", ErrSMChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := NewSecureMessaging(&tableCard{t: t}, c, make([]byte, 8))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := append(mustHex(t, tt.data+"8E08"), mac...)
+			resp, err := sm.Unwrap(apdu.CreateResponse(data, 0x90, 0x00))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Unwrap() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && resp.SW() != 0x9000 {
+				t.Errorf("Unwrap() = %v", resp)
+			}
+		})
+	}
+}
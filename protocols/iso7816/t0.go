@@ -0,0 +1,186 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+// t0Null is the NULL procedure byte asking for more waiting time.
+const t0Null = 0x60
+
+// ErrT0Protocol is returned when the card sends an unexpected procedure
+// byte or the command cannot be mapped onto T=0.
+var ErrT0Protocol = errors.New("iso7816: T=0 protocol error")
+
+// T0 drives the ISO 7816-3 T=0 character protocol over a Port, mapping
+// command APDUs onto TPDUs as described in section 12.2. It implements
+// the apdu Transmitter interface.
+type T0 struct {
+	port          Port
+	maxIterations int
+}
+
+// NewT0 returns a T=0 engine on port. It issues at most
+// apdu.DefaultMaxIterations GET RESPONSE commands per command APDU.
+func NewT0(port Port) *T0 {
+	return &T0{port: port, maxIterations: apdu.DefaultMaxIterations}
+}
+
+// Transmit sends a short command APDU and returns the response APDU.
+// Response data announced with 61xx is fetched with GET RESPONSE, and a
+// wrong length reported with 6Cxx is corrected by reissuing the command.
+// Case 4 commands are sent as a case 3 TPDU followed by GET RESPONSE.
+func (t *T0) Transmit(raw []byte) ([]byte, error) {
+	cmd, err := apdu.UnmarshalCommand(raw)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.IsExtended() && len(cmd.Data) > apdu.MaxShortNc {
+		return nil, fmt.Errorf("%w: %d bytes of command data need ENVELOPE", ErrT0Protocol, len(cmd.Data))
+	}
+
+	header := []byte{cmd.CLA, cmd.INS, cmd.P1, cmd.P2, 0x00}
+	var data []byte
+	var sw1, sw2 byte
+	switch {
+	case len(cmd.Data) > 0:
+		header[4] = byte(len(cmd.Data))
+		if _, sw1, sw2, err = t.TransmitTPDU(header, cmd.Data, 0); err != nil {
+			return nil, err
+		}
+		if cmd.Ne == 0 {
+			return []byte{sw1, sw2}, nil
+		}
+		if sw1 == 0x62 || sw1 == 0x63 || sw1&0xF0 == 0x90 && (sw1 != 0x90 || sw2 != 0x00) {
+			// Case 4S.3: data may follow a warning, which is kept
+			// unless GET RESPONSE completes normally.
+			wsw1, wsw2 := sw1, sw2
+			data, sw1, sw2, err = t.getResponse(cmd.CLA, 0x00, apdu.MaxShortNe)
+			if err != nil {
+				return nil, err
+			}
+			if sw1 == 0x90 && sw2 == 0x00 {
+				sw1, sw2 = wsw1, wsw2
+			} else {
+				data, sw1, sw2 = nil, wsw1, wsw2
+			}
+		}
+	default:
+		ne := 0
+		if cmd.Ne > 0 {
+			ne = min(cmd.Ne, apdu.MaxShortNe)
+			header[4] = byte(ne)
+		}
+		if data, sw1, sw2, err = t.TransmitTPDU(header, nil, ne); err != nil {
+			return nil, err
+		}
+		if sw1 == 0x6C {
+			header[4] = sw2
+			if data, sw1, sw2, err = t.TransmitTPDU(header, nil, lengthOf(sw2)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := 0; sw1 == 0x61 && (cmd.Ne == 0 || len(data) < cmd.Ne); i++ {
+		if i == t.maxIterations {
+			return nil, fmt.Errorf("%w: gave up after %d GET RESPONSE commands", apdu.ErrTooManyIterations, i)
+		}
+		n := lengthOf(sw2)
+		if cmd.Ne > 0 {
+			n = min(n, cmd.Ne-len(data))
+		}
+		more, s1, s2, err := t.getResponse(cmd.CLA, byte(n), n)
+		if err != nil {
+			return nil, err
+		}
+		data, sw1, sw2 = append(data, more...), s1, s2
+	}
+	return append(data, sw1, sw2), nil
+}
+
+// getResponse issues GET RESPONSE, correcting a wrong Le reported with 6Cxx.
+func (t *T0) getResponse(cla, p3 byte, ne int) ([]byte, byte, byte, error) {
+	header := []byte{cla &^ apdu.ClaChaining, apdu.InsGetResponse, 0x00, 0x00, p3}
+	data, sw1, sw2, err := t.TransmitTPDU(header, nil, ne)
+	if err == nil && sw1 == 0x6C {
+		header[4] = sw2
+		data, sw1, sw2, err = t.TransmitTPDU(header, nil, lengthOf(sw2))
+	}
+	return data, sw1, sw2, err
+}
+
+// TransmitTPDU performs a single T=0 exchange: it sends the five byte
+// header, then follows the procedure bytes of the card to send data or
+// receive up to ne bytes until SW1 SW2 arrive.
+func (t *T0) TransmitTPDU(header, data []byte, ne int) ([]byte, byte, byte, error) {
+	if len(header) != 5 {
+		return nil, 0, 0, fmt.Errorf("%w: header of %d bytes", ErrT0Protocol, len(header))
+	}
+	ins := header[1]
+	if ins&0xF0 == 0x60 || ins&0xF0 == 0x90 {
+		return nil, 0, 0, fmt.Errorf("%w: invalid INS %02X", ErrT0Protocol, ins)
+	}
+	if len(data) > 0 && ne > 0 {
+		return nil, 0, 0, fmt.Errorf("%w: a TPDU carries data in one direction only", ErrT0Protocol)
+	}
+	if _, err := t.port.Write(header); err != nil {
+		return nil, 0, 0, err
+	}
+
+	var in []byte
+	pb := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(t.port, pb); err != nil {
+			return nil, 0, 0, err
+		}
+		switch p := pb[0]; {
+		case p == t0Null:
+		case p&0xF0 == 0x60 || p&0xF0 == 0x90:
+			if _, err := io.ReadFull(t.port, pb); err != nil {
+				return nil, 0, 0, err
+			}
+			return in, p, pb[0], nil
+		case p == ins || p == ^ins:
+			n := 1
+			if p == ins {
+				n = len(data)
+				if len(data) == 0 {
+					n = ne - len(in)
+				}
+			}
+			if len(data) > 0 {
+				if _, err := t.port.Write(data[:n]); err != nil {
+					return nil, 0, 0, err
+				}
+				data = data[n:]
+				continue
+			}
+			if len(in)+n > ne {
+				return nil, 0, 0, fmt.Errorf("%w: card sends more than %d bytes", ErrT0Protocol, ne)
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(t.port, buf); err != nil {
+				return nil, 0, 0, err
+			}
+			in = append(in, buf...)
+		default:
+			return nil, 0, 0, fmt.Errorf("%w: unexpected procedure byte %02X", ErrT0Protocol, p)
+		}
+	}
+}
+
+// lengthOf decodes P3 or SW2 as a length, 00 meaning 256.
+func lengthOf(b byte) int {
+	if b == 0 {
+		return apdu.MaxShortNe
+	}
+	return int(b)
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+// t0Step is one turn of a byte level T=0 conversation: once the
+// interface device has written expect, the card answers with reply.
+type t0Step struct {
+	expect []byte
+	reply  []byte
+}
+
+// t0Card plays a scripted T=0 conversation as a Port.
+type t0Card struct {
+	t     *testing.T
+	steps []t0Step
+	in    []byte
+	out   bytes.Buffer
+}
+
+func (c *t0Card) Write(b []byte) (int, error) {
+	c.in = append(c.in, b...)
+	for len(c.steps) > 0 && len(c.in) >= len(c.steps[0].expect) {
+		step := c.steps[0]
+		if got := c.in[:len(step.expect)]; !bytes.Equal(got, step.expect) {
+			c.t.Fatalf("card received % X, want % X", got, step.expect)
+		}
+		c.in = c.in[len(step.expect):]
+		c.out.Write(step.reply)
+		c.steps = c.steps[1:]
+	}
+	return len(b), nil
+}
+
+func (c *t0Card) Read(b []byte) (int, error) {
+	if c.out.Len() == 0 {
+		return 0, errPeerTimeout
+	}
+	return c.out.Read(b)
+}
+
+func TestT0Transmit(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   []byte
+		steps []t0Step
+		want  []byte
+	}{
+		{
+			name:  "case 1",
+			cmd:   []byte{0x00, 0x44, 0x00, 0x00},
+			steps: []t0Step{{[]byte{0x00, 0x44, 0x00, 0x00, 0x00}, []byte{0x90, 0x00}}},
+			want:  []byte{0x90, 0x00},
+		},
+		{
+			name: "case 3 with ACK and NULL",
+			cmd:  []byte{0x00, 0xD6, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03},
+			steps: []t0Step{
+				{[]byte{0x00, 0xD6, 0x00, 0x00, 0x03}, []byte{0x60, 0xD6}},
+				{[]byte{0x01, 0x02, 0x03}, []byte{0x60, 0x60, 0x90, 0x00}},
+			},
+			want: []byte{0x90, 0x00},
+		},
+		{
+			name: "case 3 single byte mode",
+			cmd:  []byte{0x00, 0xD6, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03},
+			steps: []t0Step{
+				{[]byte{0x00, 0xD6, 0x00, 0x00, 0x03}, []byte{0x29}},
+				{[]byte{0x01}, []byte{0x29}},
+				{[]byte{0x02}, []byte{0xD6}},
+				{[]byte{0x03}, []byte{0x90, 0x00}},
+			},
+			want: []byte{0x90, 0x00},
+		},
+		{
+			name: "case 2 with wrong Le",
+			cmd:  []byte{0x00, 0xB0, 0x00, 0x00, 0x00},
+			steps: []t0Step{
+				{[]byte{0x00, 0xB0, 0x00, 0x00, 0x00}, []byte{0x6C, 0x04}},
+				{[]byte{0x00, 0xB0, 0x00, 0x00, 0x04}, []byte{0xB0, 0xAA, 0xBB, 0x4F, 0xDD, 0x90, 0x00}},
+			},
+			want: []byte{0xAA, 0xBB, 0x4F, 0xDD, 0x90, 0x00},
+		},
+		{
+			name: "case 2 single byte mode",
+			cmd:  []byte{0x00, 0xB0, 0x00, 0x00, 0x02},
+			steps: []t0Step{
+				{[]byte{0x00, 0xB0, 0x00, 0x00, 0x02}, []byte{0x4F, 0xAA, 0x60, 0x4F, 0xBB, 0x90, 0x00}},
+			},
+			want: []byte{0xAA, 0xBB, 0x90, 0x00},
+		},
+		{
+			name: "case 4 with GET RESPONSE",
+			cmd:  []byte{0x00, 0xA4, 0x00, 0x00, 0x02, 0x3F, 0x00, 0x00},
+			steps: []t0Step{
+				{[]byte{0x00, 0xA4, 0x00, 0x00, 0x02}, []byte{0xA4}},
+				{[]byte{0x3F, 0x00}, []byte{0x61, 0x03}},
+				{[]byte{0x00, 0xC0, 0x00, 0x00, 0x03}, []byte{0xC0, 0x62, 0x01, 0x82, 0x90, 0x00}},
+			},
+			want: []byte{0x62, 0x01, 0x82, 0x90, 0x00},
+		},
+		{
+			name: "case 4 with Le smaller than available",
+			cmd:  []byte{0x00, 0xA4, 0x00, 0x00, 0x02, 0x3F, 0x00, 0x02},
+			steps: []t0Step{
+				{[]byte{0x00, 0xA4, 0x00, 0x00, 0x02}, []byte{0xA4}},
+				{[]byte{0x3F, 0x00}, []byte{0x61, 0x10}},
+				{[]byte{0x00, 0xC0, 0x00, 0x00, 0x02}, []byte{0xC0, 0x62, 0x0E, 0x61, 0x0E}},
+			},
+			want: []byte{0x62, 0x0E, 0x61, 0x0E},
+		},
+		{
+			name: "case 4 with warning",
+			cmd:  []byte{0x00, 0xA4, 0x00, 0x00, 0x02, 0x3F, 0x00, 0x00},
+			steps: []t0Step{
+				{[]byte{0x00, 0xA4, 0x00, 0x00, 0x02}, []byte{0xA4}},
+				{[]byte{0x3F, 0x00}, []byte{0x62, 0x83}},
+				{[]byte{0x00, 0xC0, 0x00, 0x00, 0x00}, []byte{0x6C, 0x01}},
+				{[]byte{0x00, 0xC0, 0x00, 0x00, 0x01}, []byte{0xC0, 0x62, 0x90, 0x00}},
+			},
+			want: []byte{0x62, 0x62, 0x83},
+		},
+		{
+			name: "case 4 without data",
+			cmd:  []byte{0x00, 0xA4, 0x00, 0x00, 0x02, 0x3F, 0x00, 0x00},
+			steps: []t0Step{
+				{[]byte{0x00, 0xA4, 0x00, 0x00, 0x02}, []byte{0xA4}},
+				{[]byte{0x3F, 0x00}, []byte{0x6A, 0x82}},
+			},
+			want: []byte{0x6A, 0x82},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := &t0Card{t: t, steps: tt.steps}
+			got, err := NewT0(card).Transmit(tt.cmd)
+			if err != nil {
+				t.Fatalf("Transmit() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Transmit() = % X, want % X", got, tt.want)
+			}
+			if len(card.steps) > 0 {
+				t.Errorf("%d steps left", len(card.steps))
+			}
+		})
+	}
+}
+
+func TestT0Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   []byte
+		steps []t0Step
+	}{
+		{
+			name:  "unexpected procedure byte",
+			cmd:   []byte{0x00, 0xB0, 0x00, 0x00, 0x02},
+			steps: []t0Step{{[]byte{0x00, 0xB0, 0x00, 0x00, 0x02}, []byte{0x12}}},
+		},
+		{
+			name:  "too much data",
+			cmd:   []byte{0x00, 0xB0, 0x00, 0x00, 0x01},
+			steps: []t0Step{{[]byte{0x00, 0xB0, 0x00, 0x00, 0x01}, []byte{0x4F, 0x01, 0x4F, 0x02}}},
+		},
+		{
+			name: "invalid INS",
+			cmd:  []byte{0x00, 0x60, 0x00, 0x00},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := &t0Card{t: t, steps: tt.steps}
+			if _, err := NewT0(card).Transmit(tt.cmd); !errors.Is(err, ErrT0Protocol) {
+				t.Errorf("Transmit() error = %v, want %v", err, ErrT0Protocol)
+			}
+		})
+	}
+}
+
+func TestT0GetResponseLimit(t *testing.T) {
+	steps := []t0Step{{[]byte{0x00, 0x44, 0x00, 0x00, 0x00}, []byte{0x61, 0x00}}}
+	for i := 0; i < apdu.DefaultMaxIterations; i++ {
+		steps = append(steps, t0Step{[]byte{0x00, 0xC0, 0x00, 0x00, 0x00}, []byte{0x61, 0x00}})
+	}
+	card := &t0Card{t: t, steps: steps}
+	if _, err := NewT0(card).Transmit([]byte{0x00, 0x44, 0x00, 0x00}); !errors.Is(err, apdu.ErrTooManyIterations) {
+		t.Errorf("Transmit() error = %v, want %v", err, apdu.ErrTooManyIterations)
+	}
+	if len(card.steps) != 0 {
+		t.Errorf("%d GET RESPONSE steps left", len(card.steps))
+	}
+}
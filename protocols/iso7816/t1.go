@@ -0,0 +1,418 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// T1MaxIFS is the largest information field size of T=1.
+	T1MaxIFS = 254
+	// T1DefaultIFS is the information field size used until negotiated otherwise.
+	T1DefaultIFS = 32
+	// T1DefaultRetries is the number of times a block is repeated before
+	// the engine resynchronises.
+	T1DefaultRetries = 3
+)
+
+var (
+	// ErrT1Protocol is returned when the card violates the T=1 protocol
+	// or the error recovery of ISO 7816-3 section 11.6.3 was exhausted.
+	ErrT1Protocol = errors.New("iso7816: T=1 protocol error")
+	// ErrT1Aborted is returned when the card aborts a chain with S(ABORT).
+	ErrT1Aborted = errors.New("iso7816: T=1 chain aborted by the card")
+	// errT1Invalid marks a received block which failed the EDC or
+	// structure checks and may be recovered by an R-block.
+	errT1Invalid = errors.New("iso7816: invalid T=1 block")
+)
+
+// S-block types, bits 5 to 1 of the PCB.
+const (
+	t1Resynch = 0x00
+	t1IFS     = 0x01
+	t1Abort   = 0x02
+	t1WTX     = 0x03
+)
+
+// R-block error codes, bits 4 to 1 of the PCB.
+const (
+	t1ErrorFree  = 0x00
+	t1ErrorEDC   = 0x01
+	t1ErrorOther = 0x02
+)
+
+// Port is a raw half duplex byte stream to a card, such as a serial
+// reader without CCID. A Read which times out should return an error
+// implementing Timeout() bool so the engine can recover the lost block.
+type Port interface {
+	io.Reader
+	io.Writer
+}
+
+// WaitingTimeExtender is implemented by ports able to extend the block
+// waiting time of the next block as requested by S(WTX).
+type WaitingTimeExtender interface {
+	ExtendWaitingTime(multiplier int)
+}
+
+// t1Block is a T=1 block without its epilogue.
+type t1Block struct {
+	nad byte
+	pcb byte
+	inf []byte
+}
+
+func t1IBlock(ns byte, more bool, inf []byte) t1Block {
+	pcb := ns << 6
+	if more {
+		pcb |= 0x20
+	}
+	return t1Block{pcb: pcb, inf: inf}
+}
+
+func t1RBlock(nr byte, code byte) t1Block {
+	return t1Block{pcb: 0x80 | nr<<4 | code}
+}
+
+func t1SBlock(typ byte, response bool, inf []byte) t1Block {
+	pcb := 0xC0 | typ
+	if response {
+		pcb |= 0x20
+	}
+	return t1Block{pcb: pcb, inf: inf}
+}
+
+func (b t1Block) isI() bool       { return b.pcb&0x80 == 0 }
+func (b t1Block) isR() bool       { return b.pcb&0xC0 == 0x80 }
+func (b t1Block) isS() bool       { return b.pcb&0xC0 == 0xC0 }
+func (b t1Block) ns() byte        { return b.pcb >> 6 & 0x01 }
+func (b t1Block) more() bool      { return b.pcb&0x20 != 0 }
+func (b t1Block) nr() byte        { return b.pcb >> 4 & 0x01 }
+func (b t1Block) sType() byte     { return b.pcb & 0x1F }
+func (b t1Block) sResponse() bool { return b.pcb&0x20 != 0 }
+
+// encode returns the block with its LRC or CRC epilogue.
+func (b t1Block) encode(crc bool) []byte {
+	out := make([]byte, 0, 3+len(b.inf)+2)
+	out = append(out, b.nad, b.pcb, byte(len(b.inf)))
+	out = append(out, b.inf...)
+	if crc {
+		c := t1CRC(out)
+		return append(out, byte(c>>8), byte(c))
+	}
+	return append(out, t1LRC(out))
+}
+
+// String describes the block for error messages.
+func (b t1Block) String() string {
+	switch {
+	case b.isI():
+		return fmt.Sprintf("I(%d,%v) %d bytes", b.ns(), b.more(), len(b.inf))
+	case b.isR():
+		return fmt.Sprintf("R(%d) code %d", b.nr(), b.pcb&0x0F)
+	}
+	return fmt.Sprintf("S(%02X,response=%v)", b.sType(), b.sResponse())
+}
+
+// decodeT1Block checks the epilogue and structure of a complete block.
+func decodeT1Block(raw []byte, crc bool) (t1Block, error) {
+	edcLen := 1
+	if crc {
+		edcLen = 2
+	}
+	if len(raw) < 3+edcLen || int(raw[2])+3+edcLen != len(raw) {
+		return t1Block{}, fmt.Errorf("%w: length mismatch", errT1Invalid)
+	}
+	body := raw[:len(raw)-edcLen]
+	if crc {
+		c := t1CRC(body)
+		if raw[len(raw)-2] != byte(c>>8) || raw[len(raw)-1] != byte(c) {
+			return t1Block{}, fmt.Errorf("%w: CRC mismatch", errT1Invalid)
+		}
+	} else if t1LRC(body) != raw[len(raw)-1] {
+		return t1Block{}, fmt.Errorf("%w: LRC mismatch", errT1Invalid)
+	}
+
+	b := t1Block{nad: raw[0], pcb: raw[1], inf: append([]byte(nil), body[3:]...)}
+	switch {
+	case raw[2] == 0xFF:
+		return t1Block{}, fmt.Errorf("%w: LEN FF", errT1Invalid)
+	case b.isR() && (len(b.inf) != 0 || b.pcb&0x2C != 0):
+		return t1Block{}, fmt.Errorf("%w: malformed R-block", errT1Invalid)
+	case b.isS() && b.sType() > t1WTX:
+		return t1Block{}, fmt.Errorf("%w: unknown S-block", errT1Invalid)
+	case b.isS() && b.sType() != t1Resynch && b.sType() != t1Abort && len(b.inf) != 1:
+		return t1Block{}, fmt.Errorf("%w: S-block without parameter", errT1Invalid)
+	}
+	return b, nil
+}
+
+// t1LRC is the longitudinal redundancy check, the XOR of all bytes.
+func t1LRC(data []byte) byte {
+	var x byte
+	for _, b := range data {
+		x ^= b
+	}
+	return x
+}
+
+// t1CRC is the ISO/IEC 13239 CRC used as T=1 EDC, transmitted most
+// significant byte first.
+func t1CRC(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// readT1Block reads one block from r.
+func readT1Block(r io.Reader, crc bool) ([]byte, error) {
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	edcLen := 1
+	if crc {
+		edcLen = 2
+	}
+	rest := make([]byte, int(head[2])+edcLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	return append(head, rest...), nil
+}
+
+func isTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// T1 drives the ISO 7816-3 T=1 block transmission protocol over a Port.
+// It implements the apdu Transmitter interface.
+type T1 struct {
+	// NAD is the node address byte sent with every block.
+	NAD byte
+	// MaxRetries is the number of times a block is repeated before resynchronisation.
+	MaxRetries int
+
+	port Port
+	crc  bool
+	ifsc int // largest INF the card accepts
+	ifsd int // largest INF we accept
+	ns   byte
+	nr   byte
+}
+
+// NewT1 returns a T=1 engine on port using the IFSC and EDC announced
+// by atr, which may be nil for the defaults.
+func NewT1(port Port, atr *ATR) *T1 {
+	t := &T1{
+		MaxRetries: T1DefaultRetries,
+		port:       port,
+		ifsc:       T1DefaultIFS,
+		ifsd:       T1DefaultIFS,
+	}
+	if atr != nil {
+		t.ifsc = atr.IFSC()
+		t.crc = atr.UsesCRC()
+	}
+	return t
+}
+
+// IFSC returns the current information field size of the card.
+func (t *T1) IFSC() int { return t.ifsc }
+
+// IFSD returns the current information field size of the interface device.
+func (t *T1) IFSD() int { return t.ifsd }
+
+// NegotiateIFSD announces the largest information field the interface
+// device accepts with S(IFS request).
+func (t *T1) NegotiateIFSD(n int) error {
+	if n < 1 || n > T1MaxIFS {
+		return fmt.Errorf("%w: IFSD %d out of range", ErrT1Protocol, n)
+	}
+	resp, err := t.exchange(t1SBlock(t1IFS, false, []byte{byte(n)}))
+	if err != nil {
+		return err
+	}
+	if !resp.isS() || resp.sType() != t1IFS || !resp.sResponse() || resp.inf[0] != byte(n) {
+		return fmt.Errorf("%w: unexpected %s answering S(IFS request)", ErrT1Protocol, resp)
+	}
+	t.ifsd = n
+	return nil
+}
+
+// Resync resynchronises the protocol with S(RESYNCH request), resetting
+// the send and receive sequence numbers.
+func (t *T1) Resync() error {
+	req := t1SBlock(t1Resynch, false, nil)
+	for i := 0; i <= t.MaxRetries; i++ {
+		if err := t.send(req); err != nil {
+			return err
+		}
+		resp, err := t.receive()
+		if errors.Is(err, errT1Invalid) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resp.isS() && resp.sType() == t1Resynch && resp.sResponse() {
+			t.ns, t.nr = 0, 0
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: resynchronisation failed", ErrT1Protocol)
+}
+
+// Transmit sends a command APDU and returns the response APDU, chaining
+// in both directions as required by the information field sizes.
+func (t *T1) Transmit(cmd []byte) ([]byte, error) {
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("%w: empty APDU", ErrT1Protocol)
+	}
+
+	var resp t1Block
+	for off := 0; off < len(cmd); off += t.ifsc {
+		end := min(off+t.ifsc, len(cmd))
+		more := end < len(cmd)
+		var err error
+		if resp, err = t.exchange(t1IBlock(t.ns, more, cmd[off:end])); err != nil {
+			return nil, err
+		}
+		t.ns ^= 1
+		if more {
+			if !resp.isR() || resp.nr() != t.ns {
+				return nil, fmt.Errorf("%w: unexpected %s while chaining", ErrT1Protocol, resp)
+			}
+		}
+	}
+
+	var out []byte
+	for {
+		if !resp.isI() || resp.ns() != t.nr {
+			return nil, fmt.Errorf("%w: unexpected %s awaiting the response", ErrT1Protocol, resp)
+		}
+		if len(resp.inf) > t.ifsd {
+			return nil, fmt.Errorf("%w: %d bytes exceed IFSD %d", ErrT1Protocol, len(resp.inf), t.ifsd)
+		}
+		out = append(out, resp.inf...)
+		t.nr ^= 1
+		if !resp.more() {
+			return out, nil
+		}
+		var err error
+		if resp, err = t.exchange(t1RBlock(t.nr, t1ErrorFree)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// exchange sends blk and returns the next block of the card which is not
+// part of error recovery or an S-block request handled on the fly.
+func (t *T1) exchange(blk t1Block) (t1Block, error) {
+	if err := t.send(blk); err != nil {
+		return t1Block{}, err
+	}
+	retries := 0
+	retry := func(b t1Block) error {
+		retries++
+		if retries > t.MaxRetries {
+			if err := t.Resync(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: resynchronised after %d failed attempts", ErrT1Protocol, retries)
+		}
+		return t.send(b)
+	}
+
+	for {
+		resp, err := t.receive()
+		if errors.Is(err, errT1Invalid) {
+			code := byte(t1ErrorOther)
+			if !isTimeout(err) {
+				code = t1ErrorEDC
+			}
+			if err := retry(t1RBlock(t.nr, code)); err != nil {
+				return t1Block{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return t1Block{}, err
+		}
+
+		switch {
+		case resp.isS() && !resp.sResponse():
+			switch resp.sType() {
+			case t1WTX:
+				if ext, ok := t.port.(WaitingTimeExtender); ok {
+					ext.ExtendWaitingTime(int(resp.inf[0]))
+				}
+			case t1IFS:
+				// IFS 00 and FF are RFU: the request is an invalid block,
+				// rejected with an R-block while the IFSC is kept.
+				n := int(resp.inf[0])
+				if n < 1 || n > T1MaxIFS {
+					if err := retry(t1RBlock(t.nr, t1ErrorOther)); err != nil {
+						return t1Block{}, err
+					}
+					continue
+				}
+				t.ifsc = n
+			case t1Abort:
+				if err := t.send(t1SBlock(t1Abort, true, nil)); err != nil {
+					return t1Block{}, err
+				}
+				return t1Block{}, ErrT1Aborted
+			case t1Resynch:
+				return t1Block{}, fmt.Errorf("%w: card requested resynchronisation", ErrT1Protocol)
+			}
+			if err := t.send(t1SBlock(resp.sType(), true, resp.inf)); err != nil {
+				return t1Block{}, err
+			}
+		case resp.isR() && blk.isI() && resp.nr() != blk.ns():
+			// Acknowledgement of a chained I-block.
+			return resp, nil
+		case resp.isR():
+			// The card did not receive blk correctly.
+			if err := retry(blk); err != nil {
+				return t1Block{}, err
+			}
+		default:
+			return resp, nil
+		}
+	}
+}
+
+func (t *T1) send(b t1Block) error {
+	b.nad = t.NAD
+	_, err := t.port.Write(b.encode(t.crc))
+	return err
+}
+
+// receive reads a block. Blocks which are lost or corrupted are reported
+// as errT1Invalid, other port errors are returned as they are.
+func (t *T1) receive() (t1Block, error) {
+	raw, err := readT1Block(t.port, t.crc)
+	if err != nil {
+		if isTimeout(err) {
+			return t1Block{}, fmt.Errorf("%w: %w", errT1Invalid, err)
+		}
+		return t1Block{}, err
+	}
+	return decodeT1Block(raw, t.crc)
+}
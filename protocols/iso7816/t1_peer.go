@@ -0,0 +1,204 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import "bytes"
+
+// errPeerTimeout is returned by T1Peer.Read when the card has nothing to send.
+var errPeerTimeout = &peerTimeoutError{}
+
+type peerTimeoutError struct{}
+
+func (*peerTimeoutError) Error() string { return "iso7816: T=1 peer: no block to read" }
+func (*peerTimeoutError) Timeout() bool { return true }
+
+// T1Peer simulates the card side of T=1 in memory. It implements Port,
+// so a T1 engine can be tested against it without hardware.
+type T1Peer struct {
+	// Handler processes every complete command APDU and returns the
+	// response APDU.
+	Handler func(cmd []byte) []byte
+	// WTX is the number of S(WTX request) blocks sent before each response.
+	WTX int
+	// Corrupt is the number of following blocks sent with a broken EDC.
+	Corrupt int
+	// Abort makes the peer answer the next chained I-block with S(ABORT request).
+	Abort bool
+	// Received records every valid block written by the interface device.
+	Received [][]byte
+
+	crc  bool
+	ifsc int
+	ifsd int
+	ns   byte
+	nr   byte
+
+	in         []byte
+	out        bytes.Buffer
+	cmd        []byte
+	resp       []byte
+	wtxLeft    int
+	last       t1Block
+	hasLast    bool
+	responded  bool
+	ifsReq     int
+	ifsPending bool
+}
+
+// NewT1Peer returns a simulated card accepting information fields of up
+// to ifsc bytes and using the CRC instead of the LRC when crc is set.
+func NewT1Peer(handler func(cmd []byte) []byte, ifsc int, crc bool) *T1Peer {
+	return &T1Peer{Handler: handler, crc: crc, ifsc: ifsc, ifsd: T1DefaultIFS}
+}
+
+// IFSC returns the information field size of the simulated card.
+func (p *T1Peer) IFSC() int { return p.ifsc }
+
+// IFSD returns the information field size announced by the interface device.
+func (p *T1Peer) IFSD() int { return p.ifsd }
+
+// RequestIFS makes the peer announce a new IFSC with S(IFS request)
+// before its next response.
+func (p *T1Peer) RequestIFS(n int) {
+	p.ifsReq, p.ifsPending = n, true
+}
+
+// Read returns the pending block of the card, or a timeout error when
+// there is none.
+func (p *T1Peer) Read(b []byte) (int, error) {
+	if p.out.Len() == 0 {
+		return 0, errPeerTimeout
+	}
+	return p.out.Read(b)
+}
+
+// Write receives bytes from the interface device and answers every
+// complete block.
+func (p *T1Peer) Write(b []byte) (int, error) {
+	p.in = append(p.in, b...)
+	edcLen := 1
+	if p.crc {
+		edcLen = 2
+	}
+	for len(p.in) >= 3 && len(p.in) >= 3+int(p.in[2])+edcLen {
+		n := 3 + int(p.in[2]) + edcLen
+		raw := p.in[:n]
+		p.in = p.in[n:]
+		p.handle(raw)
+	}
+	return len(b), nil
+}
+
+func (p *T1Peer) handle(raw []byte) {
+	blk, err := decodeT1Block(raw, p.crc)
+	if err != nil {
+		p.write(t1RBlock(p.nr, t1ErrorEDC))
+		return
+	}
+	p.Received = append(p.Received, append([]byte(nil), raw...))
+
+	switch {
+	case blk.isI():
+		if blk.ns() != p.nr {
+			// A repeated block we already acknowledged.
+			p.resend()
+			return
+		}
+		if len(blk.inf) > p.ifsc {
+			p.write(t1RBlock(p.nr, t1ErrorOther))
+			return
+		}
+		if blk.more() && p.Abort {
+			p.Abort = false
+			p.cmd = nil
+			p.send(t1SBlock(t1Abort, false, nil))
+			return
+		}
+		p.nr ^= 1
+		p.cmd = append(p.cmd, blk.inf...)
+		if blk.more() {
+			p.send(t1RBlock(p.nr, t1ErrorFree))
+			return
+		}
+		cmd := p.cmd
+		p.cmd = nil
+		p.resp = p.Handler(cmd)
+		p.responded = false
+		p.wtxLeft = p.WTX
+		p.next()
+	case blk.isR():
+		if p.ifsPending && p.last.isS() && p.last.sType() == t1IFS && !p.last.sResponse() {
+			// The interface device rejected the S(IFS request).
+			p.ifsPending = false
+			p.next()
+			return
+		}
+		if len(p.resp) > 0 && p.responded && blk.nr() == p.ns {
+			p.next()
+			return
+		}
+		p.resend()
+	case blk.sResponse():
+		switch blk.sType() {
+		case t1IFS:
+			p.ifsc, p.ifsPending = p.ifsReq, false
+			p.next()
+		case t1WTX:
+			p.next()
+		}
+	default:
+		switch blk.sType() {
+		case t1Resynch:
+			p.ns, p.nr = 0, 0
+			p.cmd, p.resp = nil, nil
+		case t1IFS:
+			p.ifsd = int(blk.inf[0])
+		}
+		p.send(t1SBlock(blk.sType(), true, blk.inf))
+	}
+}
+
+// next sends a pending S-block request or the next response I-block.
+func (p *T1Peer) next() {
+	if p.ifsPending {
+		p.send(t1SBlock(t1IFS, false, []byte{byte(p.ifsReq)}))
+		return
+	}
+	if p.wtxLeft > 0 {
+		p.wtxLeft--
+		p.send(t1SBlock(t1WTX, false, []byte{0x02}))
+		return
+	}
+	n := min(len(p.resp), p.ifsd)
+	inf := p.resp[:n]
+	p.resp = p.resp[n:]
+	more := len(p.resp) > 0
+	p.responded = true
+	p.send(t1IBlock(p.ns, more, inf))
+	p.ns ^= 1
+}
+
+func (p *T1Peer) resend() {
+	if p.hasLast {
+		p.write(p.last)
+		return
+	}
+	p.send(t1RBlock(p.nr, t1ErrorOther))
+}
+
+func (p *T1Peer) send(b t1Block) {
+	p.last, p.hasLast = b, true
+	p.write(b)
+}
+
+func (p *T1Peer) write(b t1Block) {
+	raw := b.encode(p.crc)
+	if p.Corrupt > 0 {
+		p.Corrupt--
+		raw[len(raw)-1] ^= 0xFF
+	}
+	p.out.Reset()
+	p.out.Write(raw)
+}
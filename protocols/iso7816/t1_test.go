@@ -0,0 +1,199 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// echoCard answers every command with its data field followed by 9000.
+func echoCard(cmd []byte) []byte {
+	var data []byte
+	if len(cmd) > 5 {
+		data = cmd[5 : 5+int(cmd[4])]
+	}
+	return append(append([]byte(nil), data...), 0x90, 0x00)
+}
+
+func sequence(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestT1Transmit(t *testing.T) {
+	tests := []struct {
+		name       string
+		crc        bool
+		ifsc, ifsd int
+		data       int
+		wtx        int
+		corrupt    int
+		blocks     int // blocks sent by the interface device
+	}{
+		{name: "single block", ifsc: 32, ifsd: 32, data: 4, blocks: 1},
+		{name: "single block CRC", crc: true, ifsc: 32, ifsd: 32, data: 4, blocks: 1},
+		{name: "command chaining", ifsc: 16, ifsd: 254, data: 40, blocks: 3},
+		{name: "response chaining", ifsc: 254, ifsd: 16, data: 40, blocks: 3},
+		{name: "both directions CRC", crc: true, ifsc: 10, ifsd: 20, data: 30, blocks: 4 + 1},
+		{name: "waiting time extension", ifsc: 32, ifsd: 32, data: 4, wtx: 2, blocks: 3},
+		{name: "corrupted response", ifsc: 32, ifsd: 32, data: 4, corrupt: 2, blocks: 3},
+		{name: "corrupted while chaining", ifsc: 16, ifsd: 16, data: 40, corrupt: 1, blocks: 3 + 2 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := NewT1Peer(echoCard, tt.ifsc, tt.crc)
+			peer.WTX = tt.wtx
+			engine := NewT1(peer, nil)
+			engine.crc = tt.crc
+			engine.ifsc = tt.ifsc
+			if tt.ifsd != T1DefaultIFS {
+				if err := engine.NegotiateIFSD(tt.ifsd); err != nil {
+					t.Fatalf("NegotiateIFSD() error = %v", err)
+				}
+				if peer.IFSD() != tt.ifsd {
+					t.Fatalf("peer IFSD = %d, want %d", peer.IFSD(), tt.ifsd)
+				}
+				peer.Received = nil
+			}
+			peer.Corrupt = tt.corrupt
+
+			data := sequence(tt.data)
+			cmd := append([]byte{0x00, 0xD6, 0x00, 0x00, byte(len(data))}, data...)
+			got, err := engine.Transmit(cmd)
+			if err != nil {
+				t.Fatalf("Transmit() error = %v", err)
+			}
+			if want := append(append([]byte(nil), data...), 0x90, 0x00); !bytes.Equal(got, want) {
+				t.Errorf("Transmit() = % X, want % X", got, want)
+			}
+			if len(peer.Received) != tt.blocks {
+				t.Errorf("peer received %d blocks, want %d", len(peer.Received), tt.blocks)
+			}
+
+			// Sequence numbers must stay in step for the next command.
+			if got, err := engine.Transmit([]byte{0x00, 0xB0, 0x00, 0x00, 0x00}); err != nil || !bytes.Equal(got, []byte{0x90, 0x00}) {
+				t.Errorf("second Transmit() = % X, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestT1CardIFS(t *testing.T) {
+	peer := NewT1Peer(echoCard, 32, false)
+	engine := NewT1(peer, nil)
+	peer.RequestIFS(8)
+	if _, err := engine.Transmit([]byte{0x00, 0xA4, 0x04, 0x00}); err != nil {
+		t.Fatalf("Transmit() error = %v", err)
+	}
+	if engine.IFSC() != 8 || peer.IFSC() != 8 {
+		t.Fatalf("IFSC = %d, peer %d, want 8", engine.IFSC(), peer.IFSC())
+	}
+
+	peer.Received = nil
+	data := sequence(20)
+	if _, err := engine.Transmit(append([]byte{0x00, 0xD6, 0x00, 0x00, byte(len(data))}, data...)); err != nil {
+		t.Fatalf("Transmit() error = %v", err)
+	}
+	if len(peer.Received) != 4 {
+		t.Errorf("peer received %d blocks, want 4", len(peer.Received))
+	}
+}
+
+func TestT1InvalidIFS(t *testing.T) {
+	atr := []byte{0x3B, 0x80, 0x81, 0x11, 0x00, 0x00}
+	fixTCK(atr)
+	a, err := ParseATR(atr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := NewT1Peer(echoCard, 32, false)
+	engine := NewT1(peer, a)
+	if engine.IFSC() != T1DefaultIFS {
+		t.Fatalf("IFSC from TA 00 = %d, want %d", engine.IFSC(), T1DefaultIFS)
+	}
+	if _, err := engine.Transmit([]byte{0x00, 0xA4, 0x04, 0x00}); err != nil {
+		t.Fatalf("Transmit() error = %v", err)
+	}
+
+	for _, n := range []int{0x00, 0xFF} {
+		peer := NewT1Peer(echoCard, 32, false)
+		engine := NewT1(peer, nil)
+		peer.RequestIFS(n)
+		if _, err := engine.Transmit([]byte{0x00, 0xA4, 0x04, 0x00}); err != nil {
+			t.Errorf("Transmit() after S(IFS request %02X) error = %v", n, err)
+		}
+		if engine.IFSC() != T1DefaultIFS || peer.IFSC() != 32 {
+			t.Errorf("IFSC after S(IFS request %02X) = %d, peer %d", n, engine.IFSC(), peer.IFSC())
+		}
+		var rejected bool
+		for _, raw := range peer.Received {
+			blk, _ := decodeT1Block(raw, false)
+			switch {
+			case blk.isR() && blk.pcb&0x0F == t1ErrorOther:
+				rejected = true
+			case blk.isS() && blk.sType() == t1IFS:
+				t.Errorf("S(IFS request %02X) answered with %s", n, blk)
+			}
+		}
+		if !rejected {
+			t.Errorf("S(IFS request %02X) not rejected with an R-block", n)
+		}
+	}
+}
+
+func TestT1Resync(t *testing.T) {
+	peer := NewT1Peer(echoCard, 32, false)
+	engine := NewT1(peer, nil)
+	if _, err := engine.Transmit([]byte{0x00, 0xB0, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatalf("Transmit() error = %v", err)
+	}
+
+	peer.Corrupt = 1 + engine.MaxRetries
+	if _, err := engine.Transmit([]byte{0x00, 0xB0, 0x00, 0x00, 0x00}); !errors.Is(err, ErrT1Protocol) {
+		t.Fatalf("Transmit() error = %v, want %v", err, ErrT1Protocol)
+	}
+	if engine.ns != 0 || engine.nr != 0 {
+		t.Errorf("sequence numbers not reset: N(S) %d N(R) %d", engine.ns, engine.nr)
+	}
+	if got, err := engine.Transmit([]byte{0x00, 0xB0, 0x00, 0x00, 0x00}); err != nil || !bytes.Equal(got, []byte{0x90, 0x00}) {
+		t.Errorf("Transmit() after resync = % X, %v", got, err)
+	}
+}
+
+func TestT1Abort(t *testing.T) {
+	peer := NewT1Peer(echoCard, 8, false)
+	peer.Abort = true
+	engine := NewT1(peer, nil)
+	engine.ifsc = 8
+	if _, err := engine.Transmit(append([]byte{0x00, 0xD6, 0x00, 0x00, 0x10}, sequence(16)...)); !errors.Is(err, ErrT1Aborted) {
+		t.Fatalf("Transmit() error = %v, want %v", err, ErrT1Aborted)
+	}
+	if got, err := engine.Transmit([]byte{0x00, 0xB0, 0x00, 0x00, 0x00}); err != nil || !bytes.Equal(got, []byte{0x90, 0x00}) {
+		t.Errorf("Transmit() after abort = % X, %v", got, err)
+	}
+}
+
+func TestT1EDC(t *testing.T) {
+	blk := t1IBlock(0, false, []byte{0x00, 0xA4, 0x04, 0x00})
+	for _, crc := range []bool{false, true} {
+		raw := blk.encode(crc)
+		if _, err := decodeT1Block(raw, crc); err != nil {
+			t.Errorf("decodeT1Block(crc=%v) error = %v", crc, err)
+		}
+		raw[4] ^= 0x01
+		if _, err := decodeT1Block(raw, crc); !errors.Is(err, errT1Invalid) {
+			t.Errorf("decodeT1Block(crc=%v) corrupted error = %v", crc, err)
+		}
+	}
+	// CRC-16/X-25 without the final inversion of "123456789" is 0x906E ^ 0xFFFF.
+	if got := t1CRC([]byte("123456789")); got != 0x906E^0xFFFF {
+		t.Errorf("t1CRC() = %04X", got)
+	}
+}
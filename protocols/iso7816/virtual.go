@@ -0,0 +1,727 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"sync"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+// Status words answered by the virtual card.
+const (
+	swOK                   = 0x9000
+	swEndOfFile            = 0x6282
+	swWrongLength          = 0x6700
+	swChannelNotSupported  = 0x6881
+	swSMNotSupported       = 0x6882
+	swChainingNotSupported = 0x6884
+	swIncompatibleFile     = 0x6981
+	swSecurityStatus       = 0x6982
+	swBlocked              = 0x6983
+	swNotAllowed           = 0x6986
+	swWrongData            = 0x6A80
+	swFileNotFound         = 0x6A82
+	swRecordNotFound       = 0x6A83
+	swNotEnoughMemory      = 0x6A84
+	swWrongP1P2            = 0x6A86
+	swDataNotFound         = 0x6A88
+	swWrongParameters      = 0x6B00
+	swINSNotSupported      = 0x6D00
+	swCLANotSupported      = 0x6E00
+)
+
+// vfile is a file of the virtual card.
+type vfile struct {
+	fid       uint16
+	name      []byte
+	structure FileStructure
+	sfi       byte
+	size      int
+	data      []byte
+	recSize   int
+	maxRecs   int
+	records   [][]byte
+	read      Access
+	update    Access
+	parent    *vfile
+	children  []*vfile
+}
+
+func (f *vfile) isDF() bool {
+	return f.structure == StructureNone
+}
+
+// vpin is the reference data of the virtual card with its counters.
+type vpin struct {
+	VirtualPIN
+	left     int
+	pukLeft  int
+	verified bool
+}
+
+// VirtualCard is an in-memory card answering the interindustry commands
+// for files and PINs: SELECT, READ and UPDATE BINARY, READ, UPDATE,
+// APPEND and SEARCH RECORD, VERIFY, CHANGE REFERENCE DATA and RESET
+// RETRY COUNTER. It implements apdu.Transmitter like a PC/SC card, only
+// on the basic channel and without secure messaging.
+type VirtualCard struct {
+	mu   sync.Mutex
+	atr  []byte
+	mf   *vfile
+	df   *vfile
+	ef   *vfile
+	rec  int
+	pins map[byte]*vpin
+}
+
+// NewVirtualCard builds a virtual card from profile p, whose data is
+// copied. The MF is selected and no PIN is verified.
+func NewVirtualCard(p *VirtualProfile) (*VirtualCard, error) {
+	v := &VirtualCard{atr: bytes.Clone(p.ATR), pins: map[byte]*vpin{}}
+	for _, pin := range p.PINs {
+		if _, ok := v.pins[pin.Ref]; ok || len(pin.Value) == 0 || pin.Retries < 1 {
+			return nil, fmt.Errorf("%w: PIN %02X", ErrInvalidProfile, pin.Ref)
+		}
+		pin.Value, pin.PUK = bytes.Clone(pin.Value), bytes.Clone(pin.PUK)
+		if pin.PUKRetries == 0 {
+			pin.PUKRetries = pin.Retries
+		}
+		v.pins[pin.Ref] = &vpin{VirtualPIN: pin, left: pin.Retries, pukLeft: pin.PUKRetries}
+	}
+	mf := p.MF
+	if mf.FID == nil {
+		mf.FID = fidBytes(FIDMasterFile)
+	}
+	if mf.Structure == "" {
+		mf.Structure = "df"
+	}
+	root, err := v.build(&mf, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !root.isDF() || root.fid != FIDMasterFile {
+		return nil, fmt.Errorf("%w: the MF must be a DF with identifier 3F00", ErrInvalidProfile)
+	}
+	v.mf, v.df = root, root
+	return v, nil
+}
+
+func (v *VirtualCard) build(spec *VirtualFile, parent *vfile) (*vfile, error) {
+	if len(spec.FID) != 2 {
+		return nil, fmt.Errorf("%w: file identifier %X", ErrInvalidProfile, []byte(spec.FID))
+	}
+	f := &vfile{
+		fid:     uint16(spec.FID[0])<<8 | uint16(spec.FID[1]),
+		name:    bytes.Clone(spec.Name),
+		sfi:     spec.SFI,
+		size:    max(spec.Size, len(spec.Data)),
+		recSize: spec.RecordSize,
+		maxRecs: spec.MaxRecords,
+		read:    spec.Read,
+		update:  spec.Update,
+		parent:  parent,
+	}
+	s, ok := virtualStructures[spec.Structure]
+	if !ok {
+		return nil, fmt.Errorf("%w: %04X structure %q", ErrInvalidProfile, f.fid, spec.Structure)
+	}
+	f.structure = s
+	if f.sfi > 30 || len(spec.Children) > 0 && !f.isDF() {
+		return nil, fmt.Errorf("%w: %04X", ErrInvalidProfile, f.fid)
+	}
+	for _, ref := range []Access{f.read, f.update} {
+		if ref > 0 && v.pins[byte(ref)] == nil {
+			return nil, fmt.Errorf("%w: %04X refers to unknown PIN %02X", ErrInvalidProfile, f.fid, byte(ref))
+		}
+	}
+	f.data = make([]byte, f.size)
+	copy(f.data, spec.Data)
+	for _, r := range spec.Records {
+		if !f.validRecord(r) {
+			return nil, fmt.Errorf("%w: %04X record of %d bytes", ErrInvalidProfile, f.fid, len(r))
+		}
+		f.records = append(f.records, bytes.Clone(r))
+	}
+	if f.maxRecs == 0 {
+		f.maxRecs = 0xFE
+	}
+	for i := range spec.Children {
+		c, err := v.build(&spec.Children[i], f)
+		if err != nil {
+			return nil, err
+		}
+		f.children = append(f.children, c)
+	}
+	return f, nil
+}
+
+// validRecord reports whether r fits the record structure of f.
+func (f *vfile) validRecord(r []byte) bool {
+	switch {
+	case !f.structure.IsRecord(), len(r) == 0 || len(r) > 0xFF:
+		return false
+	case f.structure == StructureLinearVariable:
+		return f.recSize == 0 || len(r) <= f.recSize
+	}
+	return len(r) == f.recSize
+}
+
+// ATR returns the answer to reset of the profile.
+func (v *VirtualCard) ATR() []byte {
+	return bytes.Clone(v.atr)
+}
+
+// Reset returns the card to its state after the answer to reset: the MF
+// is selected and all PINs lose their verified state. File contents and
+// retry counters persist.
+func (v *VirtualCard) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.df, v.ef, v.rec = v.mf, nil, 0
+	for _, p := range v.pins {
+		p.verified = false
+	}
+}
+
+// Transmit implements apdu.Transmitter. Malformed commands are answered
+// with a status word; the error is always nil.
+func (v *VirtualCard) Transmit(raw []byte) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cmd, err := apdu.UnmarshalCommand(raw)
+	if err != nil {
+		return status(swWrongLength), nil
+	}
+	data, sw := v.process(cmd)
+	return append(data, byte(sw>>8), byte(sw)), nil
+}
+
+func status(sw uint16) []byte {
+	return []byte{byte(sw >> 8), byte(sw)}
+}
+
+func (v *VirtualCard) process(cmd *apdu.Command) ([]byte, uint16) {
+	switch {
+	case !IsInterindustryCLA(cmd.CLA):
+		return nil, swCLANotSupported
+	case CLAChannel(cmd.CLA) != 0:
+		return nil, swChannelNotSupported
+	case cmd.CLA&apdu.ClaChaining != 0:
+		return nil, swChainingNotSupported
+	case cmd.CLA&0x0C != 0:
+		return nil, swSMNotSupported
+	}
+	switch cmd.INS {
+	case INSSelect:
+		return v.selectFile(cmd)
+	case INSReadBinary:
+		return v.readBinary(cmd)
+	case INSUpdateBinary:
+		return nil, v.updateBinary(cmd)
+	case INSReadRecord:
+		return v.readRecord(cmd)
+	case INSUpdateRecord:
+		return nil, v.updateRecord(cmd)
+	case INSAppendRecord:
+		return nil, v.appendRecord(cmd)
+	case INSSearchRecord:
+		return v.searchRecord(cmd)
+	case INSVerify:
+		return nil, v.verify(cmd)
+	case INSChangeReferenceData:
+		return nil, v.changeReferenceData(cmd)
+	case INSResetRetryCounter:
+		return nil, v.resetRetryCounter(cmd)
+	}
+	return nil, swINSNotSupported
+}
+
+func (v *VirtualCard) selectFile(cmd *apdu.Command) ([]byte, uint16) {
+	var f *vfile
+	switch SelectMethod(cmd.P1) {
+	case SelectByFID:
+		f = v.findFID(cmd.Data)
+	case SelectChildDF, SelectChildEF:
+		if len(cmd.Data) != 2 {
+			return nil, swWrongLength
+		}
+		f = v.df.child(fidOf(cmd.Data))
+		if f != nil && f.isDF() != (SelectMethod(cmd.P1) == SelectChildDF) {
+			f = nil
+		}
+	case SelectParentDF:
+		f = v.df.parent
+	case SelectByDFName:
+		f = v.findName(cmd.Data, SelectReturn(cmd.P2)&0x03)
+	case SelectPathFromMF:
+		f = v.mf.path(cmd.Data)
+	case SelectPathFromDF:
+		f = v.df.path(cmd.Data)
+	default:
+		return nil, swWrongP1P2
+	}
+	if f == nil {
+		return nil, swFileNotFound
+	}
+	if f.isDF() {
+		v.df, v.ef = f, nil
+	} else {
+		v.df, v.ef = f.parent, f
+	}
+	v.rec = 0
+
+	var tag tlv.Tag
+	switch SelectReturn(cmd.P2) & 0x0C {
+	case ReturnFCI:
+		tag = TagFCI
+	case ReturnFCP:
+		tag = TagFCP
+	case ReturnFMD:
+		tag = TagFMD
+	default:
+		return nil, swOK
+	}
+	if cmd.Ne == 0 {
+		return nil, swOK
+	}
+	out, err := tlv.NewConstructed(tag, f.controlParameters()...).Marshal()
+	if err != nil {
+		return nil, swWrongData
+	}
+	if len(out) > cmd.Ne {
+		return nil, swWrongLe(len(out))
+	}
+	return out, swOK
+}
+
+// swWrongLe returns 6Cxx announcing the n bytes available, SW2 00 meaning
+// 256, or 6700 when n does not fit a short Le.
+func swWrongLe(n int) uint16 {
+	if n > 256 {
+		return swWrongLength
+	}
+	return 0x6C00 | uint16(n&0xFF)
+}
+
+func fidOf(b []byte) uint16 {
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// findFID looks for fid as SELECT by file identifier does: the MF, the
+// children of the current DF, the current DF, its parent and the
+// children of the parent.
+func (v *VirtualCard) findFID(data []byte) *vfile {
+	if len(data) == 0 {
+		return v.mf
+	}
+	if len(data) != 2 {
+		return nil
+	}
+	fid := fidOf(data)
+	switch {
+	case fid == FIDMasterFile:
+		return v.mf
+	case v.df.child(fid) != nil:
+		return v.df.child(fid)
+	case v.df.fid == fid:
+		return v.df
+	case v.df.parent == nil:
+		return nil
+	case v.df.parent.fid == fid:
+		return v.df.parent
+	}
+	return v.df.parent.child(fid)
+}
+
+// findName returns the DF, in depth first order, whose name starts with
+// name, after the current DF for OccurrenceNext.
+func (v *VirtualCard) findName(name []byte, occurrence SelectReturn) *vfile {
+	var dfs []*vfile
+	var walk func(f *vfile)
+	walk = func(f *vfile) {
+		if f.isDF() && len(f.name) > 0 && bytes.HasPrefix(f.name, name) {
+			dfs = append(dfs, f)
+		}
+		for _, c := range f.children {
+			walk(c)
+		}
+	}
+	walk(v.mf)
+	switch occurrence {
+	case OccurrenceFirst:
+		if len(dfs) > 0 {
+			return dfs[0]
+		}
+	case OccurrenceNext:
+		for i, f := range dfs {
+			if f == v.df && i+1 < len(dfs) {
+				return dfs[i+1]
+			}
+		}
+	}
+	return nil
+}
+
+func (f *vfile) child(fid uint16) *vfile {
+	for _, c := range f.children {
+		if c.fid == fid {
+			return c
+		}
+	}
+	return nil
+}
+
+// path follows the file identifiers of data from f.
+func (f *vfile) path(data []byte) *vfile {
+	if len(data) == 0 || len(data)%2 != 0 {
+		return nil
+	}
+	for ; len(data) > 0 && f != nil; data = data[2:] {
+		if !f.isDF() {
+			return nil
+		}
+		f = f.child(fidOf(data))
+	}
+	return f
+}
+
+// controlParameters returns the FCP data objects of f.
+func (f *vfile) controlParameters() tlv.List {
+	var objs tlv.List
+	switch {
+	case f.isDF():
+		objs = append(objs, tlv.New(TagFileDescriptor, []byte{0x38}))
+	case f.structure == StructureTransparent:
+		objs = append(objs,
+			tlv.New(TagFileSize, []byte{byte(f.size >> 8), byte(f.size)}),
+			tlv.New(TagFileDescriptor, []byte{byte(f.structure)}))
+	default:
+		objs = append(objs, tlv.New(TagFileDescriptor, []byte{
+			byte(f.structure), 0x21, byte(f.recSize >> 8), byte(f.recSize), byte(len(f.records)),
+		}))
+	}
+	objs = append(objs, tlv.New(TagFileID, fidBytes(f.fid)))
+	if len(f.name) > 0 {
+		objs = append(objs, tlv.New(TagDFName, f.name))
+	}
+	if f.sfi != 0 {
+		objs = append(objs, tlv.New(TagShortFileID, []byte{f.sfi << 3}))
+	}
+	return append(objs, tlv.New(TagLifeCycle, []byte{0x05}))
+}
+
+// efBySFI returns the EF with short identifier sfi in the current DF, or
+// the current EF when sfi is zero, and makes it current.
+func (v *VirtualCard) efBySFI(sfi byte) (*vfile, uint16) {
+	if sfi == 0 {
+		if v.ef == nil {
+			return nil, swNotAllowed
+		}
+		return v.ef, swOK
+	}
+	for _, c := range v.df.children {
+		if !c.isDF() && c.sfi == sfi {
+			if v.ef != c {
+				v.ef, v.rec = c, 0
+			}
+			return c, swOK
+		}
+	}
+	return nil, swFileNotFound
+}
+
+// allowed checks the access condition a against the security status.
+func (v *VirtualCard) allowed(a Access) uint16 {
+	switch {
+	case a == AccessAlways:
+		return swOK
+	case a == AccessNever:
+		return swNotAllowed
+	case v.pins[byte(a)] != nil && v.pins[byte(a)].verified:
+		return swOK
+	}
+	return swSecurityStatus
+}
+
+// binaryTarget resolves the EF and offset of READ and UPDATE BINARY.
+func (v *VirtualCard) binaryTarget(cmd *apdu.Command, access func(*vfile) Access) (*vfile, int, uint16) {
+	sfi, offset := byte(0), int(cmd.P1)<<8|int(cmd.P2)
+	if cmd.P1&0x80 != 0 {
+		if cmd.P1&0x60 != 0 {
+			return nil, 0, swWrongP1P2
+		}
+		sfi, offset = cmd.P1&0x1F, int(cmd.P2)
+	}
+	f, sw := v.efBySFI(sfi)
+	if sw != swOK {
+		return nil, 0, sw
+	}
+	if f.structure != StructureTransparent {
+		return nil, 0, swIncompatibleFile
+	}
+	if sw := v.allowed(access(f)); sw != swOK {
+		return nil, 0, sw
+	}
+	if offset > f.size {
+		return nil, 0, swWrongParameters
+	}
+	return f, offset, swOK
+}
+
+func (v *VirtualCard) readBinary(cmd *apdu.Command) ([]byte, uint16) {
+	f, offset, sw := v.binaryTarget(cmd, func(f *vfile) Access { return f.read })
+	if sw != swOK {
+		return nil, sw
+	}
+	if offset == f.size {
+		return nil, swWrongParameters
+	}
+	out := f.data[offset:min(offset+cmd.Ne, f.size)]
+	if len(out) < cmd.Ne {
+		return bytes.Clone(out), swEndOfFile
+	}
+	return bytes.Clone(out), swOK
+}
+
+func (v *VirtualCard) updateBinary(cmd *apdu.Command) uint16 {
+	f, offset, sw := v.binaryTarget(cmd, func(f *vfile) Access { return f.update })
+	if sw != swOK {
+		return sw
+	}
+	if offset+len(cmd.Data) > f.size {
+		return swWrongLength
+	}
+	copy(f.data[offset:], cmd.Data)
+	return swOK
+}
+
+// recordTarget resolves the EF of the record commands and checks its
+// access condition.
+func (v *VirtualCard) recordTarget(p2 byte, access func(*vfile) Access) (*vfile, uint16) {
+	f, sw := v.efBySFI(p2 >> 3)
+	if sw != swOK {
+		return nil, sw
+	}
+	if !f.structure.IsRecord() {
+		return nil, swIncompatibleFile
+	}
+	return f, v.allowed(access(f))
+}
+
+// recordNumber resolves the record referenced by P1 and the mode in P2:
+// the number P1 with mode 04, otherwise the first, last, next or
+// previous record relative to the record pointer.
+func (v *VirtualCard) recordNumber(f *vfile, p1, p2 byte) (int, uint16) {
+	n := len(f.records)
+	rec := 0
+	switch mode := p2 & 0x07; {
+	case mode == 0x04 && p1 != 0:
+		rec = int(p1)
+	case mode == 0x04:
+		rec = v.rec
+	case p1 != 0 || mode > 0x03:
+		return 0, swWrongP1P2
+	case mode == 0x00:
+		rec = 1
+	case mode == 0x01:
+		rec = n
+	case mode == 0x02:
+		rec = v.rec + 1
+	case mode == 0x03 && v.rec == 0:
+		rec = n
+	default:
+		rec = v.rec - 1
+	}
+	if rec < 1 || rec > n {
+		return 0, swRecordNotFound
+	}
+	return rec, swOK
+}
+
+func (v *VirtualCard) readRecord(cmd *apdu.Command) ([]byte, uint16) {
+	f, sw := v.recordTarget(cmd.P2, func(f *vfile) Access { return f.read })
+	if sw != swOK {
+		return nil, sw
+	}
+	rec, sw := v.recordNumber(f, cmd.P1, cmd.P2)
+	if sw != swOK {
+		return nil, sw
+	}
+	v.rec = rec
+	out := f.records[rec-1]
+	if cmd.Ne < len(out) {
+		return nil, swWrongLe(len(out))
+	}
+	return bytes.Clone(out), swOK
+}
+
+func (v *VirtualCard) updateRecord(cmd *apdu.Command) uint16 {
+	f, sw := v.recordTarget(cmd.P2, func(f *vfile) Access { return f.update })
+	if sw != swOK {
+		return sw
+	}
+	rec, sw := v.recordNumber(f, cmd.P1, cmd.P2)
+	if sw != swOK {
+		return sw
+	}
+	if !f.validRecord(cmd.Data) {
+		return swWrongLength
+	}
+	v.rec = rec
+	f.records[rec-1] = bytes.Clone(cmd.Data)
+	return swOK
+}
+
+// appendRecord adds a record to a linear EF, or replaces the oldest
+// record of a cyclic EF, where record 1 is always the latest written.
+func (v *VirtualCard) appendRecord(cmd *apdu.Command) uint16 {
+	if cmd.P1 != 0 || cmd.P2&0x07 != 0 {
+		return swWrongP1P2
+	}
+	f, sw := v.recordTarget(cmd.P2, func(f *vfile) Access { return f.update })
+	if sw != swOK {
+		return sw
+	}
+	if !f.validRecord(cmd.Data) {
+		return swWrongLength
+	}
+	r := bytes.Clone(cmd.Data)
+	switch {
+	case f.structure == StructureCyclic:
+		f.records = append([][]byte{r}, f.records[:min(len(f.records), f.maxRecs-1)]...)
+		v.rec = 1
+	case len(f.records) >= f.maxRecs:
+		return swNotEnoughMemory
+	default:
+		f.records = append(f.records, r)
+		v.rec = len(f.records)
+	}
+	return swOK
+}
+
+// searchRecord performs the simple search of the pattern from record P1.
+func (v *VirtualCard) searchRecord(cmd *apdu.Command) ([]byte, uint16) {
+	if cmd.P2&0x07 != 0x04 || cmd.P1 == 0 || len(cmd.Data) == 0 {
+		return nil, swWrongP1P2
+	}
+	f, sw := v.recordTarget(cmd.P2, func(f *vfile) Access { return f.read })
+	if sw != swOK {
+		return nil, sw
+	}
+	var out []byte
+	for rec := int(cmd.P1); rec <= len(f.records); rec++ {
+		if bytes.Contains(f.records[rec-1], cmd.Data) {
+			out = append(out, byte(rec))
+		}
+	}
+	if len(out) == 0 {
+		return nil, swRecordNotFound
+	}
+	return out, swOK
+}
+
+// retriesStatus is the status of a wrong value with left tries remaining.
+func retriesStatus(left int) uint16 {
+	if left == 0 {
+		return swBlocked
+	}
+	return 0x63C0 | uint16(min(left, 0x0F))
+}
+
+// check compares value with the reference data of p and updates its
+// retry counter and verified state.
+func (p *vpin) check(value []byte) uint16 {
+	if p.left == 0 {
+		return swBlocked
+	}
+	if subtle.ConstantTimeCompare(value, p.Value) != 1 {
+		p.left--
+		p.verified = false
+		return retriesStatus(p.left)
+	}
+	p.left = p.Retries
+	p.verified = true
+	return swOK
+}
+
+func (v *VirtualCard) verify(cmd *apdu.Command) uint16 {
+	p := v.pins[cmd.P2]
+	switch {
+	case p == nil:
+		return swDataNotFound
+	case cmd.P1 == 0xFF && len(cmd.Data) == 0:
+		p.verified = false
+		return swOK
+	case cmd.P1 != 0x00:
+		return swWrongP1P2
+	case len(cmd.Data) > 0:
+		return p.check(cmd.Data)
+	case p.verified:
+		return swOK
+	}
+	return retriesStatus(p.left)
+}
+
+func (v *VirtualCard) changeReferenceData(cmd *apdu.Command) uint16 {
+	p := v.pins[cmd.P2]
+	if p == nil {
+		return swDataNotFound
+	}
+	newPIN := cmd.Data
+	switch cmd.P1 {
+	case 0x00:
+		if len(cmd.Data) <= len(p.Value) {
+			return swWrongLength
+		}
+		if sw := p.check(cmd.Data[:len(p.Value)]); sw != swOK {
+			return sw
+		}
+		newPIN = cmd.Data[len(p.Value):]
+	case 0x01:
+		if !p.verified {
+			return swSecurityStatus
+		}
+	default:
+		return swWrongP1P2
+	}
+	if len(newPIN) == 0 {
+		return swWrongLength
+	}
+	p.Value = bytes.Clone(newPIN)
+	return swOK
+}
+
+// resetRetryCounter unblocks a PIN with its resetting code, P1 00 also
+// setting a new value and P1 01 keeping the current one.
+func (v *VirtualCard) resetRetryCounter(cmd *apdu.Command) uint16 {
+	p := v.pins[cmd.P2]
+	switch {
+	case p == nil:
+		return swDataNotFound
+	case cmd.P1 > 0x01:
+		return swWrongP1P2
+	case len(p.PUK) == 0:
+		return swSecurityStatus
+	case len(cmd.Data) < len(p.PUK), cmd.P1 == 0x01 && len(cmd.Data) != len(p.PUK), cmd.P1 == 0x00 && len(cmd.Data) == len(p.PUK):
+		return swWrongLength
+	case p.pukLeft == 0:
+		return swBlocked
+	}
+	if subtle.ConstantTimeCompare(cmd.Data[:len(p.PUK)], p.PUK) != 1 {
+		p.pukLeft--
+		return retriesStatus(p.pukLeft)
+	}
+	p.pukLeft = p.PUKRetries
+	if cmd.P1 == 0x00 {
+		p.Value = bytes.Clone(cmd.Data[len(p.PUK):])
+	}
+	p.left = p.Retries
+	return swOK
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+// ErrInvalidProfile is returned for a virtual card profile that cannot be loaded.
+var ErrInvalidProfile = errors.New("iso7816: invalid virtual card profile")
+
+// Access is the condition for an operation on a virtual file: always,
+// never, or the verification of the PIN with that reference.
+type Access int
+
+const (
+	AccessAlways Access = 0
+	AccessNever  Access = -1
+)
+
+// AccessPIN requires the PIN ref to be verified.
+func AccessPIN(ref byte) Access {
+	return Access(ref)
+}
+
+// MarshalJSON implements json.Marshaler, coding a PIN reference as a number.
+func (a Access) MarshalJSON() ([]byte, error) {
+	switch a {
+	case AccessAlways:
+		return json.Marshal("always")
+	case AccessNever:
+		return json.Marshal("never")
+	}
+	return json.Marshal(int(a))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Access) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		switch s {
+		case "always":
+			*a = AccessAlways
+		case "never":
+			*a = AccessNever
+		default:
+			return fmt.Errorf("%w: access condition %q", ErrInvalidProfile, s)
+		}
+		return nil
+	}
+	var ref int
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return err
+	}
+	if ref < 1 || ref > 0xFF {
+		return fmt.Errorf("%w: PIN reference %d", ErrInvalidProfile, ref)
+	}
+	*a = Access(ref)
+	return nil
+}
+
+// VirtualPIN describes the reference data of a virtual card. Values are
+// compared as sent in VERIFY, padding included.
+type VirtualPIN struct {
+	Ref        byte          `json:"ref"`
+	Value      apdu.HexBytes `json:"value"`
+	Retries    int           `json:"retries"`
+	PUK        apdu.HexBytes `json:"puk,omitempty"`
+	PUKRetries int           `json:"pukRetries,omitempty"`
+}
+
+// VirtualFile describes a DF or EF of a virtual card.
+type VirtualFile struct {
+	// FID is the two byte file identifier.
+	FID apdu.HexBytes `json:"fid"`
+	// Name is the DF name, such as an application identifier.
+	Name apdu.HexBytes `json:"name,omitempty"`
+	// Structure is "df", "transparent", "linear-fixed", "linear-variable"
+	// or "cyclic".
+	Structure string `json:"structure"`
+	SFI       byte   `json:"sfi,omitempty"`
+	// Size is the size of a transparent EF, at least the length of Data.
+	Size int           `json:"size,omitempty"`
+	Data apdu.HexBytes `json:"data,omitempty"`
+	// RecordSize is the length of the records of a linear fixed or cyclic
+	// EF, and the maximum length for a linear variable one.
+	RecordSize int             `json:"recordSize,omitempty"`
+	MaxRecords int             `json:"maxRecords,omitempty"`
+	Records    []apdu.HexBytes `json:"records,omitempty"`
+	Read       Access          `json:"read,omitempty"`
+	Update     Access          `json:"update,omitempty"`
+	Children   []VirtualFile   `json:"children,omitempty"`
+}
+
+// VirtualProfile describes a virtual card: its ATR, its reference data
+// and its file system below the MF.
+type VirtualProfile struct {
+	ATR  apdu.HexBytes `json:"atr,omitempty"`
+	PINs []VirtualPIN  `json:"pins,omitempty"`
+	MF   VirtualFile   `json:"mf"`
+}
+
+// LoadVirtualProfile decodes a JSON profile. Unknown fields are rejected
+// so typing errors in a layout do not go unnoticed. Profiles kept in YAML
+// must be converted first, the module depending on the standard library
+// only.
+func LoadVirtualProfile(r io.Reader) (*VirtualProfile, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	p := &VirtualProfile{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProfile, err)
+	}
+	return p, nil
+}
+
+var virtualStructures = map[string]FileStructure{
+	"df":              StructureNone,
+	"transparent":     StructureTransparent,
+	"linear-fixed":    StructureLinearFixed,
+	"linear-variable": StructureLinearVariable,
+	"cyclic":          StructureCyclic,
+}
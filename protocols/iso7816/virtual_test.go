@@ -0,0 +1,259 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package iso7816
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/happy-sdk/scardkit/apdu"
+)
+
+const virtualProfileJSON = `{
+  "atr": "3B8880010000000000000000",
+  "pins": [
+    {"ref": 129, "value": "31323334FFFFFFFF", "retries": 3, "puk": "3132333435363738"}
+  ],
+  "mf": {
+    "children": [
+      {"fid": "2F00", "structure": "linear-variable", "sfi": 30, "records": ["61084F06A00000000101"]},
+      {"fid": "5000", "structure": "df", "name": "A000000001", "children": [
+        {"fid": "5001", "structure": "transparent", "sfi": 1, "size": 300, "data": "0102030405"},
+        {"fid": "5002", "structure": "transparent", "data": "CAFE", "read": 129, "update": "never"},
+        {"fid": "5003", "structure": "linear-fixed", "recordSize": 4, "records": ["AAAAAAAA", "BBBBBBBB"], "update": 129},
+        {"fid": "5004", "structure": "cyclic", "recordSize": 2, "maxRecords": 2}
+      ]},
+      {"fid": "6000", "structure": "df", "name": "A000000002"}
+    ]
+  }
+}`
+
+func newVirtualCard(t *testing.T) (*VirtualCard, *Card) {
+	t.Helper()
+	p, err := LoadVirtualProfile(strings.NewReader(virtualProfileJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVirtualCard(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, NewCard(v)
+}
+
+func TestVirtualCardWrongLe(t *testing.T) {
+	v, _ := newVirtualCard(t)
+	fcp := mustHex(t, "00A4000402500001")
+	resp, err := v.Transmit(fcp)
+	if err != nil || len(resp) != 2 || resp[0] != 0x6C {
+		t.Fatalf("SELECT with Le 01 = % X, %v", resp, err)
+	}
+	fcp[len(fcp)-1] = resp[1]
+	if resp, err = v.Transmit(fcp); err != nil || len(resp) != int(fcp[len(fcp)-1])+2 {
+		t.Errorf("SELECT with Le %02X = % X, %v", fcp[len(fcp)-1], resp, err)
+	}
+	if _, err = v.Transmit(mustHex(t, "00A4020C025003")); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = v.Transmit(mustHex(t, "00B2010402")); err != nil || !bytes.Equal(resp, []byte{0x6C, 0x04}) {
+		t.Errorf("READ RECORD with Le 02 = % X, %v", resp, err)
+	}
+	for n, want := range map[int]uint16{4: 0x6C04, 255: 0x6CFF, 256: 0x6C00, 300: 0x6700} {
+		if got := swWrongLe(n); got != want {
+			t.Errorf("swWrongLe(%d) = %04X, want %04X", n, got, want)
+		}
+	}
+}
+
+func TestVirtualCardSelect(t *testing.T) {
+	v, c := newVirtualCard(t)
+	if !bytes.Equal(v.ATR(), mustHex(t, "3B8880010000000000000000")) {
+		t.Errorf("ATR() = % X", v.ATR())
+	}
+	info, err := c.SelectName([]byte{0xA0, 0x00, 0x00})
+	if err != nil || !bytes.Equal(info.DFName, mustHex(t, "A000000001")) || !info.IsDF() {
+		t.Fatalf("SelectName() = %v, %v", info, err)
+	}
+	if info, err = c.SelectNextName([]byte{0xA0}); err != nil || info.FID != 0x6000 {
+		t.Fatalf("SelectNextName() = %v, %v", info, err)
+	}
+	if _, err = c.SelectNextName([]byte{0xA0}); !errors.Is(err, apdu.ErrFileNotFound) {
+		t.Errorf("SelectNextName() past the last error = %v", err)
+	}
+	if info, err = c.SelectPath(FIDMasterFile, 0x5000, 0x5003); err != nil || info.Structure != StructureLinearFixed || info.Records != 2 || info.MaxRecordSize != 4 {
+		t.Fatalf("SelectPath() = %v, %v", info, err)
+	}
+	if info, err = c.SelectFID(0x5001); err != nil || info.Size != 300 || info.SFI != 1 {
+		t.Fatalf("SelectFID(sibling) = %v, %v", info, err)
+	}
+	if info, err = c.SelectParent(); err != nil || info.FID != FIDMasterFile {
+		t.Fatalf("SelectParent() = %v, %v", info, err)
+	}
+	if _, err = c.SelectChild(0x5000, true); !errors.Is(err, apdu.ErrFileNotFound) {
+		t.Errorf("SelectChild(DF as EF) error = %v", err)
+	}
+
+	var found []uint16
+	err = c.Walk([]uint16{0x2F00, 0x5000, 0x5001, 0x5002, 0x6000, 0x7000}, func(path []uint16, _ *FileInfo) error {
+		found = append(found, path[len(path)-1])
+		return nil
+	})
+	want := []uint16{FIDMasterFile, 0x2F00, 0x5000, 0x5001, 0x5002, 0x6000}
+	if err != nil || len(found) != len(want) {
+		t.Fatalf("Walk() found %04X, %v", found, err)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("Walk() found %04X, want %04X", found, want)
+			break
+		}
+	}
+}
+
+func TestVirtualCardBinary(t *testing.T) {
+	_, c := newVirtualCard(t)
+	if _, err := c.ReadBinary(0, 1); !errors.Is(err, apdu.ErrCommandNotAllowed) {
+		t.Errorf("ReadBinary() without current EF error = %v", err)
+	}
+	if _, err := c.SelectPath(FIDMasterFile, 0x5000); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.ReadBinarySFI(1, 0, 5)
+	if err != nil || !bytes.Equal(data, []byte{1, 2, 3, 4, 5}) {
+		t.Fatalf("ReadBinarySFI() = % X, %v", data, err)
+	}
+	if err := c.UpdateBinary(298, []byte{0xEE, 0xFF}); err != nil {
+		t.Fatalf("UpdateBinary() error = %v", err)
+	}
+	if err := c.UpdateBinary(299, []byte{0xEE, 0xFF}); err == nil {
+		t.Error("UpdateBinary() past the end succeeded")
+	}
+	data, err = c.ReadFile(0)
+	if err != nil || len(data) != 300 || data[299] != 0xFF {
+		t.Fatalf("ReadFile() = %d bytes, %v", len(data), err)
+	}
+
+	if _, err := c.SelectChild(0x5002, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadBinary(0, 0); !errors.Is(err, apdu.ErrSecurityStatusNotSatisfied) {
+		t.Errorf("ReadBinary() before VERIFY error = %v", err)
+	}
+	if err := c.Verify(0x81, mustHex(t, "31323334FFFFFFFF")); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if data, err := c.ReadBinary(0, 2); err != nil || !bytes.Equal(data, []byte{0xCA, 0xFE}) {
+		t.Errorf("ReadBinary() after VERIFY = % X, %v", data, err)
+	}
+	if err := c.UpdateBinary(0, []byte{0}); err == nil {
+		t.Error("UpdateBinary() of a never updatable EF succeeded")
+	}
+}
+
+func TestVirtualCardRecords(t *testing.T) {
+	_, c := newVirtualCard(t)
+	recs, err := c.ReadRecords(30)
+	if err != nil || len(recs) != 1 || !bytes.Equal(recs[0], mustHex(t, "61084F06A00000000101")) {
+		t.Fatalf("ReadRecords(30) = % X, %v", recs, err)
+	}
+	if _, err := c.SelectPath(FIDMasterFile, 0x5000, 0x5003); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateRecord(0, 2, []byte{1, 2, 3, 4}); !errors.Is(err, apdu.ErrSecurityStatusNotSatisfied) {
+		t.Errorf("UpdateRecord() before VERIFY error = %v", err)
+	}
+	if err := c.Verify(0x81, mustHex(t, "31323334FFFFFFFF")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateRecord(0, 2, []byte{1, 2, 3}); err == nil {
+		t.Error("UpdateRecord() of a short fixed record succeeded")
+	}
+	if err := c.UpdateRecord(0, 2, []byte{1, 2, 3, 4}); err != nil {
+		t.Errorf("UpdateRecord() error = %v", err)
+	}
+	if recs, err := c.SearchRecord(0, 1, []byte{0x02, 0x03}); err != nil || len(recs) != 1 || recs[0] != 2 {
+		t.Errorf("SearchRecord() = %v, %v", recs, err)
+	}
+	if _, err := c.ReadRecord(0, 3); !errors.Is(err, apdu.ErrRecordNotFound) {
+		t.Errorf("ReadRecord(3) error = %v", err)
+	}
+
+	if _, err := c.SelectFID(0x5004); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"0001", "0002", "0003"} {
+		if err := c.AppendRecord(0, mustHex(t, r)); err != nil {
+			t.Fatalf("AppendRecord(%s) error = %v", r, err)
+		}
+	}
+	recs, err = c.ReadRecords(0)
+	if err != nil || len(recs) != 2 || recs[0][1] != 3 || recs[1][1] != 2 {
+		t.Errorf("ReadRecords(cyclic) = % X, %v", recs, err)
+	}
+}
+
+func TestVirtualCardPIN(t *testing.T) {
+	v, c := newVirtualCard(t)
+	pin := mustHex(t, "31323334FFFFFFFF")
+	wrong := mustHex(t, "39393939FFFFFFFF")
+	if st, err := c.PINStatus(0x81); err != nil || st.Verified || st.Retries != 3 {
+		t.Fatalf("PINStatus() = %+v, %v", st, err)
+	}
+	for want := 2; want >= 0; want-- {
+		err := c.Verify(0x81, wrong)
+		if n, ok := RetriesLeft(err); !ok || n != want {
+			t.Fatalf("Verify(wrong) = %v, retries %d, want %d", err, n, want)
+		}
+	}
+	if err := c.Verify(0x81, pin); !errors.Is(err, apdu.ErrAuthMethodBlocked) {
+		t.Errorf("Verify() of a blocked PIN error = %v", err)
+	}
+	if err := c.ResetRetryCounter(0x81, mustHex(t, "3132333435363739"), nil); err == nil {
+		t.Error("ResetRetryCounter() with a wrong PUK succeeded")
+	}
+	newPIN := mustHex(t, "35363738FFFFFFFF")
+	if err := c.ResetRetryCounter(0x81, mustHex(t, "3132333435363738"), newPIN); err != nil {
+		t.Fatalf("ResetRetryCounter() error = %v", err)
+	}
+	if err := c.ChangeReferenceData(0x81, newPIN, pin); err != nil {
+		t.Fatalf("ChangeReferenceData() error = %v", err)
+	}
+	if st, err := c.PINStatus(0x81); err != nil || !st.Verified {
+		t.Errorf("PINStatus() after CHANGE REFERENCE DATA = %+v, %v", st, err)
+	}
+	v.Reset()
+	if st, err := c.PINStatus(0x81); err != nil || st.Verified || st.Retries != 3 {
+		t.Errorf("PINStatus() after Reset = %+v, %v", st, err)
+	}
+	if err := c.Verify(0x82, pin); !errors.Is(err, apdu.ErrReferenceDataNotFound) {
+		t.Errorf("Verify(unknown reference) error = %v", err)
+	}
+}
+
+func TestVirtualProfileErrors(t *testing.T) {
+	tests := []string{
+		`{"mf": {"children": [{"fid": "50", "structure": "transparent"}]}}`,
+		`{"mf": {"children": [{"fid": "5000", "structure": "folder"}]}}`,
+		`{"mf": {"children": [{"fid": "5000", "structure": "transparent", "read": 1}]}}`,
+		`{"mf": {"children": [{"fid": "5000", "structure": "linear-fixed", "recordSize": 2, "records": ["00"]}]}}`,
+		`{"mf": {"children": [{"fid": "5000", "structure": "transparent", "children": [{"fid": "5001", "structure": "df"}]}]}}`,
+		`{"mf": {"fid": "3F01"}}`,
+		`{"pins": [{"ref": 1, "value": "31", "retries": 0}], "mf": {}}`,
+	}
+	for _, profile := range tests {
+		p, err := LoadVirtualProfile(strings.NewReader(profile))
+		if err == nil {
+			_, err = NewVirtualCard(p)
+		}
+		if !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("profile %s error = %v", profile, err)
+		}
+	}
+	if _, err := LoadVirtualProfile(strings.NewReader(`{"mf": {}, "files": []}`)); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("unknown field error = %v", err)
+	}
+}
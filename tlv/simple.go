@@ -0,0 +1,103 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package tlv
+
+import "fmt"
+
+// Simple is a SIMPLE-TLV data object. The tag is a single byte from 01 to
+// FE and the length is encoded on one byte, or FF followed by two bytes.
+type Simple struct {
+	Tag   byte
+	Value []byte
+}
+
+// ParseSimple decodes data as a sequence of SIMPLE-TLV data objects.
+func ParseSimple(data []byte) ([]Simple, error) {
+	var objs []Simple
+	for off := 0; off < len(data); {
+		tag := data[off]
+		if tag == 0x00 || tag == 0xFF {
+			return nil, fmt.Errorf("%w: %02X at offset %d", ErrInvalidTag, tag, off)
+		}
+		off++
+		if off >= len(data) {
+			return nil, fmt.Errorf("%w at offset %d", ErrTruncated, off)
+		}
+		length := int(data[off])
+		off++
+		if length == 0xFF {
+			if off+2 > len(data) {
+				return nil, fmt.Errorf("%w at offset %d", ErrTruncated, off)
+			}
+			length = int(data[off])<<8 | int(data[off+1])
+			off += 2
+		}
+		if length > len(data)-off {
+			return nil, fmt.Errorf("%w: tag %02X needs %d bytes at offset %d", ErrTruncated, tag, length, off)
+		}
+		objs = append(objs, Simple{Tag: tag, Value: data[off : off+length]})
+		off += length
+	}
+	return objs, nil
+}
+
+// MarshalSimple encodes objs as SIMPLE-TLV data objects.
+func MarshalSimple(objs []Simple) ([]byte, error) {
+	var out []byte
+	for _, o := range objs {
+		if o.Tag == 0x00 || o.Tag == 0xFF {
+			return nil, fmt.Errorf("%w: %02X", ErrInvalidTag, o.Tag)
+		}
+		out = append(out, o.Tag)
+		switch l := len(o.Value); {
+		case l < 0xFF:
+			out = append(out, byte(l))
+		case l <= 0xFFFF:
+			out = append(out, 0xFF, byte(l>>8), byte(l))
+		default:
+			return nil, fmt.Errorf("%w: %d bytes", ErrInvalidLength, l)
+		}
+		out = append(out, o.Value...)
+	}
+	return out, nil
+}
+
+// Compact is a COMPACT-TLV data object as found in the historical bytes
+// of an ATR. Tag and length share a single byte, each a nibble.
+type Compact struct {
+	Tag   byte
+	Value []byte
+}
+
+// ParseCompact decodes data as a sequence of COMPACT-TLV data objects.
+func ParseCompact(data []byte) ([]Compact, error) {
+	var objs []Compact
+	for off := 0; off < len(data); {
+		tag, length := data[off]>>4, int(data[off]&0x0F)
+		off++
+		if length > len(data)-off {
+			return nil, fmt.Errorf("%w: tag %X needs %d bytes at offset %d", ErrTruncated, tag, length, off)
+		}
+		objs = append(objs, Compact{Tag: tag, Value: data[off : off+length]})
+		off += length
+	}
+	return objs, nil
+}
+
+// MarshalCompact encodes objs as COMPACT-TLV data objects.
+func MarshalCompact(objs []Compact) ([]byte, error) {
+	var out []byte
+	for _, o := range objs {
+		if o.Tag > 0x0F {
+			return nil, fmt.Errorf("%w: %X", ErrInvalidTag, o.Tag)
+		}
+		if len(o.Value) > 0x0F {
+			return nil, fmt.Errorf("%w: %d bytes", ErrInvalidLength, len(o.Value))
+		}
+		out = append(out, o.Tag<<4|byte(len(o.Value)))
+		out = append(out, o.Value...)
+	}
+	return out, nil
+}
@@ -0,0 +1,441 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+// Package tlv implements the BER-TLV, SIMPLE-TLV and COMPACT-TLV data object
+// encodings of ISO/IEC 7816-4 shared by card applications such as EMV,
+// eMRTD, UICC, PIV and GlobalPlatform.
+package tlv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDepth limits the nesting of data objects, counting the top level.
+const DefaultMaxDepth = 16
+
+var (
+	// ErrTruncated is returned when data ends inside a data object.
+	ErrTruncated = errors.New("tlv: truncated data object")
+	// ErrInvalidTag is returned for a malformed tag field.
+	ErrInvalidTag = errors.New("tlv: invalid tag")
+	// ErrInvalidLength is returned for a malformed or unsupported length field.
+	ErrInvalidLength = errors.New("tlv: invalid length")
+	// ErrMaxDepth is returned when constructed data objects nest too deep.
+	ErrMaxDepth = errors.New("tlv: maximum nesting depth exceeded")
+)
+
+// Class is the class of a BER-TLV tag, encoded in bits 8 and 7 of its first byte.
+type Class uint8
+
+const (
+	ClassUniversal       Class = iota // 00
+	ClassApplication                  // 01
+	ClassContextSpecific              // 10
+	ClassPrivate                      // 11
+)
+
+// Tag is a BER-TLV tag holding its encoded bytes, e.g. 0x9F38 or 0x5F24.
+type Tag uint32
+
+// Bytes returns the encoded tag.
+func (t Tag) Bytes() []byte {
+	switch {
+	case t > 0xFFFFFF:
+		return []byte{byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)}
+	case t > 0xFFFF:
+		return []byte{byte(t >> 16), byte(t >> 8), byte(t)}
+	case t > 0xFF:
+		return []byte{byte(t >> 8), byte(t)}
+	}
+	return []byte{byte(t)}
+}
+
+// first returns the first byte of the encoded tag.
+func (t Tag) first() byte { return t.Bytes()[0] }
+
+// Class returns the class of the tag.
+func (t Tag) Class() Class { return Class(t.first() >> 6) }
+
+// Constructed reports whether the tag denotes a constructed data object.
+func (t Tag) Constructed() bool { return t.first()&0x20 != 0 }
+
+// Valid reports whether the tag is a well formed BER-TLV tag.
+func (t Tag) Valid() bool {
+	b := t.Bytes()
+	if b[0] == 0x00 || b[0] == 0xFF {
+		return false
+	}
+	if b[0]&0x1F != 0x1F {
+		return len(b) == 1
+	}
+	if len(b) == 1 {
+		return false
+	}
+	for i, c := range b[1:] {
+		last := i == len(b)-2
+		if (c&0x80 == 0) != last {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the tag in hex, e.g. "9F38".
+func (t Tag) String() string {
+	return fmt.Sprintf("%X", t.Bytes())
+}
+
+// ParseTag parses a tag written in hex such as "5F24".
+func ParseTag(s string) (Tag, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s)%2 != 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTag, s)
+	}
+	t := Tag(v)
+	if !t.Valid() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTag, s)
+	}
+	return t, nil
+}
+
+// ParsePath parses a slash separated tag path such as "70/5F24".
+func ParsePath(path string) ([]Tag, error) {
+	var tags []Tag
+	for _, s := range strings.Split(path, "/") {
+		t, err := ParseTag(s)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// Object is a BER-TLV data object. Constructed objects produced by the
+// parser hold their decoded children in addition to the raw value.
+type Object struct {
+	Tag      Tag
+	Value    []byte
+	Children List
+}
+
+// New returns a primitive data object.
+func New(tag Tag, value []byte) *Object {
+	return &Object{Tag: tag, Value: value}
+}
+
+// NewConstructed returns a constructed data object holding children.
+func NewConstructed(tag Tag, children ...*Object) *Object {
+	return &Object{Tag: tag, Children: children}
+}
+
+// Find returns the first descendant matching path, see List.Find.
+func (o *Object) Find(path ...Tag) *Object {
+	return o.Children.Find(path...)
+}
+
+// Marshal encodes the data object. The value of a constructed object is
+// the encoding of its children when it has any.
+func (o *Object) Marshal() ([]byte, error) {
+	return o.appendTo(nil)
+}
+
+func (o *Object) appendTo(out []byte) ([]byte, error) {
+	if !o.Tag.Valid() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTag, o.Tag)
+	}
+	value := o.Value
+	if len(o.Children) > 0 {
+		if !o.Tag.Constructed() {
+			return nil, fmt.Errorf("tlv: primitive tag %s with children", o.Tag)
+		}
+		var err error
+		if value, err = o.Children.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+	out = append(out, o.Tag.Bytes()...)
+	out = appendLength(out, len(value))
+	return append(out, value...), nil
+}
+
+// List is a sequence of data objects.
+type List []*Object
+
+// Find returns the first object matching path, where each tag selects
+// a child of the object matched by the previous one. It returns nil
+// when no object matches.
+func (l List) Find(path ...Tag) *Object {
+	if len(path) == 0 {
+		return nil
+	}
+	for _, o := range l {
+		if o.Tag != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return o
+		}
+		if found := o.Children.Find(path[1:]...); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindPath is Find with a slash separated path such as "70/5F24".
+func (l List) FindPath(path string) *Object {
+	tags, err := ParsePath(path)
+	if err != nil {
+		return nil
+	}
+	return l.Find(tags...)
+}
+
+// FindAll returns every object matching path.
+func (l List) FindAll(path ...Tag) List {
+	if len(path) == 0 {
+		return nil
+	}
+	var found List
+	for _, o := range l {
+		if o.Tag != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			found = append(found, o)
+			continue
+		}
+		found = append(found, o.Children.FindAll(path[1:]...)...)
+	}
+	return found
+}
+
+// Marshal encodes all objects of the list.
+func (l List) Marshal() ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	for _, o := range l {
+		if out, err = o.appendTo(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Parse decodes data as a sequence of BER-TLV data objects, descending
+// into constructed objects up to DefaultMaxDepth levels. The padding
+// bytes 00 and FF between data objects are skipped.
+func Parse(data []byte) (List, error) {
+	return parse(data, 0, DefaultMaxDepth, 0)
+}
+
+// Split returns the encoding of each top level data object of data as
+// found there, tag and length fields included, for checksums computed
+// over the bytes received. The padding bytes 00 and FF are dropped.
+func Split(data []byte) ([][]byte, error) {
+	var out [][]byte
+	for off := 0; off < len(data); {
+		if data[off] == 0x00 || data[off] == 0xFF {
+			off++
+			continue
+		}
+		_, n, err := decodeTag(data[off:])
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d", err, off)
+		}
+		length, m, err := decodeLength(data[off+n:])
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d", err, off+n)
+		}
+		end := off + n + m + length
+		if length > len(data)-off-n-m {
+			return nil, fmt.Errorf("%w: %d bytes needed at offset %d", ErrTruncated, length, off+n+m)
+		}
+		out = append(out, data[off:end])
+		off = end
+	}
+	return out, nil
+}
+
+func parse(data []byte, depth, maxDepth, base int) (List, error) {
+	if depth >= maxDepth && len(data) > 0 {
+		return nil, fmt.Errorf("%w at offset %d", ErrMaxDepth, base)
+	}
+	var (
+		l   = List{}
+		off int
+	)
+	for off < len(data) {
+		if data[off] == 0x00 || data[off] == 0xFF {
+			off++
+			continue
+		}
+		tag, n, err := decodeTag(data[off:])
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d", err, base+off)
+		}
+		off += n
+		length, n, err := decodeLength(data[off:])
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d", err, base+off)
+		}
+		off += n
+		if length > len(data)-off {
+			return nil, fmt.Errorf("%w: tag %s needs %d bytes at offset %d", ErrTruncated, tag, length, base+off)
+		}
+		o := &Object{Tag: tag, Value: data[off : off+length]}
+		if tag.Constructed() {
+			if o.Children, err = parse(o.Value, depth+1, maxDepth, base+off); err != nil {
+				return nil, err
+			}
+		}
+		l = append(l, o)
+		off += length
+	}
+	return l, nil
+}
+
+func decodeTag(data []byte) (Tag, int, error) {
+	if len(data) == 0 {
+		return 0, 0, ErrTruncated
+	}
+	t := Tag(data[0])
+	if data[0]&0x1F != 0x1F {
+		return t, 1, nil
+	}
+	for i := 1; ; i++ {
+		if i >= len(data) {
+			return 0, 0, ErrTruncated
+		}
+		if i > 3 {
+			return 0, 0, ErrInvalidTag
+		}
+		t = t<<8 | Tag(data[i])
+		if data[i]&0x80 == 0 {
+			return t, i + 1, nil
+		}
+	}
+}
+
+func decodeLength(data []byte) (int, int, error) {
+	if len(data) == 0 {
+		return 0, 0, ErrTruncated
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), 1, nil
+	}
+	n := int(data[0] & 0x7F)
+	if n == 0 || n > 4 {
+		return 0, 0, ErrInvalidLength
+	}
+	if len(data) < 1+n {
+		return 0, 0, ErrTruncated
+	}
+	var l uint64
+	for _, c := range data[1 : 1+n] {
+		l = l<<8 | uint64(c)
+	}
+	if l > 1<<31-1 {
+		return 0, 0, ErrInvalidLength
+	}
+	return int(l), 1 + n, nil
+}
+
+// appendLength appends the minimal BER encoding of a length.
+func appendLength(out []byte, l int) []byte {
+	switch {
+	case l < 0x80:
+		return append(out, byte(l))
+	case l <= 0xFF:
+		return append(out, 0x81, byte(l))
+	case l <= 0xFFFF:
+		return append(out, 0x82, byte(l>>8), byte(l))
+	case l <= 0xFFFFFF:
+		return append(out, 0x83, byte(l>>16), byte(l>>8), byte(l))
+	}
+	return append(out, 0x84, byte(l>>24), byte(l>>16), byte(l>>8), byte(l))
+}
+
+// Decoder reads BER-TLV data objects one at a time from a stream.
+type Decoder struct {
+	r *bufio.Reader
+	// MaxDepth limits the nesting of constructed objects, zero selects DefaultMaxDepth.
+	MaxDepth int
+	off      int
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the next top level data object. It returns io.EOF when
+// the stream ends between data objects.
+func (d *Decoder) Next() (*Object, error) {
+	maxDepth := d.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	var head []byte
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		d.off++
+		if c != 0x00 && c != 0xFF {
+			head = append(head, c)
+			break
+		}
+	}
+	start := d.off - 1
+
+	// Read the remaining tag bytes and the length field.
+	for {
+		if tag, n, err := decodeTag(head); err == nil {
+			if l, m, err := decodeLength(head[n:]); err == nil {
+				return d.readValue(tag, l, start+n+m, maxDepth)
+			} else if !errors.Is(err, ErrTruncated) {
+				return nil, fmt.Errorf("%w at offset %d", err, start+n)
+			}
+		} else if !errors.Is(err, ErrTruncated) {
+			return nil, fmt.Errorf("%w at offset %d", err, start)
+		}
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d", ErrTruncated, d.off)
+		}
+		d.off++
+		head = append(head, c)
+	}
+}
+
+// readValue reads the value field of a data object starting at offset off
+// of the stream. The value is buffered as it arrives rather than allocated
+// up front, so a bogus length can not exhaust memory.
+func (d *Decoder) readValue(tag Tag, length, off, maxDepth int) (*Object, error) {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, d.r, int64(length))
+	d.off += int(n)
+	if err != nil {
+		return nil, fmt.Errorf("%w: tag %s needs %d bytes at offset %d", ErrTruncated, tag, length, off)
+	}
+	o := &Object{Tag: tag, Value: buf.Bytes()}
+	if tag.Constructed() {
+		if o.Children, err = parse(o.Value, 1, maxDepth, off); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package tlv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// fci is an EMV style FCI with a nested proprietary template and a
+// multi-byte tag.
+var fci = []byte{
+	0x6F, 0x1C,
+	0x84, 0x07, 0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10,
+	0xA5, 0x11,
+	0x50, 0x04, 0x56, 0x49, 0x53, 0x41,
+	0x9F, 0x38, 0x03, 0x9F, 0x1A, 0x02,
+	0x5F, 0x2D, 0x02, 0x65, 0x6E,
+}
+
+func TestParse(t *testing.T) {
+	l, err := Parse(fci)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(l) != 1 || l[0].Tag != 0x6F || len(l[0].Children) != 2 {
+		t.Fatalf("Parse() = %+v", l)
+	}
+	if got := l.FindPath("6F/A5/9F38"); got == nil || !bytes.Equal(got.Value, []byte{0x9F, 0x1A, 0x02}) {
+		t.Errorf("FindPath(6F/A5/9F38) = %+v", got)
+	}
+	if got := l.Find(0x6F, 0xA5, 0x5F2D); got == nil || string(got.Value) != "en" {
+		t.Errorf("Find(6F, A5, 5F2D) = %+v", got)
+	}
+	if got := l.FindPath("6F/84/50"); got != nil {
+		t.Errorf("FindPath() descended into a primitive object")
+	}
+
+	out, err := l.Marshal()
+	if err != nil || !bytes.Equal(out, fci) {
+		t.Errorf("Marshal() = % X, %v, want % X", out, err, fci)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"truncated value", []byte{0x84, 0x05, 0x01}, ErrTruncated},
+		{"truncated tag", []byte{0x9F}, ErrTruncated},
+		{"truncated length", []byte{0x9F, 0x38}, ErrTruncated},
+		{"tag too long", []byte{0x9F, 0x81, 0x81, 0x81, 0x01, 0x00}, ErrInvalidTag},
+		{"indefinite length", []byte{0x70, 0x80, 0x00, 0x00}, ErrInvalidLength},
+		{"child overruns parent", []byte{0x70, 0x03, 0x84, 0x05, 0x01}, ErrTruncated},
+		{"too deep", nestedTemplates(DefaultMaxDepth), ErrMaxDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Parse() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := Parse(nestedTemplates(DefaultMaxDepth - 1)); err != nil {
+		t.Errorf("Parse() of %d nested templates error = %v", DefaultMaxDepth-1, err)
+	}
+}
+
+// nestedTemplates returns n constructed 70 templates nested in each
+// other around a primitive data object.
+func nestedTemplates(n int) []byte {
+	data := []byte{0x80, 0x01, 0xAA}
+	for i := 0; i < n; i++ {
+		data = append([]byte{0x70, byte(len(data))}, data...)
+	}
+	return data
+}
+
+func TestMarshalLengths(t *testing.T) {
+	tests := []struct {
+		size int
+		head []byte
+	}{
+		{0x7F, []byte{0x53, 0x7F}},
+		{0x80, []byte{0x53, 0x81, 0x80}},
+		{0x100, []byte{0x53, 0x82, 0x01, 0x00}},
+		{0x10000, []byte{0x53, 0x83, 0x01, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		out, err := New(0x53, make([]byte, tt.size)).Marshal()
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		if !bytes.HasPrefix(out, tt.head) || len(out) != len(tt.head)+tt.size {
+			t.Errorf("Marshal() of %d bytes starts with % X, want % X", tt.size, out[:len(tt.head)], tt.head)
+		}
+		l, err := Parse(out)
+		if err != nil || len(l[0].Value) != tt.size {
+			t.Errorf("Parse() of %d bytes = %v", tt.size, err)
+		}
+	}
+
+	obj := NewConstructed(0x7C, New(0x81, nil), New(0x82, []byte{0x01}))
+	out, err := obj.Marshal()
+	want := []byte{0x7C, 0x05, 0x81, 0x00, 0x82, 0x01, 0x01}
+	if err != nil || !bytes.Equal(out, want) {
+		t.Errorf("Marshal() = % X, %v, want % X", out, err, want)
+	}
+	if _, err := New(0x9F, nil).Marshal(); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Marshal() error = %v, want %v", err, ErrInvalidTag)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	data := append(append([]byte{0x00}, fci...), 0xFF, 0x99, 0x81, 0x02, 0x90, 0x00)
+	raws, err := Split(data)
+	if err != nil || len(raws) != 2 {
+		t.Fatalf("Split() = % X, %v", raws, err)
+	}
+	if !bytes.Equal(raws[0], fci) || !bytes.Equal(raws[1], []byte{0x99, 0x81, 0x02, 0x90, 0x00}) {
+		t.Errorf("Split() = % X", raws)
+	}
+	if _, err := Split([]byte{0x5A, 0x03, 0x01}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Split() error = %v, want %v", err, ErrTruncated)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	stream := append(append([]byte{0x00, 0x00}, fci...), 0xFF, 0x5A, 0x02, 0x12, 0x34)
+	d := NewDecoder(bytes.NewReader(stream))
+
+	o, err := d.Next()
+	if err != nil || o.Tag != 0x6F || o.Find(0xA5, 0x50) == nil {
+		t.Fatalf("Next() = %+v, %v", o, err)
+	}
+	o, err = d.Next()
+	if err != nil || o.Tag != 0x5A || !bytes.Equal(o.Value, []byte{0x12, 0x34}) {
+		t.Fatalf("Next() = %+v, %v", o, err)
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+
+	d = NewDecoder(bytes.NewReader([]byte{0x5A, 0x84, 0x7F, 0xFF, 0xFF, 0xFF, 0x01}))
+	if _, err := d.Next(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Next() error = %v, want %v", err, ErrTruncated)
+	}
+	d = NewDecoder(bytes.NewReader(nestedTemplates(3)))
+	d.MaxDepth = 2
+	if _, err := d.Next(); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Next() error = %v, want %v", err, ErrMaxDepth)
+	}
+}
+
+func TestSimpleAndCompact(t *testing.T) {
+	simple := []Simple{{Tag: 0x01, Value: []byte{0xAA}}, {Tag: 0x02, Value: make([]byte, 300)}}
+	out, err := MarshalSimple(simple)
+	if err != nil {
+		t.Fatalf("MarshalSimple() error = %v", err)
+	}
+	if !bytes.Equal(out[:6], []byte{0x01, 0x01, 0xAA, 0x02, 0xFF, 0x01}) {
+		t.Errorf("MarshalSimple() = % X", out[:6])
+	}
+	back, err := ParseSimple(out)
+	if err != nil || len(back) != 2 || len(back[1].Value) != 300 {
+		t.Errorf("ParseSimple() = %v, %v", back, err)
+	}
+	if _, err := ParseSimple([]byte{0x01, 0x05, 0x00}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("ParseSimple() error = %v, want %v", err, ErrTruncated)
+	}
+
+	// Historical bytes of a card announcing card capabilities.
+	hist := []byte{0x31, 0x80, 0x73, 0xC8, 0x21, 0x40}
+	compact, err := ParseCompact(hist)
+	if err != nil || len(compact) != 2 || compact[1].Tag != 0x07 || len(compact[1].Value) != 3 {
+		t.Fatalf("ParseCompact() = %v, %v", compact, err)
+	}
+	out, err = MarshalCompact(compact)
+	if err != nil || !bytes.Equal(out, hist) {
+		t.Errorf("MarshalCompact() = % X, %v, want % X", out, err, hist)
+	}
+	if _, err := ParseCompact([]byte{0x73, 0x01}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("ParseCompact() error = %v, want %v", err, ErrTruncated)
+	}
+}
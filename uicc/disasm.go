@@ -0,0 +1,119 @@
+// Copyright 2023 The Happy Authors
+// Licensed under the Apache License, Version 2.0.
+// See the LICENSE file.
+
+package uicc
+
+import (
+	"fmt"
+
+	"github.com/happy-sdk/scardkit/apdu"
+	"github.com/happy-sdk/scardkit/tlv"
+)
+
+func init() {
+	apdu.RegisterInstructions(gsmInstructions)
+	apdu.RegisterInstructions(uiccInstructions)
+}
+
+// gsmInstructions are the GSM 11.11 SIM commands using class A0.
+var gsmInstructions = &apdu.InstructionTable{
+	Name:  "GSM 11.11",
+	Match: func(cla byte) bool { return cla == 0xA0 },
+	Instructions: map[byte]apdu.Instruction{
+		0x04: {Name: "INVALIDATE"},
+		0x10: {Name: "TERMINAL PROFILE"},
+		0x12: {Name: "FETCH"},
+		0x14: {Name: "TERMINAL RESPONSE"},
+		0x20: {Name: "VERIFY CHV", Params: chvParams},
+		0x24: {Name: "CHANGE CHV", Params: chvParams},
+		0x26: {Name: "DISABLE CHV", Params: chvParams},
+		0x28: {Name: "ENABLE CHV", Params: chvParams},
+		0x2C: {Name: "UNBLOCK CHV", Params: chvParams},
+		0x32: {Name: "INCREASE"},
+		0x44: {Name: "REHABILITATE"},
+		0x88: {Name: "RUN GSM ALGORITHM"},
+		0xA2: {Name: "SEEK"},
+		0xA4: {Name: "SELECT"},
+		0xB0: {Name: "READ BINARY", Params: offsetParams},
+		0xB2: {Name: "READ RECORD", Params: recordParams},
+		0xC0: {Name: "GET RESPONSE"},
+		0xC2: {Name: "ENVELOPE"},
+		0xD6: {Name: "UPDATE BINARY", Params: offsetParams},
+		0xDC: {Name: "UPDATE RECORD", Params: recordParams},
+		0xF2: {Name: "STATUS"},
+		0xFA: {Name: "SLEEP"},
+	},
+}
+
+// uiccInstructions are the ETSI TS 102 221 commands using the
+// proprietary 8X, CX and EX classes.
+var uiccInstructions = &apdu.InstructionTable{
+	Name: "ETSI TS 102 221",
+	Match: func(cla byte) bool {
+		c := cla & 0xF0
+		return c == 0x80 || c == 0xC0 || c == 0xE0
+	},
+	Instructions: map[byte]apdu.Instruction{
+		0x10: {Name: "TERMINAL PROFILE"},
+		0x12: {Name: "FETCH"},
+		0x14: {Name: "TERMINAL RESPONSE"},
+		0x32: {Name: "INCREASE"},
+		0x73: {Name: "MANAGE SECURE CHANNEL"},
+		0x75: {Name: "TRANSACT DATA"},
+		0x76: {Name: "SUSPEND UICC"},
+		0x78: {Name: "GET IDENTITY"},
+		0xAA: {Name: "TERMINAL CAPABILITY", TLVData: true},
+		0xC2: {Name: "ENVELOPE", TLVData: true},
+		0xCB: {Name: "RETRIEVE DATA"},
+		0xDB: {Name: "SET DATA"},
+		0xF2: {Name: "STATUS", Params: statusParams},
+	},
+	TagNames: map[tlv.Tag]string{
+		0xD0: "proactive command",
+		0xD1: "SMS-PP download",
+		0xD3: "menu selection",
+		0xD6: "event download",
+	},
+}
+
+func chvParams(p1, p2 byte) string {
+	return fmt.Sprintf("CHV%d", p2)
+}
+
+func offsetParams(p1, p2 byte) string {
+	return fmt.Sprintf("offset %d", int(p1)<<8|int(p2))
+}
+
+func recordParams(p1, p2 byte) string {
+	switch p2 {
+	case 0x02:
+		return "next record"
+	case 0x03:
+		return "previous record"
+	case 0x04:
+		return fmt.Sprintf("record %d", p1)
+	}
+	return fmt.Sprintf("record %d, mode %02X", p1, p2)
+}
+
+func statusParams(p1, p2 byte) string {
+	var s string
+	switch p1 {
+	case 0x00:
+		s = "no indication"
+	case 0x01:
+		s = "application initialised"
+	case 0x02:
+		s = "application terminating"
+	}
+	switch p2 {
+	case 0x00:
+		s += ", return FCP"
+	case 0x01:
+		s += ", return DF name"
+	case 0x0C:
+		s += ", no data returned"
+	}
+	return s
+}